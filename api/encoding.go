@@ -0,0 +1,102 @@
+package api
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SunSince90/ASTRID-kube/settings"
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/SunSince90/ASTRID-kube/utils"
+)
+
+// negotiate returns the format that the client prefers among the supported ones, according to the Accept header.
+// It returns false if the client accepts none of them.
+func negotiate(accept string) (types.EncodingType, bool) {
+	//	Anything goes: use the same format as the infrastructure info that is sent
+	preferred := settings.Settings.Formats.InfrastructureInfo
+	switch preferred {
+	case types.XML, types.YAML, types.JSON:
+	default:
+		preferred = types.JSON
+	}
+	if len(strings.TrimSpace(accept)) == 0 {
+		return preferred, true
+	}
+
+	type mediaRange struct {
+		contentType string
+		quality     float64
+	}
+	ranges := []mediaRange{}
+	for _, value := range strings.Split(accept, ",") {
+		parts := strings.Split(value, ";")
+		r := mediaRange{contentType: strings.ToLower(strings.TrimSpace(parts[0])), quality: 1}
+		for _, parameter := range parts[1:] {
+			parameter = strings.TrimSpace(parameter)
+			if !strings.HasPrefix(parameter, "q=") {
+				continue
+			}
+			if quality, err := strconv.ParseFloat(strings.TrimPrefix(parameter, "q="), 64); err == nil {
+				r.quality = quality
+			}
+		}
+		if r.quality > 0 {
+			ranges = append(ranges, r)
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+
+	for _, r := range ranges {
+		if r.contentType == "*/*" || r.contentType == "application/*" {
+			return preferred, true
+		}
+		if format, ok := utils.EncodingFromContentType(r.contentType); ok {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// respond writes data in the format that the client prefers, with an ETag so that clients
+// can ask for it again only if it has changed.
+func respond(w http.ResponseWriter, r *http.Request, data interface{}) {
+	format, ok := negotiate(r.Header.Get("Accept"))
+	if !ok {
+		http.Error(w, "Supported formats are "+strings.Join([]string{types.ContentTypeXML, types.ContentTypeYAML, types.ContentTypeJSON}, ", "), http.StatusNotAcceptable)
+		return
+	}
+
+	body, contentType, err := utils.Marshal(format, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	etag := fmt.Sprintf("\"%x\"", sha1.Sum(body))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Vary", "Accept")
+	if matches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+// matches checks if an If-None-Match header includes the provided ETag
+func matches(ifNoneMatch, etag string) bool {
+	for _, value := range strings.Split(ifNoneMatch, ",") {
+		value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+		if value == "*" || value == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/graph"
+	"github.com/SunSince90/ASTRID-kube/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	contentTypeSSE    = "text/event-stream"
+	contentTypeNDJSON = "application/x-ndjson"
+	//	heartbeatInterval is how often proxies are told that an idle stream is still alive
+	heartbeatInterval = 30 * time.Second
+)
+
+// handleEvents returns the events of a graph, or of all graphs if graphName is empty.
+// With watch=true, the next ones are streamed as they happen.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request, graphName string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	//	Browsers resume Server-Sent Events with the id of the last one they got
+	value := r.URL.Query().Get("since")
+	if len(value) == 0 {
+		value = r.Header.Get("Last-Event-ID")
+	}
+
+	var since *uint64
+	if len(value) > 0 {
+		sequence, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			http.Error(w, "since must be the sequence of an event", http.StatusBadRequest)
+			return
+		}
+		since = &sequence
+	}
+
+	if r.URL.Query().Get("watch") == "true" {
+		s.watchEvents(w, r, graphName, since)
+		return
+	}
+
+	sequence := uint64(0)
+	if since != nil {
+		sequence = *since
+	}
+	records, err := s.manager.Events(graphName, sequence)
+	if err != nil {
+		http.Error(w, err.Error(), eventsErrorStatus(err))
+		return
+	}
+	respond(w, r, types.EventList{Events: records})
+}
+
+// watchEvents streams events as Server-Sent Events, if the client accepts them, or as newline-delimited JSON
+func (s *Server) watchEvents(w http.ResponseWriter, r *http.Request, graphName string, since *uint64) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	records, next, stop, err := s.manager.WatchEvents(graphName, since)
+	if err != nil {
+		http.Error(w, err.Error(), eventsErrorStatus(err))
+		return
+	}
+	defer stop()
+
+	sse := strings.Contains(r.Header.Get("Accept"), contentTypeSSE)
+	write := writeNDJSON
+	w.Header().Set("Content-Type", contentTypeNDJSON)
+	if sse {
+		write = writeSSE
+		w.Header().Set("Content-Type", contentTypeSSE)
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	for _, record := range records {
+		if err := write(w, record); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case record, open := <-next:
+			//	Too slow: the client can resume with the last sequence it got
+			if !open {
+				log.Infoln("Stopped streaming events to a client that could not keep up:", r.RemoteAddr)
+				return
+			}
+			if err := write(w, record); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if sse {
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeSSE writes an event as a Server-Sent Event, with its sequence as id so that clients can resume from it
+func writeSSE(w http.ResponseWriter, record types.EventRecord) error {
+	data, err := json.Marshal(record.Event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", record.Sequence, record.Event.Type, data)
+	return err
+}
+
+// writeNDJSON writes an event in a line of its own
+func writeNDJSON(w http.ResponseWriter, record types.EventRecord) error {
+	return json.NewEncoder(w).Encode(record)
+}
+
+func eventsErrorStatus(err error) int {
+	if err == graph.ErrEventsExpired {
+		return http.StatusGone
+	}
+	return http.StatusNotFound
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListEvents(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+
+	response := get(t, server.URL+"/graphs/mygraph/events", map[string]string{"Accept": "application/json"})
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	list := types.EventList{}
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&list))
+	assert.Len(t, list.Events, 1)
+
+	response = get(t, server.URL+"/events?since=5", nil)
+	response.Body.Close()
+	assert.Equal(t, http.StatusGone, response.StatusCode)
+
+	response = get(t, server.URL+"/events?since=last", nil)
+	response.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
+
+func TestWatchEventsNDJSON(t *testing.T) {
+	manager := newTestManager()
+	server := httptest.NewServer(New(manager, "token"))
+	defer server.Close()
+
+	response := get(t, server.URL+"/events?watch=true&since=0", nil)
+	defer response.Body.Close()
+	assert.Equal(t, contentTypeNDJSON, response.Header.Get("Content-Type"))
+
+	decoder := json.NewDecoder(response.Body)
+	record := types.EventRecord{}
+	assert.NoError(t, decoder.Decode(&record))
+	assert.Equal(t, uint64(1), record.Sequence)
+
+	manager.events <- types.EventRecord{Sequence: 2, Event: types.InfrastructureEvent{GraphName: "mygraph", Type: types.Delete}}
+	assert.NoError(t, decoder.Decode(&record))
+	assert.Equal(t, uint64(2), record.Sequence)
+	assert.Equal(t, types.Delete, record.Event.Type)
+
+	//	The stream ends when ASTRID-kube stops it
+	close(manager.events)
+	assert.Error(t, decoder.Decode(&record))
+}
+
+func TestWatchEventsSSE(t *testing.T) {
+	manager := newTestManager()
+	server := httptest.NewServer(New(manager, "token"))
+	defer server.Close()
+
+	response := get(t, server.URL+"/graphs/mygraph/events?watch=true", map[string]string{"Accept": contentTypeSSE, "Last-Event-ID": "0"})
+	defer response.Body.Close()
+	assert.Equal(t, contentTypeSSE, response.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(response.Body)
+	lines := []string{}
+	for i := 0; i < 4; i++ {
+		line, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		lines = append(lines, line)
+	}
+	assert.Equal(t, "id: 1\n", lines[0])
+	assert.Equal(t, "event: new\n", lines[1])
+	assert.Contains(t, lines[2], `"graphName":"mygraph"`)
+	assert.Equal(t, "\n", lines[3])
+}
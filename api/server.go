@@ -0,0 +1,338 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/graph"
+	"github.com/SunSince90/ASTRID-kube/types"
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
+	log "github.com/sirupsen/logrus"
+)
+
+// Server serves the API that lets users act on graphs
+type Server struct {
+	manager graph.Manager
+	token   string
+	mux     *http.ServeMux
+}
+
+// New returns a server that only accepts requests with the provided bearer token
+func New(manager graph.Manager, token string) *Server {
+	server := &Server{
+		manager: manager,
+		token:   token,
+		mux:     http.NewServeMux(),
+	}
+
+	server.mux.HandleFunc("/graphs", server.handleListGraphs)
+	server.mux.HandleFunc("/graphs/", server.handleGraphs)
+	server.mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		server.handleEvents(w, r, "")
+	})
+	server.mux.HandleFunc("/subscriptions", server.handleSubscriptions)
+	server.mux.HandleFunc("/subscriptions/", server.handleSubscriptions)
+	return server
+}
+
+// Serve starts serving the API at the provided address
+func Serve(address, token string, manager graph.Manager) {
+	if len(token) < 1 {
+		log.Errorln("No token has been specified for the API. Will not serve it.")
+		return
+	}
+
+	log.Infoln("Serving API on", address)
+	if err := http.ListenAndServe(address, New(manager, token)); err != nil {
+		log.Errorln("Could not serve API:", err)
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticated(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// errorStatus is the status code of a request that failed with the provided error:
+// resources that do not exist are not found, while anything else conflicts with their current state.
+func errorStatus(err error) int {
+	switch err {
+	case graph.ErrGraphNotFound, graph.ErrInstanceNotFound, graph.ErrSubscriptionNotFound, graph.ErrCaptureNotFound:
+		return http.StatusNotFound
+	}
+	return http.StatusConflict
+}
+
+func (s *Server) authenticated(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+
+	token := strings.TrimPrefix(header, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// handleGraphs routes all requests under /graphs/
+func (s *Server) handleGraphs(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/graphs/"), "/"), "/")
+
+	switch {
+	//	/graphs/{graph}
+	case len(path) == 1 && len(path[0]) > 0:
+		s.handleGetGraph(w, r, path[0])
+	//	/graphs/{graph}/infrastructure-info
+	case len(path) == 2 && path[1] == "infrastructure-info":
+		s.handleInfrastructureInfo(w, r, path[0])
+	//	/graphs/{graph}/events
+	case len(path) == 2 && path[1] == "events":
+		s.handleEvents(w, r, path[0])
+	//	/graphs/{graph}/instances/{uid}/quarantine
+	case len(path) == 4 && path[1] == "instances" && path[3] == "quarantine":
+		s.handleQuarantine(w, r, path[0], path[2])
+	//	/graphs/{graph}/instances/{uid}/release
+	case len(path) == 4 && path[1] == "instances" && path[3] == "release":
+		s.handleRelease(w, r, path[0], path[2])
+	//	/graphs/{graph}/instances/{uid}/temporary-rules
+	case len(path) == 4 && path[1] == "instances" && path[3] == "temporary-rules":
+		s.handleAddTemporaryRule(w, r, path[0], path[2])
+	//	/graphs/{graph}/instances/{uid}/captures
+	case len(path) == 4 && path[1] == "instances" && path[3] == "captures":
+		s.handleStartCapture(w, r, path[0], path[2])
+	//	/graphs/{graph}/captures
+	case len(path) >= 2 && path[1] == "captures":
+		s.handleCaptures(w, r, path[0], path[2:])
+	//	/graphs/{graph}/temporary-rules
+	case len(path) == 2 && path[1] == "temporary-rules":
+		s.handleListTemporaryRules(w, r, path[0])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) handleListGraphs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	respond(w, r, types.GraphList{Graphs: s.manager.Graphs()})
+}
+
+func (s *Server) handleGetGraph(w http.ResponseWriter, r *http.Request, graphName string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status, err := s.manager.Status(graphName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	respond(w, r, status)
+}
+
+func (s *Server) handleInfrastructureInfo(w http.ResponseWriter, r *http.Request, graphName string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	info, err := s.manager.InfrastructureInfo(graphName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	respond(w, r, info)
+}
+
+func (s *Server) handleQuarantine(w http.ResponseWriter, r *http.Request, graphName, uid string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := s.manager.Quarantine(graphName, uid); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleRelease(w http.ResponseWriter, r *http.Request, graphName, uid string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := s.manager.Release(graphName, uid); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// temporaryRuleRequest is the body of a request to add a temporary rule
+type temporaryRuleRequest struct {
+	Direction string                `json:"direction"`
+	Rule      k8sfirewall.ChainRule `json:"rule"`
+	//	TTL is how many seconds the rule will last
+	TTL    int64  `json:"ttl"`
+	Owner  string `json:"owner"`
+	Reason string `json:"reason"`
+}
+
+func (s *Server) handleAddTemporaryRule(w http.ResponseWriter, r *http.Request, graphName, uid string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	request := temporaryRuleRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(request.Owner) < 1 {
+		http.Error(w, "An owner must be specified", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.manager.AddTemporaryRule(graphName, uid, request.Direction, request.Rule, time.Duration(request.TTL)*time.Second, request.Owner, request.Reason); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) handleListTemporaryRules(w http.ResponseWriter, r *http.Request, graphName string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rules, err := s.manager.TemporaryRules(graphName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// captureRequest is the body of a request to capture traffic
+type captureRequest struct {
+	Filter types.CaptureFilter `json:"filter"`
+	//	Duration is how many seconds the capture will last
+	Duration int64 `json:"duration"`
+}
+
+func (s *Server) handleStartCapture(w http.ResponseWriter, r *http.Request, graphName, uid string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	request := captureRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session, err := s.manager.Capture(graphName, uid, request.Filter, time.Duration(request.Duration)*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+// handleSubscriptions routes all requests under /subscriptions
+func (s *Server) handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/subscriptions"), "/"), "/")
+
+	switch {
+	//	/subscriptions
+	case len(path) == 1 && len(path[0]) == 0 && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.manager.Subscriptions())
+	case len(path) == 1 && len(path[0]) == 0 && r.Method == http.MethodPost:
+		subscription := types.Subscription{}
+		if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		subscription, err := s.manager.Subscribe(subscription)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(subscription)
+	//	/subscriptions/{id}
+	case len(path) == 1 && r.Method == http.MethodDelete:
+		if err := s.manager.Unsubscribe(path[0]); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleCaptures routes all requests under /graphs/{graph}/captures
+func (s *Server) handleCaptures(w http.ResponseWriter, r *http.Request, graphName string, path []string) {
+	switch {
+	//	/graphs/{graph}/captures
+	case len(path) == 0 && r.Method == http.MethodGet:
+		list, err := s.manager.Captures(graphName)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	//	/graphs/{graph}/captures/{id}
+	case len(path) == 1 && r.Method == http.MethodGet:
+		session, err := s.manager.GetCapture(graphName, path[0])
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(session)
+	case len(path) == 1 && r.Method == http.MethodDelete:
+		if err := s.manager.CancelCapture(graphName, path[0]); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	//	/graphs/{graph}/captures/{id}/pcap
+	case len(path) == 2 && path[1] == "pcap" && r.Method == http.MethodGet:
+		data, err := s.manager.CaptureData(graphName, path[0])
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+path[0]+".pcap\"")
+		w.Write(data)
+	default:
+		http.NotFound(w, r)
+	}
+}
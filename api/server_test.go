@@ -0,0 +1,274 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/graph"
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// testManager is a graph manager with a single graph, "mygraph"
+type testManager struct {
+	graph.Manager
+	info        types.InfrastructureInfo
+	events      chan types.EventRecord
+	quarantined map[string]bool
+}
+
+func (m *testManager) Graphs() []types.GraphStatus {
+	return []types.GraphStatus{{Name: "mygraph", Phase: "ready"}}
+}
+
+func (m *testManager) Status(name string) (types.GraphStatus, error) {
+	if name != "mygraph" {
+		return types.GraphStatus{}, errors.New("Graph does not exist")
+	}
+	return types.GraphStatus{Name: "mygraph", Phase: "ready"}, nil
+}
+
+// Quarantine only knows the instance "apache-1"
+func (m *testManager) Quarantine(name, uid string) error {
+	if name != "mygraph" {
+		return graph.ErrGraphNotFound
+	}
+	if uid != "apache-1" {
+		return graph.ErrInstanceNotFound
+	}
+	if m.quarantined[uid] {
+		return errors.New("Instance is already quarantined")
+	}
+	m.quarantined[uid] = true
+	return nil
+}
+
+func (m *testManager) Release(name, uid string) error {
+	if name != "mygraph" {
+		return graph.ErrGraphNotFound
+	}
+	if uid != "apache-1" {
+		return graph.ErrInstanceNotFound
+	}
+	if !m.quarantined[uid] {
+		return errors.New("Instance is not quarantined")
+	}
+	delete(m.quarantined, uid)
+	return nil
+}
+
+func (m *testManager) Unsubscribe(id string) error {
+	return graph.ErrSubscriptionNotFound
+}
+
+func (m *testManager) InfrastructureInfo(name string) (types.InfrastructureInfo, error) {
+	if name != "mygraph" {
+		return types.InfrastructureInfo{}, errors.New("Graph does not exist")
+	}
+	return m.info, nil
+}
+
+func (m *testManager) Events(name string, since uint64) ([]types.EventRecord, error) {
+	if since > 0 {
+		return nil, graph.ErrEventsExpired
+	}
+	return []types.EventRecord{{Sequence: 1, Event: types.InfrastructureEvent{GraphName: "mygraph", Type: types.New}}}, nil
+}
+
+func (m *testManager) WatchEvents(name string, since *uint64) ([]types.EventRecord, <-chan types.EventRecord, func(), error) {
+	if since == nil {
+		return nil, m.events, func() {}, nil
+	}
+	records, err := m.Events(name, *since)
+	return records, m.events, func() {}, err
+}
+
+func testServer() *httptest.Server {
+	return testServerWith(newTestManager())
+}
+
+func testServerWith(manager *testManager) *httptest.Server {
+	return httptest.NewServer(New(manager, "token"))
+}
+
+func newTestManager() *testManager {
+	return &testManager{
+		events:      make(chan types.EventRecord, 1),
+		quarantined: map[string]bool{},
+		info: types.InfrastructureInfo{
+			Kind: types.KIND,
+			Metadata: types.InfrastructureInfoMetadata{
+				Name:       "mygraph",
+				LastUpdate: time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC),
+			},
+			Spec: types.InfrastructureInfoSpec{
+				Services: []types.InfrastructureInfoService{
+					{Name: "apache", Instances: []types.InfrastructureInfoServiceInstance{{IP: "10.0.0.1", UID: "apache-1"}}},
+				},
+			},
+		},
+	}
+}
+
+func get(t *testing.T, url string, headers map[string]string) *http.Response {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	assert.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer token")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	return response
+}
+
+// do sends an authenticated request and returns its status code
+func do(t *testing.T, method, url string) int {
+	request, err := http.NewRequest(method, url, nil)
+	assert.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer token")
+
+	response, err := http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	return response.StatusCode
+}
+
+func TestListGraphs(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+
+	response := get(t, server.URL+"/graphs", map[string]string{"Accept": "application/json"})
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, types.ContentTypeJSON, response.Header.Get("Content-Type"))
+
+	list := types.GraphList{}
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&list))
+	assert.Equal(t, []types.GraphStatus{{Name: "mygraph", Phase: "ready"}}, list.Graphs)
+}
+
+func TestGetGraph(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+
+	response := get(t, server.URL+"/graphs/mygraph", map[string]string{"Accept": "application/xml"})
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, types.ContentTypeXML, response.Header.Get("Content-Type"))
+
+	response = get(t, server.URL+"/graphs/other", nil)
+	response.Body.Close()
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+}
+
+func TestInfrastructureInfoNegotiation(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+	url := server.URL + "/graphs/mygraph/infrastructure-info"
+
+	response := get(t, url, map[string]string{"Accept": "text/html;q=0.9, application/yaml;q=0.5, application/json;q=0.1"})
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, types.ContentTypeYAML, response.Header.Get("Content-Type"))
+
+	response = get(t, url, map[string]string{"Accept": "text/html"})
+	response.Body.Close()
+	assert.Equal(t, http.StatusNotAcceptable, response.StatusCode)
+
+	response = get(t, url, map[string]string{"Accept": "application/json"})
+	defer response.Body.Close()
+	info := types.InfrastructureInfo{}
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&info))
+	assert.Equal(t, "apache-1", info.Spec.Services[0].Instances[0].UID)
+	assert.Equal(t, types.KIND, info.Kind)
+	assert.Equal(t, "mygraph", info.Metadata.Name)
+}
+
+func TestInfrastructureInfoJSON(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+
+	response := get(t, server.URL+"/graphs/mygraph/infrastructure-info", map[string]string{"Accept": "application/json"})
+	defer response.Body.Close()
+
+	//	Each field has its own name on the wire
+	fields := map[string]json.RawMessage{}
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&fields))
+	assert.Len(t, fields, 3)
+	assert.Equal(t, `"`+types.KIND+`"`, string(fields["kind"]))
+	metadata := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(fields["metadata"], &metadata))
+	assert.Equal(t, "mygraph", metadata["name"])
+	assert.Contains(t, fields, "spec")
+}
+
+func TestInfrastructureInfoETag(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+	url := server.URL + "/graphs/mygraph/infrastructure-info"
+
+	response := get(t, url, map[string]string{"Accept": "application/json"})
+	response.Body.Close()
+	etag := response.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	response = get(t, url, map[string]string{"Accept": "application/json", "If-None-Match": etag})
+	response.Body.Close()
+	assert.Equal(t, http.StatusNotModified, response.StatusCode)
+
+	//	Another format is another representation
+	response = get(t, url, map[string]string{"Accept": "application/xml", "If-None-Match": etag})
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.NotEqual(t, etag, response.Header.Get("ETag"))
+}
+
+func TestUnauthorized(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/graphs")
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+}
+
+func TestQuarantine(t *testing.T) {
+	manager := newTestManager()
+	server := testServerWith(manager)
+	defer server.Close()
+	url := server.URL + "/graphs/mygraph/instances/apache-1/"
+
+	//	Nothing is done without the token
+	response, err := http.Post(url+"quarantine", "application/json", nil)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	assert.Empty(t, manager.quarantined)
+
+	assert.Equal(t, http.StatusNoContent, do(t, http.MethodPost, url+"quarantine"))
+	assert.True(t, manager.quarantined["apache-1"])
+	assert.Equal(t, http.StatusConflict, do(t, http.MethodPost, url+"quarantine"))
+
+	assert.Equal(t, http.StatusNoContent, do(t, http.MethodPost, url+"release"))
+	assert.Empty(t, manager.quarantined)
+	assert.Equal(t, http.StatusConflict, do(t, http.MethodPost, url+"release"))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, do(t, http.MethodGet, url+"quarantine"))
+}
+
+func TestNotFound(t *testing.T) {
+	server := testServer()
+	defer server.Close()
+
+	assert.Equal(t, http.StatusNotFound, do(t, http.MethodPost, server.URL+"/graphs/mygraph/instances/apache-2/quarantine"))
+	assert.Equal(t, http.StatusNotFound, do(t, http.MethodPost, server.URL+"/graphs/mygraph/instances/apache-2/release"))
+	assert.Equal(t, http.StatusNotFound, do(t, http.MethodPost, server.URL+"/graphs/other/instances/apache-1/quarantine"))
+	assert.Equal(t, http.StatusNotFound, do(t, http.MethodDelete, server.URL+"/subscriptions/siem"))
+}
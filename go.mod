@@ -3,11 +3,18 @@ module github.com/SunSince90/ASTRID-kube
 go 1.13
 
 require (
+	github.com/evanphx/json-patch v4.2.0+incompatible
+	github.com/golang/protobuf v1.3.2
 	github.com/kardianos/osext v0.0.0-20190222173326-2bc1f35cddc0
 	github.com/polycube-network/polycube/src/components/k8s v0.0.0-20191108121813-09aa4164f116
+	github.com/prometheus/client_golang v1.2.1
 	github.com/sirupsen/logrus v1.4.2
+	github.com/stretchr/testify v1.3.0
+	golang.org/x/time v0.0.0-20190308202827-9d24e82272b4
+	google.golang.org/grpc v1.25.1
 	gopkg.in/yaml.v2 v2.2.5
 	k8s.io/api v0.0.0-20190620084959-7cf5895f2711
 	k8s.io/apimachinery v0.0.0-20190612205821-1799e75a0719
 	k8s.io/client-go v0.0.0-20190620085101-78d2af792bab
+	sigs.k8s.io/yaml v1.1.0
 )
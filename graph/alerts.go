@@ -0,0 +1,155 @@
+package graph
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/SunSince90/ASTRID-kube/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	alertThresholdsAnnotation = "astrid.io/alert-thresholds"
+)
+
+// alertWatcher compares the rates of packets matching the rules of firewalls with the thresholds set by the user
+type alertWatcher struct {
+	lock sync.Mutex
+	//	thresholds for all services in the graph
+	graphThresholds []types.AlertThreshold
+	//	thresholds for a specific service, which are checked along with the graph ones
+	serviceThresholds map[string][]types.AlertThreshold
+	//	the last counters read, by pod and then by chain and rule
+	samples map[string]map[ruleKey]ruleSample
+	//	rules that are currently above one of the thresholds, so alerts are sent only when crossing them
+	alerting map[string]map[ruleKey]bool
+}
+
+type ruleKey struct {
+	chain string
+	id    int32
+}
+
+type ruleSample struct {
+	packets uint64
+	time    time.Time
+}
+
+func newAlertWatcher() *alertWatcher {
+	return &alertWatcher{
+		graphThresholds:   []types.AlertThreshold{},
+		serviceThresholds: map[string][]types.AlertThreshold{},
+		samples:           map[string]map[ruleKey]ruleSample{},
+		alerting:          map[string]map[ruleKey]bool{},
+	}
+}
+
+// parseAlertThresholds gets the thresholds from the annotations of a namespace or a deployment
+func parseAlertThresholds(annotations map[string]string) []types.AlertThreshold {
+	thresholds := []types.AlertThreshold{}
+
+	value, exists := annotations[alertThresholdsAnnotation]
+	if !exists {
+		return thresholds
+	}
+
+	if err := json.Unmarshal([]byte(value), &thresholds); err != nil {
+		log.Errorln("Could not parse alert thresholds:", err)
+		return []types.AlertThreshold{}
+	}
+
+	for i := range thresholds {
+		if len(thresholds[i].Action) < 1 {
+			thresholds[i].Action = "drop"
+		}
+	}
+	return thresholds
+}
+
+func (a *alertWatcher) setGraphThresholds(thresholds []types.AlertThreshold) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.graphThresholds = thresholds
+}
+
+func (a *alertWatcher) setServiceThresholds(service string, thresholds []types.AlertThreshold) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.serviceThresholds[service] = thresholds
+}
+
+// forget stops keeping counters of a pod
+func (a *alertWatcher) forget(pod string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	delete(a.samples, pod)
+	delete(a.alerting, pod)
+}
+
+// check compares the counters of a chain with the previous ones
+// and returns the details of all rules that just crossed a threshold.
+func (a *alertWatcher) check(pod, service, chain string, stats []utils.ChainStats, now time.Time) []types.InfrastructureEventFirewall {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	thresholds := append(append([]types.AlertThreshold{}, a.graphThresholds...), a.serviceThresholds[service]...)
+	if len(thresholds) == 0 {
+		return nil
+	}
+
+	if _, exists := a.samples[pod]; !exists {
+		a.samples[pod] = map[ruleKey]ruleSample{}
+		a.alerting[pod] = map[ruleKey]bool{}
+	}
+
+	alerts := []types.InfrastructureEventFirewall{}
+	for _, rule := range stats {
+		key := ruleKey{chain: chain, id: rule.Id}
+		previous, exists := a.samples[pod][key]
+		a.samples[pod][key] = ruleSample{packets: rule.Pkts, time: now}
+
+		//	Counters were reset or this is the first reading: nothing to compare with
+		if !exists || rule.Pkts < previous.packets || !now.After(previous.time) {
+			continue
+		}
+
+		action := strings.ToLower(rule.Action)
+		if len(action) < 1 {
+			action = "drop"
+		}
+		rate := float64(rule.Pkts-previous.packets) / now.Sub(previous.time).Seconds()
+
+		crossed, limit := false, 0.0
+		for _, threshold := range thresholds {
+			if threshold.Chain == chain && strings.ToLower(threshold.Action) == action && rate > threshold.PacketsPerSecond {
+				crossed, limit = true, threshold.PacketsPerSecond
+				break
+			}
+		}
+
+		wasAlerting := a.alerting[pod][key]
+		a.alerting[pod][key] = crossed
+		if !crossed || wasAlerting {
+			continue
+		}
+
+		id := rule.Id
+		alerts = append(alerts, types.InfrastructureEventFirewall{
+			Chain:     chain,
+			Rule:      &id,
+			Action:    action,
+			Packets:   rule.Pkts,
+			Bytes:     rule.Bytes,
+			Rate:      rate,
+			Threshold: limit,
+		})
+	}
+
+	return alerts
+}
@@ -0,0 +1,36 @@
+package graph
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/SunSince90/ASTRID-kube/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlertThresholds(t *testing.T) {
+	a := newAlertWatcher()
+	a.setServiceThresholds("apache", []types.AlertThreshold{{Chain: "ingress", Action: "drop", PacketsPerSecond: 10}})
+
+	now := time.Now()
+	read := func(packets uint64, after time.Duration) []types.InfrastructureEventFirewall {
+		return a.check("apache-1", "apache", "ingress", []utils.ChainStats{{Id: 1, Pkts: packets, Action: "DROP"}}, now.Add(after))
+	}
+
+	assert.Empty(t, read(0, 0))
+	assert.Empty(t, read(50, 10*time.Second))
+
+	alerts := read(250, 20*time.Second)
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, int32(1), *alerts[0].Rule)
+	assert.Equal(t, 20.0, alerts[0].Rate)
+
+	//	Still above the threshold: no new alerts until it goes below it
+	assert.Empty(t, read(500, 30*time.Second))
+	assert.Empty(t, read(510, 40*time.Second))
+	assert.Len(t, read(1000, 50*time.Second), 1)
+
+	//	Other services are not affected
+	assert.Empty(t, a.check("nodejs-1", "nodejs", "ingress", []utils.ChainStats{{Id: 1, Pkts: 1000000}}, now))
+}
@@ -0,0 +1,226 @@
+package graph
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/settings"
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/SunSince90/ASTRID-kube/utils"
+)
+
+const (
+	maxCaptureDuration      = 10 * time.Minute
+	defaultCaptureMaxSize   = 32
+	defaultCaptureRetention = time.Hour
+)
+
+var (
+	// ErrCaptureNotFound is returned when the requested capture does not exist
+	ErrCaptureNotFound = errors.New("Capture does not exist")
+	//	errCaptureFull stops a capture that reached the maximum size
+	errCaptureFull = errors.New("Capture reached its maximum size")
+)
+
+// captureStore keeps all packet captures, running or finished
+type captureStore struct {
+	lock     sync.Mutex
+	sessions map[string]*captureSession
+}
+
+type captureSession struct {
+	info types.CaptureSession
+	data cappedBuffer
+	stop chan struct{}
+	//	finished is true when nothing is writing data anymore
+	finished bool
+	//	ended is when it finished, to remove it once it has been kept long enough
+	ended time.Time
+}
+
+// cappedBuffer keeps data up to a maximum size.
+// Data that does not fit is refused as a whole, so that packets are never cut.
+type cappedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.max {
+		return 0, errCaptureFull
+	}
+	return b.Buffer.Write(p)
+}
+
+var captures = &captureStore{
+	sessions: map[string]*captureSession{},
+}
+
+// captureMaxSize is how many bytes a capture can take
+func captureMaxSize() int {
+	if settings.Settings.Captures.MaxSize > 0 {
+		return settings.Settings.Captures.MaxSize * 1024 * 1024
+	}
+	return defaultCaptureMaxSize * 1024 * 1024
+}
+
+// captureRetention is how long a capture is kept once it is not running anymore
+func captureRetention() time.Duration {
+	if settings.Settings.Captures.Retention > 0 {
+		return time.Duration(settings.Settings.Captures.Retention) * time.Minute
+	}
+	return defaultCaptureRetention
+}
+
+// Capture starts capturing the traffic of an instance for the provided time.
+// The capture runs in background: its status can be checked with the returned id.
+func (handler *InfrastructureHandler) Capture(uid string, filter types.CaptureFilter, duration time.Duration) (types.CaptureSession, error) {
+	if duration <= 0 || duration > maxCaptureDuration {
+		return types.CaptureSession{}, errors.New("Duration must be positive and at most " + maxCaptureDuration.String())
+	}
+
+	instance, exists := handler.reconciler.tracked()[uid]
+	if !exists {
+		return types.CaptureSession{}, ErrInstanceNotFound
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return types.CaptureSession{}, err
+	}
+
+	session := &captureSession{
+		info: types.CaptureSession{
+			ID:       hex.EncodeToString(id),
+			Graph:    handler.name,
+			Pod:      uid,
+			Filter:   filter,
+			Duration: int64(duration / time.Second),
+			Started:  time.Now().UTC(),
+			Status:   types.CaptureRunning,
+		},
+		data: cappedBuffer{max: captureMaxSize()},
+		stop: make(chan struct{}),
+	}
+
+	captures.lock.Lock()
+	captures.prune(time.Now())
+	captures.sessions[session.info.ID] = session
+	captures.lock.Unlock()
+
+	handler.log.Infof("Capturing traffic of %s for %s", uid, duration)
+	go func() {
+		//	Data is only read once the capture is not running anymore, so it can be written without holding the lock
+		count, err := utils.Capture(instance.firewall, "pc-"+session.info.ID, filter, duration, session.stop, &session.data)
+
+		captures.lock.Lock()
+		defer captures.lock.Unlock()
+
+		session.finished = true
+		session.ended = time.Now()
+		session.info.Packets = count
+		switch {
+		case err == errCaptureFull:
+			handler.log.Infof("Capture of %s reached its maximum size", uid)
+			session.info.Truncated = true
+			if session.info.Status == types.CaptureRunning {
+				session.info.Status = types.CaptureCompleted
+			}
+		case err != nil:
+			handler.log.Errorf("Capture of %s failed: %s", uid, err)
+			session.info.Status = types.CaptureFailed
+			session.info.Error = err.Error()
+		case session.info.Status == types.CaptureRunning:
+			session.info.Status = types.CaptureCompleted
+		}
+	}()
+
+	return session.info, nil
+}
+
+// prune removes the captures that have been kept long enough. It must be called with the lock held.
+func (c *captureStore) prune(now time.Time) {
+	for id, session := range c.sessions {
+		if session.finished && now.Sub(session.ended) > captureRetention() {
+			delete(c.sessions, id)
+		}
+	}
+}
+
+// session returns a capture of a graph. It must be called with the lock held.
+func (c *captureStore) session(graph, id string) (*captureSession, error) {
+	c.prune(time.Now())
+
+	session, exists := c.sessions[id]
+	if !exists || session.info.Graph != graph {
+		return nil, ErrCaptureNotFound
+	}
+	return session, nil
+}
+
+// list returns all captures of a graph
+func (c *captureStore) list(graph string) []types.CaptureSession {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.prune(time.Now())
+	list := []types.CaptureSession{}
+	for _, session := range c.sessions {
+		if session.info.Graph == graph {
+			list = append(list, session.info)
+		}
+	}
+	return list
+}
+
+func (c *captureStore) get(graph, id string) (types.CaptureSession, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	session, err := c.session(graph, id)
+	if err != nil {
+		return types.CaptureSession{}, err
+	}
+	return session.info, nil
+}
+
+// pcap returns the packets captured, in the pcap format
+func (c *captureStore) pcap(graph, id string) ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	session, err := c.session(graph, id)
+	if err != nil {
+		return nil, err
+	}
+	if !session.finished {
+		return nil, errors.New("Capture is still running")
+	}
+	return session.data.Bytes(), nil
+}
+
+// cancel stops a running capture, or removes a finished one
+func (c *captureStore) cancel(graph, id string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	session, err := c.session(graph, id)
+	if err != nil {
+		return err
+	}
+
+	if !session.finished {
+		if session.info.Status == types.CaptureRunning {
+			session.info.Status = types.CaptureCancelled
+			close(session.stop)
+		}
+		return nil
+	}
+
+	delete(c.sessions, id)
+	return nil
+}
@@ -0,0 +1,67 @@
+package graph
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCappedBuffer(t *testing.T) {
+	buffer := cappedBuffer{max: 8}
+
+	n, err := buffer.Write([]byte("12345"))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	//	A packet that does not fit is not cut
+	_, err = buffer.Write([]byte("6789"))
+	assert.Equal(t, errCaptureFull, err)
+	assert.Equal(t, "12345", buffer.String())
+
+	_, err = buffer.Write([]byte("678"))
+	assert.NoError(t, err)
+	assert.Equal(t, "12345678", buffer.String())
+}
+
+func TestCaptureStore(t *testing.T) {
+	store := &captureStore{sessions: map[string]*captureSession{}}
+	now := time.Now()
+
+	running := &captureSession{info: types.CaptureSession{ID: "running", Graph: "mygraph", Status: types.CaptureRunning}, stop: make(chan struct{})}
+	finished := &captureSession{info: types.CaptureSession{ID: "finished", Graph: "mygraph", Status: types.CaptureCompleted}, finished: true, ended: now}
+	old := &captureSession{info: types.CaptureSession{ID: "old", Graph: "mygraph", Status: types.CaptureCompleted}, finished: true, ended: now.Add(-2 * defaultCaptureRetention)}
+	other := &captureSession{info: types.CaptureSession{ID: "other", Graph: "othergraph", Status: types.CaptureCompleted}, finished: true, ended: now}
+	for _, session := range []*captureSession{running, finished, old, other} {
+		store.sessions[session.info.ID] = session
+	}
+	finished.data.WriteString("pcap")
+
+	//	Captures that have been kept long enough are removed
+	assert.Len(t, store.list("mygraph"), 2)
+	_, err := store.get("mygraph", "old")
+	assert.Equal(t, ErrCaptureNotFound, err)
+
+	//	Captures of other graphs cannot be seen
+	_, err = store.get("mygraph", "other")
+	assert.Equal(t, ErrCaptureNotFound, err)
+	_, err = store.pcap("mygraph", "other")
+	assert.Equal(t, ErrCaptureNotFound, err)
+	assert.Equal(t, ErrCaptureNotFound, store.cancel("mygraph", "other"))
+	assert.Len(t, store.list("othergraph"), 1)
+
+	data, err := store.pcap("mygraph", "finished")
+	assert.NoError(t, err)
+	assert.Equal(t, "pcap", string(data))
+	_, err = store.pcap("mygraph", "running")
+	assert.Error(t, err)
+
+	assert.NoError(t, store.cancel("mygraph", "running"))
+	info, err := store.get("mygraph", "running")
+	assert.NoError(t, err)
+	assert.Equal(t, types.CaptureCancelled, info.Status)
+
+	assert.NoError(t, store.cancel("mygraph", "finished"))
+	assert.Len(t, store.list("mygraph"), 1)
+}
@@ -0,0 +1,179 @@
+package graph
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const countersFile = "sequences.json"
+
+// counterStore keeps the last sequences and revisions that were given out, so that they keep growing
+// after a restart. It is saved next to the outbox, along with it. There are three counters:
+//   - the sequence of the event log, which numbers the events of all graphs in the records of the api and grpc
+//   - the sequence of each graph, which numbers all its events, along with the revision of its infrastructure info
+//   - the delivery of each subscription in each graph, which only numbers the events sent to it
+type counterStore struct {
+	lock  sync.Mutex
+	path  string
+	dirty bool
+	state counterState
+}
+
+type counterState struct {
+	Events uint64                   `json:"events"`
+	Graphs map[string]graphCounters `json:"graphs"`
+	//	Deliveries are by graph, then by subscription
+	Deliveries map[string]map[string]uint64 `json:"deliveries"`
+}
+
+type graphCounters struct {
+	Sequence uint64 `json:"sequence"`
+	Revision uint64 `json:"revision"`
+}
+
+var counters = newCounterStore()
+
+func newCounterStore() *counterStore {
+	return &counterStore{
+		state: counterState{
+			Graphs:     map[string]graphCounters{},
+			Deliveries: map[string]map[string]uint64{},
+		},
+	}
+}
+
+// load reads the counters saved in the provided folder
+func (c *counterStore) load(folder string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.path = filepath.Join(folder, countersFile)
+	data, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorln("Could not read sequences:", err)
+		}
+		return
+	}
+
+	loaded := counterState{}
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		log.Errorln("Could not parse sequences:", err)
+		return
+	}
+	c.state.Events = loaded.Events
+	for graph, sequences := range loaded.Graphs {
+		c.state.Graphs[graph] = sequences
+	}
+	for graph, subscriptions := range loaded.Deliveries {
+		c.state.Deliveries[graph] = subscriptions
+	}
+}
+
+// save writes the counters on disk, if they changed since the last time
+func (c *counterStore) save() {
+	c.lock.Lock()
+	if !c.dirty || len(c.path) < 1 {
+		c.lock.Unlock()
+		return
+	}
+	c.dirty = false
+	path := c.path
+	data, err := json.Marshal(c.state)
+	c.lock.Unlock()
+
+	if err != nil {
+		log.Errorln("Could not marshal sequences:", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		log.Errorln("Could not save sequences:", err)
+		return
+	}
+
+	//	Write it in another file first, so a crash never leaves it half written
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		log.Errorln("Could not save sequences:", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		log.Errorln("Could not save sequences:", err)
+	}
+}
+
+// events returns the last sequence of the event log
+func (c *counterStore) events() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.state.Events
+}
+
+// setEvents records the last sequence of the event log
+func (c *counterStore) setEvents(sequence uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.state.Events = sequence
+	c.dirty = true
+}
+
+// graph returns the last sequence and revision of a graph
+func (c *counterStore) graph(graph string) graphCounters {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.state.Graphs[graph]
+}
+
+// setGraph records the last sequence and revision of a graph
+func (c *counterStore) setGraph(graph string, sequence, revision uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.state.Graphs[graph] = graphCounters{Sequence: sequence, Revision: revision}
+	c.dirty = true
+}
+
+// delivery returns the delivery of the last event of a graph sent to a subscription
+func (c *counterStore) delivery(graph, sinkID string) uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.state.Deliveries[graph][sinkID]
+}
+
+// next returns the delivery of the next event of a graph sent to a subscription
+func (c *counterStore) next(graph, sinkID string) uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, exists := c.state.Deliveries[graph]; !exists {
+		c.state.Deliveries[graph] = map[string]uint64{}
+	}
+	c.state.Deliveries[graph][sinkID]++
+	c.dirty = true
+	return c.state.Deliveries[graph][sinkID]
+}
+
+// forgetSink drops the deliveries of a subscription, in all graphs
+func (c *counterStore) forgetSink(sinkID string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for graph, subscriptions := range c.state.Deliveries {
+		if _, exists := subscriptions[sinkID]; exists {
+			delete(subscriptions, sinkID)
+			c.dirty = true
+		}
+		if len(subscriptions) == 0 {
+			delete(c.state.Deliveries, graph)
+		}
+	}
+}
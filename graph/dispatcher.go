@@ -0,0 +1,89 @@
+package graph
+
+import (
+	"github.com/SunSince90/ASTRID-kube/settings"
+	"github.com/SunSince90/ASTRID-kube/types"
+)
+
+// dispatch wakes up the dispatcher of a graph, starting it if it is not running yet.
+// Each graph has its own, which delivers the data of each subscription on its own:
+// a slow endpoint only holds back the data being sent to it, and nobody generating data ever waits for it.
+func (o *outbox) dispatch(graph string) {
+	o.lock.Lock()
+	wake, exists := o.dispatchers[graph]
+	if !exists {
+		wake = make(chan struct{}, 1)
+		o.dispatchers[graph] = wake
+		go o.run(graph, wake, o.stop)
+	}
+	o.lock.Unlock()
+
+	//	If it is already awake, it is going to see this data too
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers the data of a graph every time it is woken up, until stopped.
+// Subscriptions already being delivered to keep going on their own, and see the new data as well.
+func (o *outbox) run(graph string, wake chan struct{}, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-wake:
+		}
+
+		o.lock.Lock()
+		keys := []outboxKey{}
+		stale := map[outboxKey]bool{}
+		for key := range o.queues {
+			if key.graph == graph {
+				keys = append(keys, key)
+			}
+		}
+		for key := range o.stale {
+			if key.graph != graph {
+				continue
+			}
+			stale[key] = true
+			if _, exists := o.queues[key]; !exists {
+				keys = append(keys, key)
+			}
+		}
+		o.lock.Unlock()
+
+		for _, key := range keys {
+			go o.deliver(key, stale[key])
+		}
+	}
+}
+
+// full checks if as many events as allowed are waiting for a subscription
+func (o *outbox) full(graph, sinkID string) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	return len(o.queues[outboxKey{graph: graph, sink: sinkID}]) >= o.maxPending()
+}
+
+// overflow is what to do when too many events are waiting
+func overflow() types.OverflowPolicy {
+	if settings.Settings.Outbox.Overflow == types.DropOldest {
+		return types.DropOldest
+	}
+	return types.Coalesce
+}
+
+// deliver sends the infrastructure info again to a subscription that needs it, and then delivers its data.
+// What is left is then saved on disk.
+func (o *outbox) deliver(key outboxKey, stale bool) {
+	if stale {
+		if builder := subscriptions.builder(key.graph); builder != nil {
+			builder.resync(key.sink)
+		}
+	}
+	o.flush(key.graph, key.sink)
+	o.save()
+}
@@ -0,0 +1,137 @@
+package graph
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/SunSince90/ASTRID-kube/settings"
+	"github.com/SunSince90/ASTRID-kube/types"
+)
+
+const (
+	defaultEventLogSize = 1000
+	//	watcherBuffer is how many events a watcher can be behind before it is dropped
+	watcherBuffer = 100
+)
+
+var (
+	// ErrEventsExpired is returned when the events after a sequence are not in the log anymore
+	ErrEventsExpired = errors.New("Events after the provided sequence are not available anymore")
+)
+
+// eventLog keeps the most recent infrastructure events of all graphs and passes new ones to watchers
+type eventLog struct {
+	lock     sync.Mutex
+	records  []types.EventRecord
+	sequence uint64
+	watchers map[*eventWatcher]bool
+}
+
+type eventWatcher struct {
+	graph  string
+	events chan types.EventRecord
+}
+
+var events = &eventLog{
+	records:  []types.EventRecord{},
+	watchers: map[*eventWatcher]bool{},
+}
+
+// record adds an event to the log and passes it to the watchers interested in its graph
+func (l *eventLog) record(event types.InfrastructureEvent) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.sequence++
+	counters.setEvents(l.sequence)
+	record := types.EventRecord{Sequence: l.sequence, Event: event}
+
+	size := settings.Settings.Events.LogSize
+	if size < 1 {
+		size = defaultEventLogSize
+	}
+	l.records = append(l.records, record)
+	if len(l.records) > size {
+		l.records = append([]types.EventRecord{}, l.records[len(l.records)-size:]...)
+	}
+
+	for watcher := range l.watchers {
+		if len(watcher.graph) > 0 && watcher.graph != event.GraphName {
+			continue
+		}
+
+		//	A watcher that cannot keep up is dropped: it can resume from the last event it got
+		select {
+		case watcher.events <- record:
+		default:
+			delete(l.watchers, watcher)
+			close(watcher.events)
+		}
+	}
+}
+
+// since returns the events of a graph after the provided sequence, or of all graphs if graph is empty
+func (l *eventLog) since(graph string, sequence uint64) ([]types.EventRecord, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.after(graph, sequence)
+}
+
+// after is since without the lock
+func (l *eventLog) after(graph string, sequence uint64) ([]types.EventRecord, error) {
+	records := []types.EventRecord{}
+	if sequence >= l.sequence {
+		return records, nil
+	}
+	if len(l.records) == 0 || l.records[0].Sequence > sequence+1 {
+		return nil, ErrEventsExpired
+	}
+
+	for _, record := range l.records {
+		if record.Sequence > sequence && (len(graph) == 0 || record.Event.GraphName == graph) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// resume makes the log go on from the provided sequence, which was the last one before a restart
+func (l *eventLog) resume(sequence uint64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if sequence > l.sequence {
+		l.sequence = sequence
+	}
+}
+
+// watch returns the events of a graph after the provided sequence, and a channel with the ones that come next.
+// With a nil sequence, only the next ones are returned. The channel is closed when stop is called,
+// or when the watcher is too slow.
+func (l *eventLog) watch(graph string, sequence *uint64) ([]types.EventRecord, <-chan types.EventRecord, func(), error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	records := []types.EventRecord{}
+	if sequence != nil {
+		var err error
+		if records, err = l.after(graph, *sequence); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	watcher := &eventWatcher{graph: graph, events: make(chan types.EventRecord, watcherBuffer)}
+	l.watchers[watcher] = true
+
+	stop := func() {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+
+		if l.watchers[watcher] {
+			delete(l.watchers, watcher)
+			close(watcher.events)
+		}
+	}
+	return records, watcher.events, stop, nil
+}
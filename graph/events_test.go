@@ -0,0 +1,89 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/SunSince90/ASTRID-kube/settings"
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testEvent(graph, uid string) types.InfrastructureEvent {
+	return types.InfrastructureEvent{
+		GraphName: graph,
+		Type:      types.New,
+		EventData: types.InfrastructureEventResource{ResourceType: types.Pod, Uid: uid},
+	}
+}
+
+func sequences(records []types.EventRecord) []uint64 {
+	list := []uint64{}
+	for _, record := range records {
+		list = append(list, record.Sequence)
+	}
+	return list
+}
+
+func TestEventLogSince(t *testing.T) {
+	defer func(size int) { settings.Settings.Events.LogSize = size }(settings.Settings.Events.LogSize)
+	settings.Settings.Events.LogSize = 3
+	log := &eventLog{records: []types.EventRecord{}, watchers: map[*eventWatcher]bool{}}
+
+	records, err := log.since("", 0)
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+
+	log.record(testEvent("web", "apache-1"))
+	log.record(testEvent("database", "mysql-1"))
+	log.record(testEvent("web", "apache-2"))
+
+	records, err = log.since("", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1, 2, 3}, sequences(records))
+
+	records, err = log.since("web", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{3}, sequences(records))
+
+	//	The first one is forgotten
+	log.record(testEvent("web", "apache-3"))
+	_, err = log.since("", 0)
+	assert.Equal(t, ErrEventsExpired, err)
+
+	records, err = log.since("", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{2, 3, 4}, sequences(records))
+
+	records, err = log.since("", 4)
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestEventLogWatch(t *testing.T) {
+	log := &eventLog{records: []types.EventRecord{}, watchers: map[*eventWatcher]bool{}}
+	log.record(testEvent("web", "apache-1"))
+
+	since := uint64(0)
+	records, next, stop, err := log.watch("web", &since)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1}, sequences(records))
+
+	log.record(testEvent("database", "mysql-1"))
+	log.record(testEvent("web", "apache-2"))
+	assert.Equal(t, uint64(3), (<-next).Sequence)
+
+	stop()
+	_, open := <-next
+	assert.False(t, open)
+
+	//	Watchers that do not read are dropped
+	_, next, stop, err = log.watch("", nil)
+	assert.NoError(t, err)
+	defer stop()
+	for i := 0; i <= watcherBuffer; i++ {
+		log.record(testEvent("web", "apache-3"))
+	}
+	for range next {
+	}
+	assert.Empty(t, log.watchers)
+}
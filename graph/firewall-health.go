@@ -0,0 +1,89 @@
+package graph
+
+import (
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/settings"
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/SunSince90/ASTRID-kube/utils"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+const (
+	polycubeContainer = "polycubed"
+)
+
+// checkFirewalls periodically verifies that all firewalls in the graph are still in place, if enabled in settings
+func (handler *InfrastructureHandler) checkFirewalls() {
+	if settings.Settings.FwHealthTimer < 1 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Second * settings.Settings.FwHealthTimer)
+		defer ticker.Stop()
+		for range ticker.C {
+			for pod := range handler.reconciler.tracked() {
+				handler.provisioning.heal(pod, 0)
+			}
+		}
+	}()
+}
+
+// healFirewall provisions again the firewall of a pod if it is missing or detached.
+// It is called by the provisioning queue, and it returns false if it should be tried again.
+func (handler *InfrastructureHandler) healFirewall(pod string) bool {
+	instance, exists := handler.reconciler.tracked()[pod]
+	if !exists {
+		return true
+	}
+
+	healthy, err := utils.FirewallHealthy(instance.firewall)
+	if err != nil {
+		handler.log.Errorf("Could not check the firewall of %s: %s", pod, err)
+		return false
+	}
+	if healthy {
+		return true
+	}
+
+	handler.log.Infoln("Firewall of", pod, "is missing or detached, provisioning it again")
+	provisioned := false
+	err = handler.reconciler.change(pod, func() error {
+		if !utils.ProvisionFirewall(instance.firewall, instance.quarantined) {
+			return nil
+		}
+		provisioned = true
+
+		//	Put back the declared rules as well
+		return handler.reconciler.apply(pod, false)
+	})
+	if err == ErrInstanceNotFound {
+		return true
+	}
+	if !provisioned {
+		handler.log.Errorln("Could not restore the firewall of", pod)
+		return false
+	}
+	if err != nil {
+		handler.log.Errorf("Could not restore the rules in the firewall of %s: %s", pod, err)
+	}
+
+	handler.log.Infoln("Restored firewall of", pod)
+	handler.pushInstanceEvent(pod, types.Restored)
+	return true
+}
+
+// polycubeRestarted checks if the polycube sidecar restarted between two versions of a pod
+func polycubeRestarted(old, current *core_v1.Pod) bool {
+	restarts := func(pod *core_v1.Pod) int32 {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name == polycubeContainer {
+				return status.RestartCount
+			}
+		}
+		return 0
+	}
+
+	return restarts(current) > restarts(old)
+}
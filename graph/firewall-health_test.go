@@ -0,0 +1,67 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/SunSince90/ASTRID-kube/utils"
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+func TestPolycubeRestarted(t *testing.T) {
+	pod := func(restarts int32) *core_v1.Pod {
+		return &core_v1.Pod{Status: core_v1.PodStatus{ContainerStatuses: []core_v1.ContainerStatus{
+			{Name: "apache", RestartCount: 5},
+			{Name: polycubeContainer, RestartCount: restarts},
+		}}}
+	}
+
+	assert.True(t, polycubeRestarted(pod(0), pod(1)))
+	assert.False(t, polycubeRestarted(pod(1), pod(1)))
+	assert.False(t, polycubeRestarted(&core_v1.Pod{}, &core_v1.Pod{}))
+}
+
+func TestHealFirewall(t *testing.T) {
+	polycube, fw, restore := testPolycube(t)
+	defer restore()
+
+	recorder := &eventRecorder{}
+	handler := &InfrastructureHandler{name: "heal", log: log.WithField("GRAPH", "heal"), infoBuilder: recorder}
+	handler.reconciler = newFirewallReconciler("heal", handler.log, recorder)
+	handler.provisioning = testProvisioningQueue(handler.setupFirewall)
+	handler.provisioning.restore = handler.healFirewall
+
+	drop := k8sfirewall.ChainRule{Action: "drop", Src: "10.0.0.5"}
+	assert.True(t, utils.ProvisionFirewall(fw, false))
+	handler.reconciler.track("apache-1", "apache", fw)
+	assert.NoError(t, handler.reconciler.setRules(ruleSourceAPI, "apache-1", "ingress", []k8sfirewall.ChainRule{drop}))
+
+	//	A healthy firewall is left alone
+	handler.provisioning.heal("apache-1", 0)
+	calls := len(polycube.Calls())
+	assert.True(t, handler.provisioning.processNext())
+	assert.Equal(t, []string{"GET firewall/fw/"}, polycube.Calls()[calls:])
+	assert.Empty(t, recorder.events)
+
+	//	After a restart, polycube is not listening yet: the check is tried again
+	polycube.Restart()
+	polycube.Fail("GET", "firewall/fw/", 503)
+	handler.provisioning.heal("apache-1", 0)
+	assert.True(t, handler.provisioning.processNext())
+	assert.Nil(t, polycube.Firewall("fw"))
+	assert.Equal(t, 1, handler.provisioning.queue.NumRequeues("apache-1"))
+
+	polycube.Fail("GET", "firewall/fw/", 0)
+	assert.True(t, handler.provisioning.processNext())
+	healthy, err := utils.FirewallHealthy(fw)
+	assert.NoError(t, err)
+	assert.True(t, healthy)
+	assert.Equal(t, []k8sfirewall.ChainRule{utils.ManagementRule(fw, "ingress"), drop}, withoutIds(polycube.Rules("fw", "ingress")))
+	if assert.Len(t, recorder.events, 1) {
+		assert.Equal(t, types.Restored, recorder.events[0].Type)
+	}
+	assert.Empty(t, handler.provisioning.pending)
+}
@@ -0,0 +1,489 @@
+package graph
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/metrics"
+	"github.com/SunSince90/ASTRID-kube/settings"
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/SunSince90/ASTRID-kube/utils"
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
+	log "github.com/sirupsen/logrus"
+)
+
+// firewallReconciler keeps the rules enforced in the firewalls of a graph equal to the declared ones
+type firewallReconciler struct {
+	lock        sync.Mutex
+	graph       string
+	log         *log.Entry
+	infoBuilder InfrastructureInfo
+	instances   map[string]*desiredFirewall
+}
+
+const (
+	//	Sources of the rules declared to the reconciler
+	ruleSourceAPI           = "api"
+	ruleSourcePolicy        = "policy"
+	ruleSourceNetworkPolicy = "networkpolicy"
+)
+
+// desiredFirewall is what the firewall of a single instance should look like
+type desiredFirewall struct {
+	ip      string
+	service string
+	//	firewall is where the firewall of the instance is, and how it is managed
+	firewall utils.Firewall
+	//	rules declared by each source, for each direction: directions with no entry are not reconciled
+	rules map[string]map[string][]k8sfirewall.ChainRule
+	//	a quarantined instance only accepts traffic to polycube
+	quarantined bool
+	//	rules found in directions with no declared rules when the instance was quarantined
+	beforeQuarantine map[string][]k8sfirewall.ChainRule
+	//	whether the firewall accepted established connections before the instance was quarantined
+	acceptedEstablished bool
+	//	changes serializes the changes to the firewall, from reading its rules to applying the new ones
+	changes *sync.Mutex
+}
+
+// declared returns the rules declared by all sources, for each direction
+func (d *desiredFirewall) declared() map[string][]k8sfirewall.ChainRule {
+	sources := []string{}
+	for source := range d.rules {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	declared := map[string][]k8sfirewall.ChainRule{}
+	for _, source := range sources {
+		for direction, rules := range d.rules[source] {
+			declared[direction] = append(declared[direction], rules...)
+		}
+	}
+	return declared
+}
+
+// chains returns the full list of rules that each direction must have
+func (d *desiredFirewall) chains() map[string][]k8sfirewall.ChainRule {
+	desired := map[string][]k8sfirewall.ChainRule{}
+
+	if d.quarantined {
+		for _, direction := range utils.Directions {
+			desired[direction] = append(utils.ManagementRules(d.firewall, direction), utils.DropAllRule())
+		}
+		return desired
+	}
+
+	for direction, rules := range d.declared() {
+		desired[direction] = append(utils.ManagementRules(d.firewall, direction), rules...)
+	}
+	return desired
+}
+
+func newFirewallReconciler(graph string, l *log.Entry, infoBuilder InfrastructureInfo) *firewallReconciler {
+	return &firewallReconciler{
+		graph:       graph,
+		log:         l,
+		infoBuilder: infoBuilder,
+		instances:   map[string]*desiredFirewall{},
+	}
+}
+
+// start periodically reconciles all firewalls, if enabled in settings
+func (r *firewallReconciler) start() {
+	if settings.Settings.FwReconcileTimer < 1 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Second * settings.Settings.FwReconcileTimer)
+		defer ticker.Stop()
+		for range ticker.C {
+			r.reconcileAll()
+		}
+	}()
+}
+
+// track starts keeping track of the firewall of an instance.
+// An instance that was quarantined before ASTRID-kube restarted is still quarantined.
+func (r *firewallReconciler) track(pod, service string, firewall utils.Firewall) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if existing, exists := r.instances[pod]; exists {
+		existing.ip = firewall.IP()
+		existing.service = service
+		existing.firewall = firewall
+		return
+	}
+
+	instance := &desiredFirewall{
+		ip:       firewall.IP(),
+		service:  service,
+		firewall: firewall,
+		rules:    map[string]map[string][]k8sfirewall.ChainRule{},
+		changes:  &sync.Mutex{},
+	}
+	if record, quarantined := quarantines.get(r.graph, pod); quarantined {
+		instance.quarantined = true
+		instance.beforeQuarantine = record.BeforeQuarantine
+		instance.acceptedEstablished = record.AcceptedEstablished
+	}
+	r.instances[pod] = instance
+}
+
+// change runs f while no other change is made to the firewall of an instance.
+// Changes read the live rules and then apply the ones needed, so they would undo each other if they overlapped.
+func (r *firewallReconciler) change(pod string, f func() error) error {
+	changes := func() *sync.Mutex {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		instance, exists := r.instances[pod]
+		if !exists {
+			return nil
+		}
+		return instance.changes
+	}()
+	if changes == nil {
+		return ErrInstanceNotFound
+	}
+
+	changes.Lock()
+	defer changes.Unlock()
+	return f()
+}
+
+// untrack stops reconciling the firewall of an instance
+func (r *firewallReconciler) untrack(pod string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.instances, pod)
+}
+
+// setRules declares the rules that a source wants in a chain of an instance's firewall,
+// and enforces them immediately, along with the ones declared by other sources.
+// Rules needed to reach polycube are always kept, so they must not be included.
+func (r *firewallReconciler) setRules(source, pod, direction string, rules []k8sfirewall.ChainRule) error {
+	if direction != "ingress" && direction != "egress" {
+		return errors.New("Unrecognized direction")
+	}
+
+	return r.change(pod, func() error {
+		func() {
+			r.lock.Lock()
+			defer r.lock.Unlock()
+
+			instance, exists := r.instances[pod]
+			if !exists {
+				return
+			}
+			if _, exists := instance.rules[source]; !exists {
+				instance.rules[source] = map[string][]k8sfirewall.ChainRule{}
+			}
+			instance.rules[source][direction] = append([]k8sfirewall.ChainRule{}, rules...)
+		}()
+
+		return r.apply(pod, false)
+	})
+}
+
+// clearRules removes all rules declared by a source in an instance's firewall.
+// Directions that are not declared by other sources anymore are not reconciled from now on.
+func (r *firewallReconciler) clearRules(source, pod string) error {
+	err := r.change(pod, func() error {
+		fw, removed, tracked, quarantined := func() (utils.Firewall, map[string][]k8sfirewall.ChainRule, bool, bool) {
+			r.lock.Lock()
+			defer r.lock.Unlock()
+
+			instance, exists := r.instances[pod]
+			if !exists {
+				return utils.Firewall{}, nil, false, false
+			}
+			removed := instance.rules[source]
+			delete(instance.rules, source)
+
+			//	Directions still declared are fixed by reconciling them
+			for direction := range instance.declared() {
+				delete(removed, direction)
+			}
+			return instance.firewall, removed, true, instance.quarantined
+		}()
+		if !tracked {
+			return nil
+		}
+
+		if !quarantined {
+			for direction, rules := range removed {
+				for _, rule := range rules {
+					if err := utils.DeleteMatchingRule(fw, direction, rule); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		return r.apply(pod, false)
+	})
+	if err == ErrInstanceNotFound {
+		return nil
+	}
+	return err
+}
+
+// tracked returns the ip, the service, the firewall and the quarantine status of all instances with a firewall, by pod name
+func (r *firewallReconciler) tracked() map[string]desiredFirewall {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	list := map[string]desiredFirewall{}
+	for pod, instance := range r.instances {
+		list[pod] = desiredFirewall{ip: instance.ip, service: instance.service, firewall: instance.firewall, quarantined: instance.quarantined}
+	}
+	return list
+}
+
+func (r *firewallReconciler) reconcileAll() {
+	pods := func() []string {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		list := []string{}
+		for pod := range r.instances {
+			list = append(list, pod)
+		}
+		return list
+	}()
+
+	for _, pod := range pods {
+		if err := r.reconcile(pod, true); err != nil {
+			r.log.Errorf("Could not reconcile firewall of %s: %s", pod, err)
+		}
+	}
+}
+
+// reconcile compares the live rules of an instance with the declared ones
+// and applies the changes needed to make them equal.
+// Differences are reported as drift only if reportDrift is true, as they are expected when rules are declared.
+func (r *firewallReconciler) reconcile(pod string, reportDrift bool) error {
+	return r.change(pod, func() error {
+		return r.apply(pod, reportDrift)
+	})
+}
+
+// apply is reconcile for callers that are already changing the firewall of the instance
+func (r *firewallReconciler) apply(pod string, reportDrift bool) error {
+	fw, service, desired, quarantined, exists := func() (utils.Firewall, string, map[string][]k8sfirewall.ChainRule, bool, bool) {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		instance, exists := r.instances[pod]
+		if !exists {
+			return utils.Firewall{}, "", nil, false, false
+		}
+
+		return instance.firewall, instance.service, instance.chains(), instance.quarantined, true
+	}()
+	if !exists {
+		return ErrInstanceNotFound
+	}
+
+	//	Established connections must be cut as well while in quarantine
+	if quarantined && !utils.SetAcceptEstablished(fw, false) {
+		return errors.New("Could not stop accepting established connections")
+	}
+
+	//	Temporary rules go right after the management ones, so they take precedence over declared ones
+	if !quarantined {
+		for direction, rules := range temporaryRules.active(r.graph, pod) {
+			chain, declared := desired[direction]
+			if !declared {
+				if err := ensureRules(fw, direction, rules); err != nil {
+					return err
+				}
+				continue
+			}
+			management := len(utils.ManagementRules(fw, direction))
+			desired[direction] = append(append(append([]k8sfirewall.ChainRule{}, chain[:management]...), rules...), chain[management:]...)
+		}
+	}
+
+	for direction, rules := range desired {
+		live, err := utils.ListRules(fw, direction)
+		if err != nil {
+			return err
+		}
+
+		toDelete, toInsert := utils.DiffRules(live, rules)
+		if len(toDelete) == 0 && len(toInsert) == 0 {
+			continue
+		}
+
+		if err := utils.ApplyRulesDiff(fw, direction, toDelete, toInsert); err != nil {
+			return err
+		}
+		if !reportDrift {
+			continue
+		}
+
+		r.log.Infof("Firewall of %s drifted in %s: %d unexpected and %d missing rules", pod, direction, len(toDelete), len(toInsert))
+
+		metrics.FirewallDrift.WithLabelValues(r.graph, pod, direction).Inc()
+		r.infoBuilder.PushEvent(types.InfrastructureEvent{
+			GraphName: r.graph,
+			Type:      types.Drift,
+			EventData: types.InfrastructureEventResource{
+				ResourceType: types.Pod,
+				Name:         service,
+				Ip:           fw.IP(),
+				Uid:          pod,
+				Firewall: &types.InfrastructureEventFirewall{
+					Chain:      direction,
+					Missing:    len(toInsert),
+					Unexpected: len(toDelete),
+				},
+			},
+		})
+	}
+
+	return nil
+}
+
+// quarantine isolates an instance by dropping all its traffic, except the one needed to reach polycube.
+func (r *firewallReconciler) quarantine(pod string) error {
+	return r.change(pod, func() error {
+		fw, undeclared, err := func() (utils.Firewall, []string, error) {
+			r.lock.Lock()
+			defer r.lock.Unlock()
+
+			instance, exists := r.instances[pod]
+			if !exists {
+				return utils.Firewall{}, nil, ErrInstanceNotFound
+			}
+			if instance.quarantined {
+				return utils.Firewall{}, nil, errors.New("Instance is already quarantined")
+			}
+
+			undeclared := []string{}
+			declared := instance.declared()
+			for _, direction := range utils.Directions {
+				if _, declared := declared[direction]; !declared {
+					undeclared = append(undeclared, direction)
+				}
+			}
+			return instance.firewall, undeclared, nil
+		}()
+		if err != nil {
+			return err
+		}
+
+		//	Firewalls of pcn-k8s are not configured by ASTRID-kube, so it must be restored as it was
+		accepted, err := utils.AcceptsEstablished(fw)
+		if err != nil {
+			return err
+		}
+
+		//	Rules not declared to the reconciler are saved, so they can be restored later
+		saved := map[string][]k8sfirewall.ChainRule{}
+		for _, direction := range undeclared {
+			live, err := utils.ListRules(fw, direction)
+			if err != nil {
+				return err
+			}
+			saved[direction] = []k8sfirewall.ChainRule{}
+			for _, rule := range live {
+				rule.Id = 0
+				//	Temporary rules are put back by the reconciler, if they did not expire in the meantime
+				if !utils.IsManagementRule(fw, direction, rule) && !isTemporary(rule) {
+					saved[direction] = append(saved[direction], rule)
+				}
+			}
+		}
+
+		func() {
+			r.lock.Lock()
+			defer r.lock.Unlock()
+
+			if instance, exists := r.instances[pod]; exists {
+				instance.quarantined = true
+				instance.beforeQuarantine = saved
+				instance.acceptedEstablished = accepted
+				quarantines.set(r.graph, pod, quarantineRecord{BeforeQuarantine: saved, AcceptedEstablished: accepted})
+			}
+		}()
+
+		return r.apply(pod, false)
+	})
+}
+
+// release puts back the rules an instance had before being quarantined
+func (r *firewallReconciler) release(pod string) error {
+	return r.change(pod, func() error {
+		fw, saved, accepted, err := func() (utils.Firewall, map[string][]k8sfirewall.ChainRule, bool, error) {
+			r.lock.Lock()
+			defer r.lock.Unlock()
+
+			instance, exists := r.instances[pod]
+			if !exists {
+				return utils.Firewall{}, nil, false, ErrInstanceNotFound
+			}
+			if !instance.quarantined {
+				return utils.Firewall{}, nil, false, errors.New("Instance is not quarantined")
+			}
+
+			saved := instance.beforeQuarantine
+			instance.quarantined = false
+			instance.beforeQuarantine = nil
+			quarantines.remove(r.graph, pod)
+			return instance.firewall, saved, instance.acceptedEstablished, nil
+		}()
+		if err != nil {
+			return err
+		}
+
+		for direction, rules := range saved {
+			live, err := utils.ListRules(fw, direction)
+			if err != nil {
+				return err
+			}
+			toDelete, toInsert := utils.DiffRules(live, append(utils.ManagementRules(fw, direction), rules...))
+			if err := utils.ApplyRulesDiff(fw, direction, toDelete, toInsert); err != nil {
+				return err
+			}
+		}
+
+		if err := r.apply(pod, false); err != nil {
+			return err
+		}
+
+		if accepted && !utils.SetAcceptEstablished(fw, true) {
+			return errors.New("Could not accept established connections again")
+		}
+		return nil
+	})
+}
+
+// ensureRules puts the provided rules right after the management ones in a chain, in order.
+// Other rules in the chain are kept after them, as they are.
+func ensureRules(fw utils.Firewall, direction string, rules []k8sfirewall.ChainRule) error {
+	live, err := utils.ListRules(fw, direction)
+	if err != nil {
+		return err
+	}
+
+	desired := append(utils.ManagementRules(fw, direction), rules...)
+	for _, rule := range live {
+		if !utils.IsManagementRule(fw, direction, rule) && !isTemporary(rule) {
+			desired = append(desired, rule)
+		}
+	}
+
+	toDelete, toInsert := utils.DiffRules(live, desired)
+	if len(toDelete) == 0 && len(toInsert) == 0 {
+		return nil
+	}
+	return utils.ApplyRulesDiff(fw, direction, toDelete, toInsert)
+}
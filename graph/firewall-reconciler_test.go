@@ -0,0 +1,124 @@
+package graph
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/SunSince90/ASTRID-kube/utils"
+	"github.com/SunSince90/ASTRID-kube/utils/polycubetest"
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// eventRecorder keeps the events pushed to the infrastructure info
+type eventRecorder struct {
+	InfrastructureInfo
+	lock        sync.Mutex
+	events      []types.InfrastructureEvent
+	quarantined map[string]bool
+}
+
+func (e *eventRecorder) SetQuarantined(uid string, quarantined bool) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.quarantined == nil {
+		e.quarantined = map[string]bool{}
+	}
+	e.quarantined[uid] = quarantined
+}
+
+func (e *eventRecorder) PushEvent(event types.InfrastructureEvent) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.events = append(e.events, event)
+}
+
+// testPolycube starts a fake polycube, which runs the returned firewall
+func testPolycube(t *testing.T) (*polycubetest.Polycube, utils.Firewall, func()) {
+	polycube := polycubetest.New()
+
+	return polycube, utils.SidecarFirewall(polycube.Host(), polycube.Port(), "", ""), polycube.Close
+}
+
+func TestReconcileOrder(t *testing.T) {
+	polycube, fw, restore := testPolycube(t)
+	defer restore()
+
+	management := utils.ManagementRule(fw, "ingress")
+	drop := k8sfirewall.ChainRule{Action: "drop", Src: "10.0.0.5"}
+	forward := k8sfirewall.ChainRule{Action: "forward"}
+	polycube.SetFirewall("fw", polycubetest.Firewall{
+		Chains: map[string][]k8sfirewall.ChainRule{"ingress": {management, forward}},
+	})
+
+	builder := &eventRecorder{}
+	r := newFirewallReconciler("reconcile-order", log.WithFields(log.Fields{}), builder)
+	r.track("apache-1", "apache", fw)
+
+	//	The missing drop must come before the forward that would let its traffic through
+	assert.NoError(t, r.setRules(ruleSourceAPI, "apache-1", "ingress", []k8sfirewall.ChainRule{drop, forward}))
+	assert.Equal(t, []k8sfirewall.ChainRule{management, drop, forward}, withoutIds(polycube.Rules("fw", "ingress")))
+
+	//	Rules put in a different order are a drift
+	polycube.SetFirewall("fw", polycubetest.Firewall{
+		Chains: map[string][]k8sfirewall.ChainRule{"ingress": {management, forward, drop}},
+	})
+	assert.NoError(t, r.reconcile("apache-1", true))
+	assert.Equal(t, []k8sfirewall.ChainRule{management, drop, forward}, withoutIds(polycube.Rules("fw", "ingress")))
+	if assert.Len(t, builder.events, 1) {
+		assert.Equal(t, types.Drift, builder.events[0].Type)
+		assert.Equal(t, 1, builder.events[0].EventData.Firewall.Missing)
+		assert.Equal(t, 1, builder.events[0].EventData.Firewall.Unexpected)
+	}
+
+	//	while nothing is done if they are the same
+	calls := len(polycube.Calls())
+	assert.NoError(t, r.reconcile("apache-1", true))
+	assert.Equal(t, []string{"GET firewall/fw/chain/ingress/rule/"}, polycube.Calls()[calls:])
+}
+
+func TestReconcileConcurrently(t *testing.T) {
+	polycube, fw, restore := testPolycube(t)
+	defer restore()
+
+	management := utils.ManagementRule(fw, "ingress")
+	rules := []k8sfirewall.ChainRule{}
+	for _, src := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		rules = append(rules, k8sfirewall.ChainRule{Action: "drop", Src: src})
+	}
+
+	polycube.SetFirewall("fw", polycubetest.Firewall{})
+	r := newFirewallReconciler("reconcile-concurrently", log.WithFields(log.Fields{}), &eventRecorder{})
+	r.track("apache-1", "apache", fw)
+	assert.NoError(t, r.setRules(ruleSourceAPI, "apache-1", "ingress", rules))
+
+	//	Both see the same missing rules, but only one of them must put them back
+	for j := 0; j < 10; j++ {
+		polycube.SetFirewall("fw", polycubetest.Firewall{
+			Chains: map[string][]k8sfirewall.ChainRule{"ingress": {management}},
+		})
+
+		var wg sync.WaitGroup
+		for k := 0; k < 2; k++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, r.reconcile("apache-1", true))
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, append([]k8sfirewall.ChainRule{management}, rules...), withoutIds(polycube.Rules("fw", "ingress")))
+	}
+}
+
+func withoutIds(rules []k8sfirewall.ChainRule) []k8sfirewall.ChainRule {
+	for j := range rules {
+		rules[j].Id = 0
+	}
+	return rules
+}
@@ -0,0 +1,65 @@
+package graph
+
+import (
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/metrics"
+	"github.com/SunSince90/ASTRID-kube/settings"
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/SunSince90/ASTRID-kube/utils"
+)
+
+// collectStats periodically reads the counters of all firewalls in the graph, if enabled in settings
+func (handler *InfrastructureHandler) collectStats() {
+	if settings.Settings.FwStatsTimer < 1 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Second * settings.Settings.FwStatsTimer)
+		defer ticker.Stop()
+		for range ticker.C {
+			for pod, instance := range handler.reconciler.tracked() {
+				handler.readStats(pod, instance.service, instance.firewall)
+			}
+		}
+	}()
+}
+
+func (handler *InfrastructureHandler) readStats(pod, service string, fw utils.Firewall) {
+	for _, direction := range utils.Directions {
+		stats, err := utils.ReadChainStats(fw, direction)
+		if err != nil {
+			handler.log.Errorf("Could not read %s statistics of %s: %s", direction, pod, err)
+			continue
+		}
+
+		counters := []metrics.FirewallCounters{}
+		for _, rule := range stats {
+			counters = append(counters, metrics.FirewallCounters{
+				Rule:        rule.Id,
+				Action:      rule.Action,
+				Description: rule.Description,
+				Packets:     rule.Pkts,
+				Bytes:       rule.Bytes,
+			})
+		}
+		metrics.SetFirewallCounters(handler.name, service, pod, direction, counters)
+
+		for _, alert := range handler.alerts.check(pod, service, direction, stats, time.Now()) {
+			handler.log.Infof("Rule %d in %s of %s matched %.2f packets per second, above the threshold of %.2f", *alert.Rule, direction, pod, alert.Rate, alert.Threshold)
+			firewall := alert
+			handler.infoBuilder.PushEvent(types.InfrastructureEvent{
+				GraphName: handler.name,
+				Type:      types.Alert,
+				EventData: types.InfrastructureEventResource{
+					ResourceType: types.Pod,
+					Name:         service,
+					Ip:           fw.IP(),
+					Uid:          pod,
+					Firewall:     &firewall,
+				},
+			})
+		}
+	}
+}
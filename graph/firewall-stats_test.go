@@ -0,0 +1,73 @@
+package graph
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/SunSince90/ASTRID-kube/metrics"
+	"github.com/SunSince90/ASTRID-kube/utils/polycubetest"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// firewallMetric returns the value of a firewall metric of the "stats" graph with the provided labels
+func firewallMetric(t *testing.T, name string, labels map[string]string) (float64, bool) {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			matches := 0
+			for _, label := range metric.GetLabel() {
+				if value, exists := labels[label.GetName()]; exists && value == label.GetValue() {
+					matches++
+				}
+			}
+			if matches == len(labels) {
+				return metric.GetCounter().GetValue(), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func TestReadStats(t *testing.T) {
+	polycube, fw, restore := testPolycube(t)
+	defer restore()
+	defer metrics.DeleteFirewallCounters("stats", "apache-1")
+
+	polycube.SetFirewall("fw", polycubetest.Firewall{})
+	polycube.Stats["fw"] = map[string][]json.RawMessage{
+		"ingress": {
+			json.RawMessage(`{"id":0,"pkts":10,"bytes":1000,"action":"forward"}`),
+			json.RawMessage(`{"id":1,"pkts":5,"bytes":500,"action":"drop","description":"block scanner"}`),
+			json.RawMessage(`{"id":2,"pkts":3,"bytes":300,"action":"drop","description":"block crawler"}`),
+		},
+	}
+
+	recorder := &eventRecorder{}
+	handler := &InfrastructureHandler{name: "stats", log: log.WithField("GRAPH", "stats"), infoBuilder: recorder, alerts: newAlertWatcher()}
+	handler.readStats("apache-1", "apache", fw)
+
+	//	Each rule has its own counters
+	packets, exists := firewallMetric(t, "astrid_firewall_rule_packets_total", map[string]string{"graph": "stats", "pod": "apache-1", "direction": "ingress", "rule": "1", "action": "drop", "description": "block scanner"})
+	assert.True(t, exists)
+	assert.Equal(t, float64(5), packets)
+	bytes, exists := firewallMetric(t, "astrid_firewall_rule_bytes_total", map[string]string{"graph": "stats", "pod": "apache-1", "direction": "ingress", "rule": "2"})
+	assert.True(t, exists)
+	assert.Equal(t, float64(300), bytes)
+
+	//	along with the totals by action
+	packets, exists = firewallMetric(t, "astrid_firewall_packets_total", map[string]string{"graph": "stats", "pod": "apache-1", "direction": "ingress", "action": "drop"})
+	assert.True(t, exists)
+	assert.Equal(t, float64(8), packets)
+
+	//	and they are gone with the pod
+	metrics.DeleteFirewallCounters("stats", "apache-1")
+	_, exists = firewallMetric(t, "astrid_firewall_rule_packets_total", map[string]string{"graph": "stats", "pod": "apache-1"})
+	assert.False(t, exists)
+}
@@ -1,12 +1,17 @@
 package graph
 
 import (
+	"errors"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/SunSince90/ASTRID-kube/informers"
+	"github.com/SunSince90/ASTRID-kube/settings"
 	"github.com/SunSince90/ASTRID-kube/types"
 
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
 	log "github.com/sirupsen/logrus"
 	core_v1 "k8s.io/api/core/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -16,9 +21,34 @@ import (
 	"k8s.io/client-go/tools/cache"
 )
 
+var (
+	// ErrGraphNotFound is returned when the requested graph does not exist
+	ErrGraphNotFound = errors.New("Graph does not exist")
+	// ErrInstanceNotFound is returned when the requested instance is not protected by a firewall in its graph
+	ErrInstanceNotFound = errors.New("Instance is not protected by a firewall")
+)
+
 // Manager manages all graphs (namespaces) inside the cluster
 type Manager interface {
 	Start()
+	SetFirewallRules(string, string, string, []k8sfirewall.ChainRule) error
+	Quarantine(string, string) error
+	Release(string, string) error
+	AddTemporaryRule(string, string, string, k8sfirewall.ChainRule, time.Duration, string, string) error
+	TemporaryRules(string) ([]types.TemporaryRule, error)
+	Capture(string, string, types.CaptureFilter, time.Duration) (types.CaptureSession, error)
+	Captures(string) ([]types.CaptureSession, error)
+	GetCapture(string, string) (types.CaptureSession, error)
+	CaptureData(string, string) ([]byte, error)
+	CancelCapture(string, string) error
+	Status(string) (types.GraphStatus, error)
+	Graphs() []types.GraphStatus
+	InfrastructureInfo(string) (types.InfrastructureInfo, error)
+	Events(string, uint64) ([]types.EventRecord, error)
+	WatchEvents(string, *uint64) ([]types.EventRecord, <-chan types.EventRecord, func(), error)
+	Subscribe(types.Subscription) (types.Subscription, error)
+	Unsubscribe(string) error
+	Subscriptions() []types.Subscription
 }
 
 // GraphManager is the implementation of the graph manager
@@ -45,6 +75,13 @@ func InitManager(clientset kubernetes.Interface, stop chan struct{}) Manager {
 	informer := manager.getInformer()
 	manager.informer = informer
 
+	temporaryRules.load(settings.Settings.Paths.State, stop)
+	quarantines.load(settings.Settings.Paths.State)
+	subscriptions.load(settings.Settings.EndPoints.Verekube, settings.Settings.Formats, settings.Settings.Subscriptions)
+	counters.load(settings.Settings.Paths.State)
+	events.resume(counters.events())
+	deliveries.load(settings.Settings.Paths.State, stop)
+
 	//	Disabled this for now
 	/*manager.nodeInformer.AddEventHandler(func(obj interface{}) {
 		manager.lock.Lock()
@@ -64,6 +101,177 @@ func (manager *graphManager) Start() {
 	go manager.informer.Run(manager.stop)
 }
 
+// SetFirewallRules declares the rules that the firewall of a pod inside a graph must enforce in a direction
+func (manager *graphManager) SetFirewallRules(graph, pod, direction string, rules []k8sfirewall.ChainRule) error {
+	inf, err := manager.getInfrastructure(graph)
+	if err != nil {
+		return err
+	}
+
+	return inf.SetFirewallRules(pod, direction, rules)
+}
+
+// Quarantine isolates an instance of a graph, so that it can only be reached by ASTRID
+func (manager *graphManager) Quarantine(graph, uid string) error {
+	inf, err := manager.getInfrastructure(graph)
+	if err != nil {
+		return err
+	}
+
+	return inf.Quarantine(uid)
+}
+
+// Release puts a quarantined instance of a graph back to normal
+func (manager *graphManager) Release(graph, uid string) error {
+	inf, err := manager.getInfrastructure(graph)
+	if err != nil {
+		return err
+	}
+
+	return inf.Release(uid)
+}
+
+// AddTemporaryRule puts a rule in the firewall of an instance of a graph, which is removed when it expires
+func (manager *graphManager) AddTemporaryRule(graph, uid, direction string, rule k8sfirewall.ChainRule, ttl time.Duration, owner, reason string) error {
+	inf, err := manager.getInfrastructure(graph)
+	if err != nil {
+		return err
+	}
+
+	return inf.AddTemporaryRule(uid, direction, rule, ttl, owner, reason)
+}
+
+// TemporaryRules returns all rules of a graph that will expire
+func (manager *graphManager) TemporaryRules(graph string) ([]types.TemporaryRule, error) {
+	inf, err := manager.getInfrastructure(graph)
+	if err != nil {
+		return nil, err
+	}
+
+	return inf.TemporaryRules(), nil
+}
+
+// Capture starts capturing the traffic of an instance of a graph
+func (manager *graphManager) Capture(graph, uid string, filter types.CaptureFilter, duration time.Duration) (types.CaptureSession, error) {
+	inf, err := manager.getInfrastructure(graph)
+	if err != nil {
+		return types.CaptureSession{}, err
+	}
+
+	return inf.Capture(uid, filter, duration)
+}
+
+// Captures returns all packet captures of a graph, running or finished
+func (manager *graphManager) Captures(graph string) ([]types.CaptureSession, error) {
+	if _, err := manager.getInfrastructure(graph); err != nil {
+		return nil, err
+	}
+	return captures.list(graph), nil
+}
+
+// GetCapture returns a packet capture of a graph
+func (manager *graphManager) GetCapture(graph, id string) (types.CaptureSession, error) {
+	return captures.get(graph, id)
+}
+
+// CaptureData returns the packets of a finished capture of a graph, in the pcap format
+func (manager *graphManager) CaptureData(graph, id string) ([]byte, error) {
+	return captures.pcap(graph, id)
+}
+
+// CancelCapture stops a running capture of a graph, or deletes a finished one
+func (manager *graphManager) CancelCapture(graph, id string) error {
+	return captures.cancel(graph, id)
+}
+
+// Status returns the current state of a graph
+func (manager *graphManager) Status(graph string) (types.GraphStatus, error) {
+	inf, err := manager.getInfrastructure(graph)
+	if err != nil {
+		return types.GraphStatus{}, err
+	}
+
+	return inf.Status(), nil
+}
+
+// Graphs returns the current state of all graphs, by name
+func (manager *graphManager) Graphs() []types.GraphStatus {
+	manager.lock.Lock()
+	infrastructures := []Infrastructure{}
+	for _, inf := range manager.infrastructures {
+		infrastructures = append(infrastructures, inf)
+	}
+	manager.lock.Unlock()
+
+	graphs := []types.GraphStatus{}
+	for _, inf := range infrastructures {
+		graphs = append(graphs, inf.Status())
+	}
+	sort.Slice(graphs, func(i, j int) bool {
+		return graphs[i].Name < graphs[j].Name
+	})
+	return graphs
+}
+
+// InfrastructureInfo returns the infrastructure info of a graph as it is now
+func (manager *graphManager) InfrastructureInfo(graph string) (types.InfrastructureInfo, error) {
+	inf, err := manager.getInfrastructure(graph)
+	if err != nil {
+		return types.InfrastructureInfo{}, err
+	}
+
+	return inf.Info(), nil
+}
+
+// Events returns the events of a graph after the provided sequence, or of all graphs if graph is empty
+func (manager *graphManager) Events(graph string, since uint64) ([]types.EventRecord, error) {
+	if len(graph) > 0 {
+		if _, err := manager.getInfrastructure(graph); err != nil {
+			return nil, err
+		}
+	}
+
+	return events.since(graph, since)
+}
+
+// WatchEvents returns the events of a graph after the provided sequence, if any, and a channel with the next ones.
+// All graphs are watched if graph is empty. The returned function stops watching.
+func (manager *graphManager) WatchEvents(graph string, since *uint64) ([]types.EventRecord, <-chan types.EventRecord, func(), error) {
+	if len(graph) > 0 {
+		if _, err := manager.getInfrastructure(graph); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return events.watch(graph, since)
+}
+
+// Subscribe adds a destination of the infrastructure info and events of the graphs it is interested in
+func (manager *graphManager) Subscribe(subscription types.Subscription) (types.Subscription, error) {
+	return subscriptions.add(subscription)
+}
+
+// Unsubscribe stops sending data to a subscription
+func (manager *graphManager) Unsubscribe(id string) error {
+	return subscriptions.remove(id)
+}
+
+// Subscriptions returns all destinations of data, verekube included
+func (manager *graphManager) Subscriptions() []types.Subscription {
+	return subscriptions.list()
+}
+
+func (manager *graphManager) getInfrastructure(graph string) (Infrastructure, error) {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	inf, exists := manager.infrastructures[graph]
+	if !exists {
+		return nil, ErrGraphNotFound
+	}
+	return inf, nil
+}
+
 func (manager *graphManager) getInformer() cache.SharedIndexInformer {
 	//	Get the informer
 	informer := cache.NewSharedIndexInformer(&cache.ListWatch{
@@ -0,0 +1,35 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestManagerGraphs(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	graph := func(name, phase string) *InfrastructureHandler {
+		return &InfrastructureHandler{name: name, phase: phase, infoBuilder: newBuilder(clientset, name, types.CBEnforcement)}
+	}
+	manager := &graphManager{
+		clientset: clientset,
+		infrastructures: map[string]Infrastructure{
+			"web":      graph("web", phaseReady),
+			"database": graph("database", phaseProvisioning),
+		},
+	}
+
+	assert.Equal(t, []types.GraphStatus{
+		{Name: "database", Phase: phaseProvisioning},
+		{Name: "web", Phase: phaseReady},
+	}, manager.Graphs())
+
+	info, err := manager.InfrastructureInfo("web")
+	assert.NoError(t, err)
+	assert.Equal(t, "web", info.Metadata.Name)
+
+	_, err = manager.InfrastructureInfo("other")
+	assert.Error(t, err)
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/SunSince90/ASTRID-kube/informers"
+	"github.com/SunSince90/ASTRID-kube/metrics"
 
 	"github.com/SunSince90/ASTRID-kube/utils"
 
@@ -26,7 +27,13 @@ type InfrastructureInfo interface {
 	PushService(string, *core_v1.ServiceSpec, []string)
 	PushInstance(string, string, string)
 	PopInstance(string)
+	PushEvent(types.InfrastructureEvent)
+	SetQuarantined(string, bool)
+	SetPolicyVersion(string, string)
+	OnPolicy(func(types.Policy))
+	SetBatching(types.Batching)
 	EnableSending()
+	Info() types.InfrastructureInfo
 	//Build(types.EncodingType)
 }
 
@@ -38,6 +45,19 @@ type InfrastructureInfoBuilder struct {
 	clientset         kubernetes.Interface
 	sendingMode       string
 	mostRecentEvent   types.InfrastructureEvent
+	//	base is the infrastructure info the last delta was generated from
+	base        types.InfrastructureInfo
+	onPolicy    func(types.Policy)
+	enforcement types.EnforcementType
+	//	pendingPolicy is the most recent policy waiting to be enforced, while applyingPolicy is true if one is being enforced
+	pendingPolicy  *types.Policy
+	applyingPolicy bool
+	//	batch are the events waiting to be sent together, until the deadline
+	batching      types.Batching
+	batch         []types.InfrastructureEvent
+	batchStart    time.Time
+	batchDeadline time.Time
+	batchTimer    *time.Timer
 }
 
 type serviceOffset struct {
@@ -51,13 +71,17 @@ type instanceOffset struct {
 	owner    string
 }
 
-func newBuilder(clientset kubernetes.Interface, name string) InfrastructureInfo {
+func newBuilder(clientset kubernetes.Interface, name string, enforcement types.EnforcementType) InfrastructureInfo {
 
+	//	A graph goes on from where it was before a restart
+	last := counters.graph(name)
 	info := types.InfrastructureInfo{
 		Kind: types.KIND,
 		Metadata: types.InfrastructureInfoMetadata{
 			Name:       name,
 			LastUpdate: time.Now().UTC(),
+			Revision:   last.Revision,
+			Sequence:   last.Sequence,
 		},
 	}
 
@@ -68,6 +92,7 @@ func newBuilder(clientset kubernetes.Interface, name string) InfrastructureInfo
 		deployedInstances: map[string]*instanceOffset{},
 		sendingMode:       "",
 		mostRecentEvent:   types.InfrastructureEvent{},
+		enforcement:       enforcement,
 	}
 }
 
@@ -119,6 +144,8 @@ func (i *InfrastructureInfoBuilder) PushService(name string, spec *core_v1.Servi
 	}
 
 	i.info.Spec.Services = append(i.info.Spec.Services, service)
+	i.touch()
+	i.sendDelta()
 }
 
 func (i *InfrastructureInfoBuilder) PushInstance(service, ip, uid string) {
@@ -149,6 +176,7 @@ func (i *InfrastructureInfoBuilder) PushInstance(service, ip, uid string) {
 		IP:  ip,
 		UID: uid,
 	})
+	i.touch()
 
 	//	Put it in the most recent event
 	i.mostRecentEvent = types.InfrastructureEvent{
@@ -187,6 +215,7 @@ func (i *InfrastructureInfoBuilder) PopInstance(uid string) {
 		t := instance.position
 		i.info.Spec.Services[serviceOffset].Instances = append(i.info.Spec.Services[serviceOffset].Instances[:t], i.info.Spec.Services[serviceOffset].Instances[t+1:]...)
 	}
+	i.touch()
 
 	i.mostRecentEvent = types.InfrastructureEvent{
 		GraphName: i.info.Metadata.Name,
@@ -201,6 +230,73 @@ func (i *InfrastructureInfoBuilder) PopInstance(uid string) {
 	i.send()
 }
 
+// SetQuarantined marks an instance as quarantined or not
+func (i *InfrastructureInfoBuilder) SetQuarantined(uid string, quarantined bool) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	instance, exists := i.deployedInstances[uid]
+	if !exists {
+		return
+	}
+	s, exists := i.deployedServices[instance.owner]
+	if !exists {
+		return
+	}
+
+	instances := i.info.Spec.Services[s.position].Instances
+	for j := range instances {
+		if instances[j].UID == uid {
+			instances[j].Quarantined = quarantined
+		}
+	}
+	i.touch()
+	i.sendDelta()
+}
+
+// SetPolicyVersion sets the version of the policy enforced by an instance
+func (i *InfrastructureInfoBuilder) SetPolicyVersion(uid string, version string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	instance, exists := i.deployedInstances[uid]
+	if !exists {
+		return
+	}
+	s, exists := i.deployedServices[instance.owner]
+	if !exists {
+		return
+	}
+
+	instances := i.info.Spec.Services[s.position].Instances
+	for j := range instances {
+		if instances[j].UID == uid {
+			instances[j].PolicyVersion = version
+		}
+	}
+	i.touch()
+	i.sendDelta()
+}
+
+// OnPolicy sets the function to call with the policies received in responses,
+// when they are enforced directly rather than by the cb.
+func (i *InfrastructureInfoBuilder) OnPolicy(onPolicy func(types.Policy)) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.onPolicy = onPolicy
+}
+
+// PushEvent sends an event that is not about changes in the infrastructure,
+// but about something that happened to one of its resources.
+func (i *InfrastructureInfoBuilder) PushEvent(event types.InfrastructureEvent) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.mostRecentEvent = event
+	i.send()
+}
+
 func (i *InfrastructureInfoBuilder) EnableSending() {
 	i.lock.Lock()
 	defer i.lock.Unlock()
@@ -210,37 +306,73 @@ func (i *InfrastructureInfoBuilder) EnableSending() {
 	i.send()
 }
 
-func (i *InfrastructureInfoBuilder) generate() ([]byte, string, error) {
+// touch records that the infrastructure info changed. It must be called with the lock held.
+func (i *InfrastructureInfoBuilder) touch() {
+	i.info.Metadata.LastUpdate = time.Now().UTC()
+	i.info.Metadata.Revision++
+	counters.setGraph(i.info.Metadata.Name, i.info.Metadata.Sequence, i.info.Metadata.Revision)
+}
 
-	infrastructureInfo := func() ([]byte, string, error) {
-		i.info.Metadata.LastUpdate = time.Now().UTC()
-		i.info.Spec.Nodes = informers.Nodes.Current()
+// Info returns a copy of the infrastructure info as it is now, even if it has not been sent yet
+func (i *InfrastructureInfoBuilder) Info() types.InfrastructureInfo {
+	i.lock.Lock()
+	defer i.lock.Unlock()
 
-		data, contentType, err := utils.Marshal(settings.Settings.Formats.InfrastructureInfo, i.info)
-		if err != nil {
-			log.Errorf("An error occurred while trying to create the infrastructure info: %s. Will stop here.", err)
-			return nil, "", err
-		}
+	return i.snapshot()
+}
 
-		log.Infof("Infrastructure info built.")
-		return data, contentType, err
+// snapshot returns a copy of the infrastructure info, with the current nodes. It must be called with the lock held.
+func (i *InfrastructureInfoBuilder) snapshot() types.InfrastructureInfo {
+	info := i.info
+	info.Spec.Nodes = []types.InfrastructureInfoNode{}
+	if informers.Nodes != nil {
+		info.Spec.Nodes = informers.Nodes.Current()
 	}
 
-	infrastructureEvent := func() ([]byte, string, error) {
-		i.mostRecentEvent.EventTime = time.Now().UTC()
-		data, contentType, err := utils.Marshal(settings.Settings.Formats.InfrastructureEvent, i.mostRecentEvent)
-		log.Printf("# --- Infrastructure Event to send: --- #:\n%s\n\n# --- /Infrastructure Event to send --- #", string(data))
-		return data, contentType, err
+	info.Spec.Services = make([]types.InfrastructureInfoService, len(i.info.Spec.Services))
+	for j, service := range i.info.Spec.Services {
+		service.SecurityComponents = append([]types.InfrastructureInfoSecurityComponent{}, service.SecurityComponents...)
+		service.Ports = append([]types.InfrastructureInfoServicePort{}, service.Ports...)
+		service.Instances = append([]types.InfrastructureInfoServiceInstance{}, service.Instances...)
+		info.Spec.Services[j] = service
 	}
+	return info
+}
 
+// generate returns what has to be sent, according to the sending mode
+func (i *InfrastructureInfoBuilder) generate() (interface{}, error) {
 	switch i.sendingMode {
 	case "infrastructure-info":
-		return infrastructureInfo()
+		i.info.Metadata.LastUpdate = time.Now().UTC()
+		log.Infof("Infrastructure info built.")
+		i.base = i.snapshot()
+		return i.base, nil
 	case "infrastructure-event":
-		return infrastructureEvent()
+		i.mostRecentEvent.EventTime = time.Now().UTC()
+		i.info.Metadata.Sequence++
+		counters.setGraph(i.info.Metadata.Name, i.info.Metadata.Sequence, i.info.Metadata.Revision)
+		i.mostRecentEvent.Sequence = i.info.Metadata.Sequence
+		i.mostRecentEvent.Revision = i.info.Metadata.Revision
+		log.WithFields(log.Fields{"GRAPH": i.info.Metadata.Name}).Infof("Infrastructure event built: %s %s %s", i.mostRecentEvent.Type, i.mostRecentEvent.EventData.ResourceType, i.mostRecentEvent.EventData.Uid)
+		return i.mostRecentEvent, nil
+	case "infrastructure-delta":
+		current := i.snapshot()
+		patch, err := utils.CreatePatch(i.base, current)
+		if err != nil {
+			log.WithFields(log.Fields{"GRAPH": i.info.Metadata.Name}).Errorln("Could not build the infrastructure delta:", err)
+			return nil, err
+		}
+		delta := types.InfrastructureInfoDelta{
+			GraphName:      i.info.Metadata.Name,
+			BaseRevision:   i.base.Metadata.Revision,
+			TargetRevision: current.Metadata.Revision,
+			Patch:          patch,
+		}
+		i.base = current
+		return delta, nil
 	}
 
-	return nil, "", errors.New("Unrecognized sending mode")
+	return nil, errors.New("Unrecognized sending mode")
 }
 
 func (i *InfrastructureInfoBuilder) send() {
@@ -252,45 +384,300 @@ func (i *InfrastructureInfoBuilder) send() {
 		i.sendingMode = "infrastructure-event"
 	}()
 
-	data, contentType, err := i.generate()
+	payload, err := i.generate()
 	if err != nil {
 		return
 	}
 
-	i.sendRequest(data, contentType)
+	graph := i.info.Metadata.Name
+	if i.sendingMode == "infrastructure-info" {
+		sinks := subscriptions.enable(graph, i)
+		for _, s := range sinks {
+			i.queue(s, payload, true)
+			subscriptions.markReady(s, graph)
+		}
+		deliveries.dispatch(graph)
+		return
+	}
+
+	events.record(i.mostRecentEvent)
+	if i.batching.Window > 0 {
+		i.addToBatch(i.mostRecentEvent)
+	} else {
+		for _, s := range subscriptions.forEvent(i.mostRecentEvent) {
+			i.queue(s, payload, false)
+		}
+		deliveries.dispatch(graph)
+	}
+	i.sendDelta()
 }
 
-func (i *InfrastructureInfoBuilder) sendRequest(data []byte, contentType string) {
-	endPoint := settings.Settings.EndPoints.Verekube.InfrastructureEvent
-	if i.sendingMode == "infrastructure-info" {
-		endPoint = settings.Settings.EndPoints.Verekube.InfrastructureInfo
+// SetBatching sets how events close to each other are sent together
+func (i *InfrastructureInfoBuilder) SetBatching(batching types.Batching) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.batching = batching
+}
+
+// addToBatch puts an event in the current batch, which is sent when no other event comes within the window,
+// when it is full, or when its first event waited too long. It must be called with the lock held.
+func (i *InfrastructureInfoBuilder) addToBatch(event types.InfrastructureEvent) {
+	now := time.Now()
+	if len(i.batch) == 0 {
+		i.batchStart = now
 	}
+	i.batch = append(i.batch, event)
 
-	if len(endPoint) < 1 {
-		log.Errorln("No endpoint has been specified. Will stop here.")
+	if i.batching.MaxSize > 0 && len(i.batch) >= i.batching.MaxSize {
+		i.sendBatch()
 		return
 	}
 
-	response, err := utils.Post(endPoint, contentType, data)
+	i.batchDeadline = now.Add(time.Duration(i.batching.Window) * time.Millisecond)
+	if i.batching.MaxLatency > 0 {
+		if latest := i.batchStart.Add(time.Duration(i.batching.MaxLatency) * time.Millisecond); latest.Before(i.batchDeadline) {
+			i.batchDeadline = latest
+		}
+	}
+
+	if i.batchTimer == nil {
+		i.batchTimer = time.AfterFunc(i.batchDeadline.Sub(now), func() {
+			i.lock.Lock()
+			defer i.lock.Unlock()
+
+			//	It may have been moved in the meantime
+			if len(i.batch) > 0 && !time.Now().Before(i.batchDeadline) {
+				i.sendBatch()
+			}
+		})
+		return
+	}
+	i.batchTimer.Stop()
+	i.batchTimer.Reset(i.batchDeadline.Sub(now))
+}
+
+// sendBatch sends the events in the current batch, each subscription getting only the ones it wants.
+// It must be called with the lock held.
+func (i *InfrastructureInfoBuilder) sendBatch() {
+	batch := i.batch
+	i.batch = nil
+	if i.batchTimer != nil {
+		i.batchTimer.Stop()
+	}
+
+	graph := i.info.Metadata.Name
+	log.WithFields(log.Fields{"GRAPH": graph}).Infof("Infrastructure event batch built with %d events", len(batch))
+	for _, s := range subscriptions.forEvents(graph) {
+		if wanted := i.filter(s, batch); len(wanted) > 0 {
+			i.queue(s, types.InfrastructureEventBatch{GraphName: graph, Events: wanted}, false)
+		}
+	}
+	deliveries.dispatch(graph)
+}
+
+// filter returns the events a sink wants
+func (i *InfrastructureInfoBuilder) filter(s *sink, list []types.InfrastructureEvent) []types.InfrastructureEvent {
+	wanted := []types.InfrastructureEvent{}
+	for j := range list {
+		if s.wants(list[j].GraphName, &list[j]) {
+			wanted = append(wanted, list[j])
+		}
+	}
+	return wanted
+}
+
+// sendDelta sends how the infrastructure info changed since the last time to the subscriptions that want it,
+// including changes that have no event. It must be called with the lock held.
+func (i *InfrastructureInfoBuilder) sendDelta() {
+	if i.sendingMode != "infrastructure-event" {
+		return
+	}
+
+	graph := i.info.Metadata.Name
+	sinks := subscriptions.forDelta(graph)
+	if len(sinks) == 0 {
+		i.base = i.snapshot()
+		return
+	}
+
+	i.sendingMode = "infrastructure-delta"
+	defer func() {
+		i.sendingMode = "infrastructure-event"
+	}()
+
+	payload, err := i.generate()
+	if err != nil || len(payload.(types.InfrastructureInfoDelta).Patch) == 0 {
+		return
+	}
+	for _, s := range sinks {
+		i.queue(s, payload, false)
+	}
+	deliveries.dispatch(graph)
+}
+
+// welcome sends the infrastructure info to a new subscription, which is going to get events from now on
+func (i *InfrastructureInfoBuilder) welcome(s *sink) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.queue(s, i.snapshot(), true)
+	subscriptions.markReady(s, i.info.Metadata.Name)
+	deliveries.dispatch(i.info.Metadata.Name)
+}
+
+// resync queues the infrastructure info as it is now for a subscription that lost some events
+func (i *InfrastructureInfoBuilder) resync(sinkID string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	s := subscriptions.get(sinkID)
+	if len(i.sendingMode) < 1 || s == nil || !s.wants(i.info.Metadata.Name, nil) {
+		return
+	}
+	log.WithFields(log.Fields{"GRAPH": i.info.Metadata.Name}).Infof("Sending the infrastructure info again to %s", sinkID)
+	i.queue(s, i.snapshot(), true)
+}
+
+// queue puts the infrastructure info or an event in the outbox of a sink, in its format.
+// It must be called with the lock held.
+func (i *InfrastructureInfoBuilder) queue(s *sink, payload interface{}, info bool) {
+	//	The infrastructure info already includes all events that are waiting
+	if !info && overflow() == types.Coalesce && deliveries.full(i.info.Metadata.Name, s.subscription.ID) {
+		log.WithFields(log.Fields{"GRAPH": i.info.Metadata.Name}).Errorf("Too many events waiting for %s, going to send the infrastructure info instead", s.subscription.ID)
+		metrics.OutboxOverflows.WithLabelValues(i.info.Metadata.Name, s.subscription.ID).Inc()
+		payload, info = i.snapshot(), true
+	}
+
+	if entry, ok := i.entry(s, payload, info); ok {
+		deliveries.push(entry)
+	}
+}
+
+// entry encodes the infrastructure info or events for a sink, numbering the deliveries of events to it.
+// The infrastructure info carries the delivery of the last event the sink got before it.
+func (i *InfrastructureInfoBuilder) entry(s *sink, payload interface{}, info bool) (outboxEntry, bool) {
+	endPoint, format := s.eventURL, s.eventFormat
+	if info {
+		endPoint, format = s.infoURL, s.infoFormat
+	}
+
+	if len(endPoint) < 1 {
+		log.WithFields(log.Fields{"GRAPH": i.info.Metadata.Name}).Errorf("No endpoint has been specified for %s. Will stop here.", s.subscription.ID)
+		return outboxEntry{}, false
+	}
+
+	graph := i.info.Metadata.Name
+	entry := outboxEntry{
+		Graph: graph,
+		Sink:  s.subscription.ID,
+		URL:   endPoint,
+		Info:  info,
+	}
+	switch p := payload.(type) {
+	case types.InfrastructureInfo:
+		p.Metadata.Delivery = counters.delivery(graph, s.subscription.ID)
+		payload = p
+	case types.InfrastructureEvent:
+		p.Delivery = counters.next(graph, s.subscription.ID)
+		entry.Delivery, entry.Last = p.Delivery, p.Delivery
+		payload = p
+	case types.InfrastructureEventBatch:
+		p.Events = append([]types.InfrastructureEvent{}, p.Events...)
+		for j := range p.Events {
+			p.Events[j].Delivery = counters.next(graph, s.subscription.ID)
+		}
+		entry.Delivery, entry.Last = p.Events[0].Delivery, p.Events[len(p.Events)-1].Delivery
+		payload = p
+	}
+
+	data, contentType, err := utils.Marshal(format, payload)
 	if err != nil {
+		return outboxEntry{}, false
+	}
+	entry.ContentType, entry.Data = contentType, data
+	return entry, true
+}
+
+// handleResponse handles the response of verekube, which carries the policy to enforce as the settings say
+func (i *InfrastructureInfoBuilder) handleResponse(response *http.Response) {
+	//	Only the cb needs the policy as it is: it is parsed by ASTRID-kube in all other cases
+	if i.enforcement != types.CBEnforcement {
+		i.enforce(response)
 		return
 	}
-	log.WithFields(log.Fields{"GRAPH": i.info.Metadata.Name}).Println("Sent data and received", response.StatusCode)
-	defer response.Body.Close()
 	i.forward(response.Body)
 }
 
+// enforce parses the policy in the response and passes it to be pushed in the firewalls
+func (i *InfrastructureInfoBuilder) enforce(response *http.Response) {
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		log.Errorln("Error in decoding data")
+		return
+	}
+	if len(bytes.TrimSpace(data)) == 0 || i.onPolicy == nil {
+		return
+	}
+
+	format, ok := utils.EncodingFromContentType(response.Header.Get("Content-Type"))
+	if !ok {
+		format = settings.Settings.Formats.InfrastructureInfo
+	}
+
+	policy := types.Policy{}
+	if err := utils.Unmarshal(format, data, &policy); err != nil {
+		log.WithFields(log.Fields{"GRAPH": i.info.Metadata.Name}).Errorln("Could not parse the policy:", err)
+		return
+	}
+
+	i.applyPolicy(policy)
+}
+
+// applyPolicy passes a policy to be enforced. Policies are enforced one at a time, in the order they are received:
+// a policy that comes while another is being enforced replaces the one that is waiting, if any, as it is more recent.
+func (i *InfrastructureInfoBuilder) applyPolicy(policy types.Policy) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.pendingPolicy = &policy
+	if i.applyingPolicy {
+		return
+	}
+	i.applyingPolicy = true
+
+	//	It is going to push rules to firewalls, which takes time: don't do it while holding the lock
+	go func() {
+		for {
+			i.lock.Lock()
+			next := i.pendingPolicy
+			i.pendingPolicy = nil
+			if next == nil {
+				i.applyingPolicy = false
+				i.lock.Unlock()
+				return
+			}
+			i.lock.Unlock()
+
+			i.onPolicy(*next)
+		}
+	}()
+}
+
 func (i *InfrastructureInfoBuilder) forward(body io.ReadCloser) {
 	data, err := ioutil.ReadAll(body)
 	if err != nil {
 		log.Errorln("Error in decoding data")
 	}
-	endPoint := settings.Settings.EndPoints.CB.Configuration
-	req, err := http.NewRequest("POST", endPoint, bytes.NewBuffer(data))
-	req.Header.Set("Content-Type", "application/xml")
-	client := &http.Client{}
-	_, err = client.Do(req)
+	response, err := utils.Post(settings.Settings.EndPoints.CB.Configuration, "application/xml", data)
 	if err != nil {
+		metrics.SendFailures.WithLabelValues(i.info.Metadata.Name, "cb").Inc()
 		log.Errorln("Error while forwarding:", err)
+		return
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		metrics.SendFailures.WithLabelValues(i.info.Metadata.Name, "cb").Inc()
+		log.Errorln("Forwarded data was rejected with", response.StatusCode)
 	}
 }
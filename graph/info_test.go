@@ -2,8 +2,67 @@ package graph
 
 import (
 	"testing"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/stretchr/testify/assert"
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func TestPushService(t *testing.T) {
 
 }
+
+func TestInfo(t *testing.T) {
+	builder := newBuilder(fake.NewSimpleClientset(), "mygraph", types.CBEnforcement)
+	builder.PushService("apache", &core_v1.ServiceSpec{
+		Ports: []core_v1.ServicePort{{Protocol: core_v1.ProtocolTCP, TargetPort: intstr.FromInt(80), NodePort: 30080}},
+	}, []string{"firewall"})
+	builder.PushInstance("apache", "10.0.0.1", "apache-1")
+	before := builder.Info().Metadata.LastUpdate
+
+	info := builder.Info()
+	assert.Equal(t, types.KIND, info.Kind)
+	assert.Equal(t, "mygraph", info.Metadata.Name)
+	assert.Equal(t, []types.InfrastructureInfoServicePort{{Port: 80, Exposed: 30080, Protocol: types.TCP}}, info.Spec.Services[0].Ports)
+	assert.Equal(t, []types.InfrastructureInfoServiceInstance{{IP: "10.0.0.1", UID: "apache-1"}}, info.Spec.Services[0].Instances)
+
+	//	It is a copy
+	info.Spec.Services[0].Instances[0].IP = "10.0.0.2"
+	assert.Equal(t, "10.0.0.1", builder.Info().Spec.Services[0].Instances[0].IP)
+
+	//	Nothing changed, so it is the same
+	assert.Equal(t, builder.Info(), builder.Info())
+
+	revision := builder.Info().Metadata.Revision
+	builder.SetQuarantined("apache-1", true)
+	assert.True(t, builder.Info().Spec.Services[0].Instances[0].Quarantined)
+	assert.False(t, builder.Info().Metadata.LastUpdate.Before(before))
+	assert.Equal(t, revision+1, builder.Info().Metadata.Revision)
+}
+
+func TestApplyPolicy(t *testing.T) {
+	builder := newBuilder(fake.NewSimpleClientset(), "mygraph", types.DirectEnforcement).(*InfrastructureInfoBuilder)
+
+	applied := make(chan string)
+	release := make(chan struct{})
+	builder.OnPolicy(func(policy types.Policy) {
+		applied <- policy.Version
+		<-release
+	})
+
+	builder.applyPolicy(types.Policy{Version: "1"})
+	assert.Equal(t, "1", <-applied)
+
+	//	While the first one is enforced, the most recent one replaces the others waiting
+	builder.applyPolicy(types.Policy{Version: "2"})
+	builder.applyPolicy(types.Policy{Version: "3"})
+	release <- struct{}{}
+	assert.Equal(t, "3", <-applied)
+	release <- struct{}{}
+
+	builder.applyPolicy(types.Policy{Version: "4"})
+	assert.Equal(t, "4", <-applied)
+	release <- struct{}{}
+}
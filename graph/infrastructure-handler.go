@@ -3,23 +3,51 @@ package graph
 import (
 	"encoding/json"
 	"errors"
+	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/SunSince90/ASTRID-kube/metrics"
 	"github.com/SunSince90/ASTRID-kube/settings"
 
 	"github.com/SunSince90/ASTRID-kube/utils"
 
 	informer "github.com/SunSince90/ASTRID-kube/informers"
 	astrid_types "github.com/SunSince90/ASTRID-kube/types"
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
 	log "github.com/sirupsen/logrus"
 	apps_v1 "k8s.io/api/apps/v1"
 	core_v1 "k8s.io/api/core/v1"
+	networking_v1 "k8s.io/api/networking/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
+const (
+	provisioningBackoff = 2 * time.Second
+)
+
+const (
+	enforcementAnnotation = "astrid.io/enforcement"
+	batchingAnnotation    = "astrid.io/batching"
+)
+
+const (
+	phaseDiscovering  = "discovering"
+	phaseProvisioning = "provisioning"
+	phaseReady        = "ready"
+)
+
 type Infrastructure interface {
+	SetFirewallRules(string, string, []k8sfirewall.ChainRule) error
+	Quarantine(string) error
+	Release(string) error
+	AddTemporaryRule(string, string, k8sfirewall.ChainRule, time.Duration, string, string) error
+	TemporaryRules() []astrid_types.TemporaryRule
+	Capture(string, astrid_types.CaptureFilter, time.Duration) (astrid_types.CaptureSession, error)
+	Status() astrid_types.GraphStatus
+	Info() astrid_types.InfrastructureInfo
 }
 
 type InfrastructureHandler struct {
@@ -38,7 +66,25 @@ type InfrastructureHandler struct {
 	services            map[string]*core_v1.ServiceSpec
 	lock                sync.Mutex
 	infoBuilder         InfrastructureInfo
+	reconciler          *firewallReconciler
+	provisioning        *provisioningQueue
+	alerts              *alertWatcher
 	initialized         bool
+	phase               string
+	policyLock          sync.Mutex
+	policy              *astrid_types.Policy
+	//	NetworkPolicies of the graph, by name: nil if they are not enforced
+	networkPolicies         map[string]*networking_v1.NetworkPolicy
+	networkPolicyDirections map[string]map[string]bool
+	networkPoliciesLock     sync.Mutex
+	networkPoliciesInformer informer.Informer
+	enforcement             astrid_types.EnforcementType
+	//	labels selecting the pods of each deployment
+	selectors map[string]map[string]string
+	//	instances that are not protected by a firewall, as policies are enforced by NetworkPolicies
+	unprotected map[string]string
+	//	instances whose sidecar cannot run a firewall, with what is wrong in each of them
+	misconfigured map[string][]string
 }
 
 type count struct {
@@ -65,9 +111,23 @@ func new(clientset kubernetes.Interface, namespace *core_v1.Namespace) (Infrastr
 		resources:          map[string]bool{},
 		log:                log.New().WithFields(log.Fields{"GRAPH": namespace.Name}),
 		initialized:        false,
-		infoBuilder:        newBuilder(clientset, namespace.Name),
+		alerts:             newAlertWatcher(),
+		enforcement:        graphEnforcement(namespace.Annotations),
+		selectors:          map[string]map[string]string{},
+		unprotected:        map[string]string{},
+		misconfigured:      map[string][]string{},
+	}
+	inf.infoBuilder = newBuilder(clientset, namespace.Name, inf.enforcement)
+	inf.infoBuilder.SetBatching(graphBatching(namespace.Annotations))
+
+	if settings.Settings.NetworkPolicies {
+		inf.networkPolicies = map[string]*networking_v1.NetworkPolicy{}
+		inf.networkPolicyDirections = map[string]map[string]bool{}
 	}
 
+	inf.reconciler = newFirewallReconciler(namespace.Name, inf.log, inf.infoBuilder)
+	inf.provisioning = newProvisioningQueue(namespace.Name, inf.log, inf.setupFirewall, inf.healFirewall)
+
 	inf.log.Infoln("Detected new graph:\t", namespace.Name)
 
 	if len(namespace.Annotations) < 1 {
@@ -90,6 +150,11 @@ func new(clientset kubernetes.Interface, namespace *core_v1.Namespace) (Infrastr
 		inf.resources[name] = true
 	}
 
+	inf.alerts.setGraphThresholds(parseAlertThresholds(namespace.Annotations))
+	temporaryRules.register(namespace.Name, inf.handleExpiredRule)
+	inf.infoBuilder.OnPolicy(inf.handlePolicy)
+	inf.setPhase(phaseDiscovering)
+
 	//	First let's look at deployments
 	deploymentsInformer := informer.New(astrid_types.Deployments, namespace.Name)
 	deploymentsInformer.AddEventHandler(func(obj interface{}) {
@@ -110,6 +175,10 @@ func new(clientset kubernetes.Interface, namespace *core_v1.Namespace) (Infrastr
 	//servInformer.Start()
 
 	go inf.watch()
+	inf.reconciler.start()
+	inf.provisioning.start()
+	inf.checkFirewalls()
+	inf.collectStats()
 
 	return inf, nil
 }
@@ -125,6 +194,9 @@ func (handler *InfrastructureHandler) handleNewDeployment(deployment *apps_v1.De
 		needed:  *deployment.Spec.Replicas,
 		current: 0,
 	}
+	if deployment.Spec.Selector != nil {
+		handler.selectors[deployment.Name] = deployment.Spec.Selector.MatchLabels
+	}
 	handler.securityComponents[deployment.Name] = handler.parseSecurityComponents(deployment.Annotations)
 	if len(handler.securityComponents[deployment.Name]) > 0 {
 		componentsList := func() []string {
@@ -136,6 +208,7 @@ func (handler *InfrastructureHandler) handleNewDeployment(deployment *apps_v1.De
 		}()
 		handler.log.Infof("%s needs to be enriched with the following security components: %s", deployment.Name, strings.Join(componentsList, ","))
 	}
+	handler.alerts.setServiceThresholds(deployment.Name, parseAlertThresholds(deployment.Annotations))
 
 	//	Do we have all deployments? If we do, and we have all the needed ones, then we can close the deployment barrier
 	if len(handler.deployments) != len(handler.resources) {
@@ -208,6 +281,9 @@ func (handler *InfrastructureHandler) watch() {
 	handler.log.Infoln("Found all Deployment resources needed for this graph")
 
 	handler.log.Infoln("Watching for pod events...")
+	handler.lock.Lock()
+	handler.setPhase(phaseProvisioning)
+	handler.lock.Unlock()
 
 	//	Start listening for pods
 	podInformer := informer.New(astrid_types.Pods, handler.name)
@@ -217,14 +293,53 @@ func (handler *InfrastructureHandler) watch() {
 		handler.handlePod(p)
 	}, func(old, obj interface{}) {
 		p := obj.(*core_v1.Pod)
+		if o, ok := old.(*core_v1.Pod); ok && polycubeRestarted(o, p) {
+			handler.log.Infoln("Detected restart of polycube in pod:", p.Name)
+			//	Give it time to start listening again, as when the pod was created
+			handler.provisioning.heal(p.Name, time.Second*settings.Settings.FwInitTimer)
+		}
+		if o, ok := old.(*core_v1.Pod); ok && !reflect.DeepEqual(o.Labels, p.Labels) {
+			go handler.enforceNetworkPolicies()
+		}
 		handler.handlePod(p)
 	}, func(obj interface{}) {
 		p := obj.(*core_v1.Pod)
 		handler.log.Infoln("Detected dead pod:", p.Name)
+		handler.provisioning.forget(p.Name)
+		handler.reconciler.untrack(p.Name)
+		quarantines.remove(handler.name, p.Name)
+		metrics.DeleteFirewallCounters(handler.name, p.Name)
+		handler.alerts.forget(p.Name)
+		temporaryRules.forget(handler.name, p.Name)
 		handler.infoBuilder.PopInstance(p.Name)
+		handler.lock.Lock()
+		delete(handler.unprotected, p.Name)
+		handler.lock.Unlock()
+		handler.forgetMisconfiguration(p.Name)
+		go handler.enforcePolicy()
+		go handler.enforceNetworkPolicies()
 	})
 	handler.podInformer = podInformer
 	handler.podInformer.Start()
+
+	if handler.networkPolicies == nil {
+		return
+	}
+
+	//	Peers of NetworkPolicies can be anywhere in the cluster: rules are computed again whenever they change
+	peers.watch(handler.clientset, handler.name, handler.enforceNetworkPolicies)
+
+	//	Start listening for NetworkPolicies, now that instances can be protected
+	npInformer := informer.New(astrid_types.NetworkPolicies, handler.name)
+	npInformer.AddEventHandler(func(obj interface{}) {
+		handler.handleNetworkPolicy(obj.(*networking_v1.NetworkPolicy), false)
+	}, func(old, obj interface{}) {
+		handler.handleNetworkPolicy(obj.(*networking_v1.NetworkPolicy), false)
+	}, func(obj interface{}) {
+		handler.handleNetworkPolicy(obj.(*networking_v1.NetworkPolicy), true)
+	})
+	handler.networkPoliciesInformer = npInformer
+	handler.networkPoliciesInformer.Start()
 }
 
 func (handler *InfrastructureHandler) handlePod(pod *core_v1.Pod) {
@@ -276,13 +391,27 @@ func (handler *InfrastructureHandler) handlePod(pod *core_v1.Pod) {
 
 	//	Does it need a firewall?
 	if _, exists := handler.securityComponents[depName]["firewall"]; exists {
-		time.AfterFunc(time.Second*settings.Settings.FwInitTimer, func() {
-			handler.setupFirewall(pod, dep)
-		})
+		if handler.enforcement == astrid_types.NetworkPolicyEnforcement {
+			handler.registerInstance(pod, dep)
+			return
+		}
+
+		//	Without a working sidecar, there is nothing to provision
+		if settings.Settings.FirewallMode != astrid_types.NodeMode {
+			if problems := sidecarProblems(pod, resolvePolycubeEndpoint(pod).port); len(problems) > 0 {
+				handler.reportMisconfiguration(pod, problems)
+				return
+			}
+			handler.forgetMisconfiguration(pod.Name)
+		}
+
+		handler.provisioning.add(pod, dep, time.Second*settings.Settings.FwInitTimer)
 	}
 }
 
-func (handler *InfrastructureHandler) setupFirewall(pod *core_v1.Pod, dep *count) {
+// setupFirewall provisions the firewall of a pod and adds it to the graph.
+// It returns false if it should be tried again.
+func (handler *InfrastructureHandler) setupFirewall(pod *core_v1.Pod, dep *count) bool {
 	//	shorthands
 	ip := pod.Status.PodIP
 	name := pod.Name
@@ -290,18 +419,73 @@ func (handler *InfrastructureHandler) setupFirewall(pod *core_v1.Pod, dep *count
 	//service := pod.Annotations["astrid.io/service"]
 	service := strings.Split(pod.Name, "-")[0]
 
-	if !utils.CreateFirewall(ip) {
-		return
+	//	Already protected: from now on, its firewall is taken care of by the health checks.
+	//	Provisioning it again would also wipe its rules, i.e. when it is quarantined.
+	if instance, exists := handler.reconciler.tracked()[name]; exists && instance.ip == ip {
+		return true
 	}
-	handler.log.Infoln("Created firewall for pod:", name)
-	if !utils.AttachFirewall(ip) {
-		return
+
+	var firewall utils.Firewall
+	if settings.Settings.FirewallMode == astrid_types.NodeMode {
+		nodeIP, exists := informer.Nodes.IP(pod.Spec.NodeName)
+		if !exists {
+			nodeIP = pod.Status.HostIP
+		}
+		port := ""
+		if settings.Settings.Polycube.NodePort > 0 {
+			port = strconv.Itoa(int(settings.Settings.Polycube.NodePort))
+		}
+		firewall = utils.NodeFirewall(ip, nodeIP, port)
+	} else {
+		endpoint := resolvePolycubeEndpoint(pod)
+		firewall = utils.SidecarFirewall(ip, strconv.Itoa(int(endpoint.port)), endpoint.iface, endpoint.cube)
 	}
-	handler.log.Infoln("Attached firewall to pod:", name)
+
+	//	It was quarantined before a restart
+	_, quarantined := quarantines.get(handler.name, name)
+
+	if !utils.ProvisionFirewall(firewall, quarantined) {
+		return false
+	}
+	handler.log.Infoln("Created and attached firewall to pod:", name)
+
+	handler.reconciler.track(name, service, firewall)
 
 	//	TODO: look into name as uid
 	handler.infoBuilder.PushInstance(service, ip, name)
+	if quarantined {
+		handler.log.Infoln("Instance is still quarantined:", name)
+		handler.infoBuilder.SetQuarantined(name, true)
+		if err := handler.reconciler.reconcile(name, false); err != nil {
+			handler.log.Errorf("Could not quarantine %s again: %s", name, err)
+		}
+	}
+	go handler.enforcePolicy()
+	go handler.enforceNetworkPolicies()
+
+	handler.instanceReady(dep)
+	return true
+}
+
+// registerInstance adds an instance to the graph without protecting it with a firewall,
+// as its traffic is restricted by the NetworkPolicies generated from the policy.
+func (handler *InfrastructureHandler) registerInstance(pod *core_v1.Pod, dep *count) {
+	service := strings.Split(pod.Name, "-")[0]
 
+	handler.lock.Lock()
+	if ip, exists := handler.unprotected[pod.Name]; exists && ip == pod.Status.PodIP {
+		handler.lock.Unlock()
+		return
+	}
+	handler.unprotected[pod.Name] = pod.Status.PodIP
+	handler.lock.Unlock()
+
+	handler.infoBuilder.PushInstance(service, pod.Status.PodIP, pod.Name)
+	handler.instanceReady(dep)
+}
+
+// instanceReady counts a new instance of a deployment and builds the infrastructure info when all of them are there
+func (handler *InfrastructureHandler) instanceReady(dep *count) {
 	handler.lock.Lock()
 	defer handler.lock.Unlock()
 
@@ -312,7 +496,6 @@ func (handler *InfrastructureHandler) setupFirewall(pod *core_v1.Pod, dep *count
 	if dep.current == dep.needed {
 		handler.canBuildInfo()
 	}
-
 }
 
 func (handler *InfrastructureHandler) canBuildInfo() {
@@ -324,6 +507,77 @@ func (handler *InfrastructureHandler) canBuildInfo() {
 	}
 
 	handler.initialized = true
+	handler.setPhase(phaseReady)
 	handler.log.Infoln("The graph is fully running. Building Infrastructure Info...")
 	handler.infoBuilder.EnableSending()
 }
+
+// graphEnforcement returns who enforces the policy of a graph:
+// it can be chosen for each graph with an annotation, or it is the one in the settings.
+func graphEnforcement(annotations map[string]string) astrid_types.EnforcementType {
+	enforcement := settings.Settings.Enforcement
+	if value, exists := annotations[enforcementAnnotation]; exists {
+		enforcement = astrid_types.EnforcementType(value)
+	}
+
+	switch enforcement {
+	case astrid_types.CBEnforcement, astrid_types.DirectEnforcement, astrid_types.NetworkPolicyEnforcement:
+		return enforcement
+	case "":
+		return astrid_types.CBEnforcement
+	}
+
+	log.Errorf("Unrecognized enforcement %s, going to use %s", enforcement, astrid_types.CBEnforcement)
+	return astrid_types.CBEnforcement
+}
+
+// graphBatching returns how the events of a graph are batched:
+// the annotation can change any of the values in the settings for a single graph.
+func graphBatching(annotations map[string]string) astrid_types.Batching {
+	batching := settings.Settings.Batching
+	if value, exists := annotations[batchingAnnotation]; exists {
+		if err := json.Unmarshal([]byte(value), &batching); err != nil {
+			log.Errorf("Invalid %s annotation, going to use the settings: %s", batchingAnnotation, err)
+			return settings.Settings.Batching
+		}
+	}
+	return batching
+}
+
+// SetFirewallRules declares the rules that the firewall of a pod must enforce in a direction.
+// They are enforced immediately and restored whenever they are found changed.
+func (handler *InfrastructureHandler) SetFirewallRules(pod, direction string, rules []k8sfirewall.ChainRule) error {
+	return handler.reconciler.setRules(ruleSourceAPI, pod, direction, rules)
+}
+
+// Status returns the current state of the graph
+func (handler *InfrastructureHandler) Status() astrid_types.GraphStatus {
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+
+	status := astrid_types.GraphStatus{
+		Name:  handler.name,
+		Phase: handler.phase,
+	}
+	if len(handler.misconfigured) > 0 {
+		status.Misconfigured = map[string][]string{}
+		for pod, problems := range handler.misconfigured {
+			status.Misconfigured[pod] = append([]string{}, problems...)
+		}
+	}
+	return status
+}
+
+// Info returns the infrastructure info of the graph as it is now
+func (handler *InfrastructureHandler) Info() astrid_types.InfrastructureInfo {
+	return handler.infoBuilder.Info()
+}
+
+// setPhase moves the graph to a new phase. It must be called with the lock held.
+func (handler *InfrastructureHandler) setPhase(phase string) {
+	if len(handler.phase) > 0 {
+		metrics.Graphs.WithLabelValues(handler.phase).Dec()
+	}
+	handler.phase = phase
+	metrics.Graphs.WithLabelValues(phase).Inc()
+}
@@ -0,0 +1,381 @@
+package graph
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
+	log "github.com/sirupsen/logrus"
+	core_v1 "k8s.io/api/core/v1"
+	networking_v1 "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// handleNetworkPolicy keeps track of a NetworkPolicy of the graph, or forgets it when it is deleted
+func (handler *InfrastructureHandler) handleNetworkPolicy(policy *networking_v1.NetworkPolicy, deleted bool) {
+	handler.networkPoliciesLock.Lock()
+	if deleted {
+		handler.log.Infoln("Detected deleted NetworkPolicy:", policy.Name)
+		delete(handler.networkPolicies, policy.Name)
+	} else {
+		handler.log.Infoln("Detected NetworkPolicy:", policy.Name)
+		handler.networkPolicies[policy.Name] = policy
+	}
+	handler.networkPoliciesLock.Unlock()
+
+	handler.enforceNetworkPolicies()
+}
+
+// enforceNetworkPolicies computes again the rules of all NetworkPolicies of the graph and pushes them to all firewalls.
+// It must be called whenever instances or their labels change, as rules depend on them.
+func (handler *InfrastructureHandler) enforceNetworkPolicies() {
+	handler.networkPoliciesLock.Lock()
+	defer handler.networkPoliciesLock.Unlock()
+
+	if handler.networkPolicies == nil {
+		return
+	}
+
+	names := []string{}
+	for name := range handler.networkPolicies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	policies := []networking_v1.NetworkPolicy{}
+	for _, name := range names {
+		policies = append(policies, *handler.networkPolicies[name])
+	}
+
+	tracked := handler.reconciler.tracked()
+	rules := networkPolicyRules(policies, tracked, handler.selectPods)
+
+	for pod := range tracked {
+		directions, selected := rules[pod]
+
+		//	Directions that are not isolated anymore must be cleared before the rest is applied
+		stale := false
+		for direction := range handler.networkPolicyDirections[pod] {
+			if _, exists := directions[direction]; !exists {
+				stale = true
+			}
+		}
+		if stale {
+			if err := handler.reconciler.clearRules(ruleSourceNetworkPolicy, pod); err != nil {
+				handler.log.Errorf("Could not remove NetworkPolicy rules of %s: %s", pod, err)
+				continue
+			}
+			delete(handler.networkPolicyDirections, pod)
+		}
+		if !selected {
+			continue
+		}
+
+		applied := map[string]bool{}
+		for direction, chainRules := range directions {
+			if err := handler.reconciler.setRules(ruleSourceNetworkPolicy, pod, direction, chainRules); err != nil {
+				handler.log.Errorf("Could not enforce NetworkPolicies in %s of %s: %s", direction, pod, err)
+				continue
+			}
+			applied[direction] = true
+		}
+		handler.networkPolicyDirections[pod] = applied
+	}
+
+	for pod := range handler.networkPolicyDirections {
+		if _, exists := tracked[pod]; !exists {
+			delete(handler.networkPolicyDirections, pod)
+		}
+	}
+}
+
+// selectPods returns the addresses of all running pods matching the selectors, by pod name.
+// A nil namespace selector means the namespace of the graph.
+func (handler *InfrastructureHandler) selectPods(podSelector, namespaceSelector *meta_v1.LabelSelector) map[string]string {
+	pods, err := peers.selectPods(handler.name, podSelector, namespaceSelector)
+	if err != nil {
+		handler.log.Errorln("Could not select pods:", err)
+	}
+	return pods
+}
+
+// networkPolicyRules translates NetworkPolicies into the rules of each instance they select, by direction.
+// Instances are the ones protected by a firewall, by pod name, and selectPods resolves selectors to the addresses of pods.
+// Only the directions isolated by a policy are included: as firewalls drop everything by default,
+// they get the rules that forward the traffic that any of the policies allow.
+func networkPolicyRules(policies []networking_v1.NetworkPolicy, instances map[string]desiredFirewall, selectPods func(podSelector, namespaceSelector *meta_v1.LabelSelector) map[string]string) map[string]map[string][]k8sfirewall.ChainRule {
+	allowed := map[string]map[string][]allowedPeer{}
+
+	for _, policy := range policies {
+		ingress, egress := policyTypes(policy.Spec)
+
+		podSelector := policy.Spec.PodSelector
+		targets := selectPods(&podSelector, nil)
+
+		for pod := range instances {
+			if _, selected := targets[pod]; !selected {
+				continue
+			}
+			if _, exists := allowed[pod]; !exists {
+				allowed[pod] = map[string][]allowedPeer{}
+			}
+
+			if ingress {
+				if _, exists := allowed[pod]["ingress"]; !exists {
+					allowed[pod]["ingress"] = []allowedPeer{}
+				}
+				for _, rule := range policy.Spec.Ingress {
+					allowed[pod]["ingress"] = append(allowed[pod]["ingress"], allowedPeers(rule.From, rule.Ports, selectPods)...)
+				}
+			}
+			if egress {
+				if _, exists := allowed[pod]["egress"]; !exists {
+					allowed[pod]["egress"] = []allowedPeer{}
+				}
+				for _, rule := range policy.Spec.Egress {
+					allowed[pod]["egress"] = append(allowed[pod]["egress"], allowedPeers(rule.To, rule.Ports, selectPods)...)
+				}
+			}
+		}
+	}
+
+	//	Policies are a union: rules are computed from what all of them allow together
+	rules := map[string]map[string][]k8sfirewall.ChainRule{}
+	for pod, directions := range allowed {
+		rules[pod] = map[string][]k8sfirewall.ChainRule{}
+		for direction, peers := range directions {
+			rules[pod][direction] = allowedRules(direction, instances[pod].ip, peers)
+		}
+	}
+	return rules
+}
+
+// policyTypes tells which directions a NetworkPolicy isolates
+func policyTypes(spec networking_v1.NetworkPolicySpec) (bool, bool) {
+	//	When not specified, ingress is always isolated and egress only if there are egress rules
+	if len(spec.PolicyTypes) == 0 {
+		return true, len(spec.Egress) > 0
+	}
+
+	ingress, egress := false, false
+	for _, policyType := range spec.PolicyTypes {
+		switch policyType {
+		case networking_v1.PolicyTypeIngress:
+			ingress = true
+		case networking_v1.PolicyTypeEgress:
+			egress = true
+		}
+	}
+	return ingress, egress
+}
+
+// allowedPeer is the traffic that a rule of a NetworkPolicy allows with a range of addresses, but its exceptions.
+// An empty cidr is any address, and each protocol is the protocol and port of a rule, empty for any.
+type allowedPeer struct {
+	cidr      string
+	except    []string
+	protocols []k8sfirewall.ChainRule
+}
+
+// allowedPeers returns what a rule of a NetworkPolicy allows with its peers and ports
+func allowedPeers(peers []networking_v1.NetworkPolicyPeer, ports []networking_v1.NetworkPolicyPort, selectPods func(podSelector, namespaceSelector *meta_v1.LabelSelector) map[string]string) []allowedPeer {
+	//	No ports means any port
+	protocols := []k8sfirewall.ChainRule{{}}
+	if len(ports) > 0 {
+		protocols = []k8sfirewall.ChainRule{}
+	}
+	for _, port := range ports {
+		protocol := core_v1.ProtocolTCP
+		if port.Protocol != nil {
+			protocol = *port.Protocol
+		}
+		rule := k8sfirewall.ChainRule{L4proto: string(protocol)}
+		if port.Port != nil {
+			//	Named ports depend on each peer's containers and cannot be translated here
+			if port.Port.Type != intstr.Int {
+				continue
+			}
+			rule.Dport = port.Port.IntVal
+		}
+		protocols = append(protocols, rule)
+	}
+
+	//	No peers means any address
+	if len(peers) == 0 {
+		return []allowedPeer{{protocols: protocols}}
+	}
+
+	allowed := []allowedPeer{}
+	for _, peer := range peers {
+		if peer.IPBlock != nil {
+			allowed = append(allowed, allowedPeer{cidr: peer.IPBlock.CIDR, except: peer.IPBlock.Except, protocols: protocols})
+			continue
+		}
+
+		selected := selectPods(peer.PodSelector, peer.NamespaceSelector)
+		names := []string{}
+		for name := range selected {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			allowed = append(allowed, allowedPeer{cidr: selected[name], protocols: protocols})
+		}
+	}
+	return allowed
+}
+
+// addressBlock is a range of addresses mentioned by the peers, as it was written
+type addressBlock struct {
+	address string
+	network *net.IPNet
+}
+
+// contains tells if a block includes all addresses of another
+func (b addressBlock) contains(other addressBlock) bool {
+	ones, bits := b.network.Mask.Size()
+	otherOnes, otherBits := other.network.Mask.Size()
+	return bits == otherBits && ones <= otherOnes && b.network.Contains(other.network.IP)
+}
+
+// parseBlock parses an address or a range of addresses, where empty is any address
+func parseBlock(address string) (addressBlock, error) {
+	cidr := address
+	switch {
+	case len(address) == 0:
+		cidr = "0.0.0.0/0"
+	case !strings.Contains(address, "/") && strings.Contains(address, ":"):
+		cidr = address + "/128"
+	case !strings.Contains(address, "/"):
+		cidr = address + "/32"
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return addressBlock{}, err
+	}
+	return addressBlock{address: address, network: network}, nil
+}
+
+// allowedRules returns the rules of an instance that forward all the traffic the peers allow, and nothing else.
+// Ranges of addresses are either disjoint or one inside the other: the address space is split at each of them,
+// from the narrowest, and each part forwards what the peers that include it allow. Parts that allow less
+// than the wider ranges they are in, because of exceptions, drop the rest, so that wider ranges do not forward it.
+func allowedRules(direction, ip string, peers []allowedPeer) []k8sfirewall.ChainRule {
+	blocks := []addressBlock{}
+	known := map[string]bool{}
+	add := func(address string) {
+		block, err := parseBlock(address)
+		if err != nil {
+			log.Errorf("Invalid address %s in NetworkPolicy: %s", address, err)
+			return
+		}
+		if !known[block.network.String()] {
+			known[block.network.String()] = true
+			blocks = append(blocks, block)
+		}
+	}
+	for _, peer := range peers {
+		add(peer.cidr)
+		for _, except := range peer.except {
+			add(except)
+		}
+	}
+
+	//	What the part of the address space that is in a block, but not in any narrower one, allows
+	allows := func(block addressBlock) []k8sfirewall.ChainRule {
+		protocols := []k8sfirewall.ChainRule{}
+		for _, peer := range peers {
+			cidr, err := parseBlock(peer.cidr)
+			if err != nil || !cidr.contains(block) {
+				continue
+			}
+			excepted := false
+			for _, except := range peer.except {
+				if e, err := parseBlock(except); err == nil && e.contains(block) {
+					excepted = true
+				}
+			}
+			if !excepted {
+				protocols = append(protocols, peer.protocols...)
+			}
+		}
+		return simplifyProtocols(protocols)
+	}
+
+	sort.SliceStable(blocks, func(i, j int) bool {
+		iOnes, _ := blocks[i].network.Mask.Size()
+		jOnes, _ := blocks[j].network.Mask.Size()
+		return iOnes > jOnes
+	})
+
+	rules := []k8sfirewall.ChainRule{}
+	for _, block := range blocks {
+		protocols := allows(block)
+		for _, rule := range protocols {
+			rule.Action = "forward"
+			rules = append(rules, withPeer(rule, direction, ip, block.address))
+		}
+
+		drop := false
+		for _, wider := range blocks {
+			if wider.network.String() != block.network.String() && wider.contains(block) && !coverProtocols(protocols, allows(wider)) {
+				drop = true
+			}
+		}
+		if drop {
+			rules = append(rules, withPeer(k8sfirewall.ChainRule{Action: "drop"}, direction, ip, block.address))
+		}
+	}
+	return rules
+}
+
+// withPeer sets the addresses of a rule of an instance with a peer
+func withPeer(rule k8sfirewall.ChainRule, direction, ip, peer string) k8sfirewall.ChainRule {
+	if direction == "ingress" {
+		rule.Src, rule.Dst = peer, ip
+	} else {
+		rule.Src, rule.Dst = ip, peer
+	}
+	return rule
+}
+
+// coversProtocol tells if a protocol and port includes another
+func coversProtocol(a, b k8sfirewall.ChainRule) bool {
+	return (len(a.L4proto) == 0 || a.L4proto == b.L4proto) && (a.Dport == 0 || a.Dport == b.Dport)
+}
+
+// coverProtocols tells if a list of protocols includes all the ones of another
+func coverProtocols(list, others []k8sfirewall.ChainRule) bool {
+	for _, other := range others {
+		covered := false
+		for _, protocol := range list {
+			covered = covered || coversProtocol(protocol, other)
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// simplifyProtocols removes the protocols already included in others, keeping the order
+func simplifyProtocols(protocols []k8sfirewall.ChainRule) []k8sfirewall.ChainRule {
+	simplified := []k8sfirewall.ChainRule{}
+	for i, protocol := range protocols {
+		redundant := false
+		for j, other := range protocols {
+			if i == j || !coversProtocol(other, protocol) {
+				continue
+			}
+			//	Of two equal ones, the first is kept
+			if !coversProtocol(protocol, other) || j < i {
+				redundant = true
+			}
+		}
+		if !redundant {
+			simplified = append(simplified, protocol)
+		}
+	}
+	return simplified
+}
@@ -0,0 +1,159 @@
+package graph
+
+import (
+	"testing"
+
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
+	"github.com/stretchr/testify/assert"
+	core_v1 "k8s.io/api/core/v1"
+	networking_v1 "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestNetworkPolicyRules(t *testing.T) {
+	instances := map[string]desiredFirewall{
+		"apache-1": {ip: "10.0.0.1", service: "apache"},
+		"nodejs-1": {ip: "10.0.0.2", service: "nodejs"},
+		"redis-1":  {ip: "10.0.0.3", service: "redis"},
+	}
+	labelsOf := map[string]map[string]string{
+		"apache-1": {"app": "apache"},
+		"nodejs-1": {"app": "nodejs"},
+		"redis-1":  {"app": "redis"},
+	}
+	ipOf := map[string]string{"apache-1": "10.0.0.1", "nodejs-1": "10.0.0.2", "redis-1": "10.0.0.3", "monitor-1": "10.1.0.1"}
+
+	//	Only exact match selectors are needed here; the monitoring namespace has a single pod
+	selectPods := func(podSelector, namespaceSelector *meta_v1.LabelSelector) map[string]string {
+		if namespaceSelector != nil {
+			return map[string]string{"monitor-1": ipOf["monitor-1"]}
+		}
+		pods := map[string]string{}
+		for pod, labels := range labelsOf {
+			matches := true
+			for key, value := range podSelector.MatchLabels {
+				if labels[key] != value {
+					matches = false
+				}
+			}
+			if matches {
+				pods[pod] = ipOf[pod]
+			}
+		}
+		return pods
+	}
+
+	udp := core_v1.ProtocolUDP
+	port80 := intstr.FromInt(80)
+	port53 := intstr.FromInt(53)
+	named := intstr.FromString("http")
+	policies := []networking_v1.NetworkPolicy{
+		{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "apache"},
+			Spec: networking_v1.NetworkPolicySpec{
+				PodSelector: meta_v1.LabelSelector{MatchLabels: map[string]string{"app": "apache"}},
+				Ingress: []networking_v1.NetworkPolicyIngressRule{
+					{
+						From: []networking_v1.NetworkPolicyPeer{
+							{PodSelector: &meta_v1.LabelSelector{MatchLabels: map[string]string{"app": "nodejs"}}},
+							{NamespaceSelector: &meta_v1.LabelSelector{MatchLabels: map[string]string{"team": "monitoring"}}},
+						},
+						Ports: []networking_v1.NetworkPolicyPort{{Port: &port80}, {Port: &named}},
+					},
+				},
+			},
+		},
+		{
+			ObjectMeta: meta_v1.ObjectMeta{Name: "nodejs"},
+			Spec: networking_v1.NetworkPolicySpec{
+				PodSelector: meta_v1.LabelSelector{MatchLabels: map[string]string{"app": "nodejs"}},
+				PolicyTypes: []networking_v1.PolicyType{networking_v1.PolicyTypeEgress},
+				Egress: []networking_v1.NetworkPolicyEgressRule{
+					{
+						To:    []networking_v1.NetworkPolicyPeer{{IPBlock: &networking_v1.IPBlock{CIDR: "8.8.0.0/16", Except: []string{"8.8.4.0/24"}}}},
+						Ports: []networking_v1.NetworkPolicyPort{{Protocol: &udp, Port: &port53}},
+					},
+				},
+			},
+		},
+	}
+
+	rules := networkPolicyRules(policies, instances, selectPods)
+
+	assert.Equal(t, []k8sfirewall.ChainRule{
+		{Src: "10.0.0.2", Dst: "10.0.0.1", L4proto: "TCP", Dport: 80, Action: "forward"},
+		{Src: "10.1.0.1", Dst: "10.0.0.1", L4proto: "TCP", Dport: 80, Action: "forward"},
+	}, rules["apache-1"]["ingress"])
+	_, exists := rules["apache-1"]["egress"]
+	assert.False(t, exists)
+
+	assert.Equal(t, []k8sfirewall.ChainRule{
+		{Src: "10.0.0.2", Dst: "8.8.4.0/24", Action: "drop"},
+		{Src: "10.0.0.2", Dst: "8.8.0.0/16", L4proto: "UDP", Dport: 53, Action: "forward"},
+	}, rules["nodejs-1"]["egress"])
+	_, exists = rules["nodejs-1"]["ingress"]
+	assert.False(t, exists)
+
+	//	Pods not selected by any policy are not touched
+	_, exists = rules["redis-1"]
+	assert.False(t, exists)
+}
+
+func TestPolicyTypes(t *testing.T) {
+	ingress, egress := policyTypes(networking_v1.NetworkPolicySpec{})
+	assert.True(t, ingress)
+	assert.False(t, egress)
+
+	ingress, egress = policyTypes(networking_v1.NetworkPolicySpec{Egress: []networking_v1.NetworkPolicyEgressRule{{}}})
+	assert.True(t, ingress)
+	assert.True(t, egress)
+
+	ingress, egress = policyTypes(networking_v1.NetworkPolicySpec{PolicyTypes: []networking_v1.PolicyType{networking_v1.PolicyTypeEgress}})
+	assert.False(t, ingress)
+	assert.True(t, egress)
+}
+
+func TestNetworkPolicyUnion(t *testing.T) {
+	instances := map[string]desiredFirewall{"apache-1": {ip: "10.0.0.1", service: "apache"}}
+	selectPods := func(podSelector, namespaceSelector *meta_v1.LabelSelector) map[string]string {
+		return map[string]string{"apache-1": "10.0.0.1"}
+	}
+	policy := func(name, except string, ports []networking_v1.NetworkPolicyPort) networking_v1.NetworkPolicy {
+		return networking_v1.NetworkPolicy{
+			ObjectMeta: meta_v1.ObjectMeta{Name: name},
+			Spec: networking_v1.NetworkPolicySpec{
+				Ingress: []networking_v1.NetworkPolicyIngressRule{{
+					From:  []networking_v1.NetworkPolicyPeer{{IPBlock: &networking_v1.IPBlock{CIDR: "10.0.0.0/8", Except: []string{except}}}},
+					Ports: ports,
+				}},
+			},
+		}
+	}
+	port80 := intstr.FromInt(80)
+	port443 := intstr.FromInt(443)
+
+	//	What the exception of a policy excludes is allowed by the other one
+	rules := networkPolicyRules([]networking_v1.NetworkPolicy{
+		policy("first", "10.1.0.0/16", nil),
+		policy("second", "10.2.0.0/16", nil),
+	}, instances, selectPods)
+	assert.Equal(t, []k8sfirewall.ChainRule{
+		{Src: "10.1.0.0/16", Dst: "10.0.0.1", Action: "forward"},
+		{Src: "10.2.0.0/16", Dst: "10.0.0.1", Action: "forward"},
+		{Src: "10.0.0.0/8", Dst: "10.0.0.1", Action: "forward"},
+	}, rules["apache-1"]["ingress"])
+
+	//	Only on the ports of the other policy
+	second := policy("second", "", []networking_v1.NetworkPolicyPort{{Port: &port443}})
+	second.Spec.Ingress[0].From[0].IPBlock = &networking_v1.IPBlock{CIDR: "10.1.0.0/16"}
+	rules = networkPolicyRules([]networking_v1.NetworkPolicy{
+		policy("first", "10.1.0.0/16", []networking_v1.NetworkPolicyPort{{Port: &port80}}),
+		second,
+	}, instances, selectPods)
+	assert.Equal(t, []k8sfirewall.ChainRule{
+		{Src: "10.1.0.0/16", Dst: "10.0.0.1", L4proto: "TCP", Dport: 443, Action: "forward"},
+		{Src: "10.1.0.0/16", Dst: "10.0.0.1", Action: "drop"},
+		{Src: "10.0.0.0/8", Dst: "10.0.0.1", L4proto: "TCP", Dport: 80, Action: "forward"},
+	}, rules["apache-1"]["ingress"])
+}
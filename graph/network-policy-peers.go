@@ -0,0 +1,177 @@
+package graph
+
+import (
+	"reflect"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// peerCache keeps the pods and namespaces of the whole cluster, so that the peers of NetworkPolicies
+// are resolved without asking Kubernetes each time, and graphs know when they change
+type peerCache struct {
+	lock       sync.Mutex
+	pods       cache.SharedIndexInformer
+	namespaces cache.SharedIndexInformer
+	stop       chan struct{}
+	//	listeners are called when pods or namespaces change, by graph
+	listeners map[string]func()
+}
+
+var peers = &peerCache{
+	listeners: map[string]func(){},
+}
+
+// watch calls onChange whenever pods or namespaces change in a way that can change the peers of NetworkPolicies.
+// Pods and namespaces are cached from the first call on, which waits until the cache is filled.
+func (p *peerCache) watch(clientset kubernetes.Interface, graph string, onChange func()) {
+	p.lock.Lock()
+	p.listeners[graph] = onChange
+	if p.pods == nil {
+		p.start(clientset)
+	}
+	pods, namespaces, stop := p.pods, p.namespaces, p.stop
+	p.lock.Unlock()
+
+	if !cache.WaitForCacheSync(stop, pods.HasSynced, namespaces.HasSynced) {
+		log.Errorln("Could not fill the cache of pods and namespaces")
+	}
+}
+
+// start runs the informers of pods and namespaces. It must be called with the lock held.
+func (p *peerCache) start(clientset kubernetes.Interface) {
+	p.stop = make(chan struct{})
+	p.pods = cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+			return clientset.CoreV1().Pods(meta_v1.NamespaceAll).List(options)
+		},
+		WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+			return clientset.CoreV1().Pods(meta_v1.NamespaceAll).Watch(options)
+		},
+	},
+		&core_v1.Pod{},
+		0, //Skip resync
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+	)
+	p.namespaces = cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+			return clientset.CoreV1().Namespaces().List(options)
+		},
+		WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+			return clientset.CoreV1().Namespaces().Watch(options)
+		},
+	},
+		&core_v1.Namespace{},
+		0, //Skip resync
+		cache.Indexers{},
+	)
+
+	p.pods.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			p.notify()
+		},
+		UpdateFunc: func(old, obj interface{}) {
+			o, ok := old.(*core_v1.Pod)
+			n, ok2 := obj.(*core_v1.Pod)
+			//	Only the address and the labels of a pod matter, and whether it is running
+			if ok && ok2 && o.Status.Phase == n.Status.Phase && o.Status.PodIP == n.Status.PodIP && reflect.DeepEqual(o.Labels, n.Labels) {
+				return
+			}
+			p.notify()
+		},
+		DeleteFunc: func(obj interface{}) {
+			p.notify()
+		},
+	})
+	p.namespaces.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			p.notify()
+		},
+		UpdateFunc: func(old, obj interface{}) {
+			o, ok := old.(*core_v1.Namespace)
+			n, ok2 := obj.(*core_v1.Namespace)
+			if ok && ok2 && reflect.DeepEqual(o.Labels, n.Labels) {
+				return
+			}
+			p.notify()
+		},
+		DeleteFunc: func(obj interface{}) {
+			p.notify()
+		},
+	})
+
+	go p.pods.Run(p.stop)
+	go p.namespaces.Run(p.stop)
+}
+
+// notify tells all graphs that the peers may have changed
+func (p *peerCache) notify() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, onChange := range p.listeners {
+		go onChange()
+	}
+}
+
+// selectPods returns the addresses of all running pods matching the selectors, by pod name,
+// prefixed by their namespace when it is not the provided one. A nil namespace selector means the provided namespace.
+func (p *peerCache) selectPods(namespace string, podSelector, namespaceSelector *meta_v1.LabelSelector) (map[string]string, error) {
+	p.lock.Lock()
+	podStore, namespaceStore := p.pods, p.namespaces
+	p.lock.Unlock()
+
+	pods := map[string]string{}
+	if podStore == nil {
+		return pods, nil
+	}
+
+	namespaces := []string{namespace}
+	if namespaceSelector != nil {
+		selector, err := meta_v1.LabelSelectorAsSelector(namespaceSelector)
+		if err != nil {
+			return pods, err
+		}
+		namespaces = []string{}
+		for _, obj := range namespaceStore.GetStore().List() {
+			if ns, ok := obj.(*core_v1.Namespace); ok && selector.Matches(labels.Set(ns.Labels)) {
+				namespaces = append(namespaces, ns.Name)
+			}
+		}
+	}
+
+	selector := labels.Everything()
+	if podSelector != nil {
+		s, err := meta_v1.LabelSelectorAsSelector(podSelector)
+		if err != nil {
+			return pods, err
+		}
+		selector = s
+	}
+
+	for _, ns := range namespaces {
+		list, err := podStore.GetIndexer().ByIndex(cache.NamespaceIndex, ns)
+		if err != nil {
+			return pods, err
+		}
+		for _, obj := range list {
+			pod, ok := obj.(*core_v1.Pod)
+			if ok && pod.Status.Phase == core_v1.PodRunning && len(pod.Status.PodIP) > 0 && selector.Matches(labels.Set(pod.Labels)) {
+				name := pod.Name
+				if ns != namespace {
+					name = ns + "/" + name
+				}
+				pods[name] = pod.Status.PodIP
+			}
+		}
+	}
+
+	return pods, nil
+}
@@ -0,0 +1,58 @@
+package graph
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPeerCache(t *testing.T) {
+	pod := func(namespace, name, ip string, labels map[string]string) *core_v1.Pod {
+		return &core_v1.Pod{
+			ObjectMeta: meta_v1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+			Status:     core_v1.PodStatus{Phase: core_v1.PodRunning, PodIP: ip},
+		}
+	}
+	clientset := fake.NewSimpleClientset(
+		&core_v1.Namespace{ObjectMeta: meta_v1.ObjectMeta{Name: "mygraph"}},
+		&core_v1.Namespace{ObjectMeta: meta_v1.ObjectMeta{Name: "monitoring", Labels: map[string]string{"team": "monitoring"}}},
+		pod("mygraph", "apache-1", "10.0.0.1", map[string]string{"app": "apache"}),
+		pod("mygraph", "nodejs-1", "10.0.0.2", map[string]string{"app": "nodejs"}),
+	)
+
+	p := &peerCache{listeners: map[string]func(){}}
+	changed := make(chan struct{}, 10)
+	p.watch(clientset, "mygraph", func() {
+		changed <- struct{}{}
+	})
+	defer close(p.stop)
+
+	apache := &meta_v1.LabelSelector{MatchLabels: map[string]string{"app": "apache"}}
+	monitoring := &meta_v1.LabelSelector{MatchLabels: map[string]string{"team": "monitoring"}}
+	pods, err := p.selectPods("mygraph", apache, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"apache-1": "10.0.0.1"}, pods)
+	pods, err = p.selectPods("mygraph", nil, monitoring)
+	assert.NoError(t, err)
+	assert.Empty(t, pods)
+
+	//	Pods coming in other namespaces are noticed
+	_, err = clientset.CoreV1().Pods("monitoring").Create(pod("monitoring", "prometheus-1", "10.1.0.1", nil))
+	assert.NoError(t, err)
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Fatal("Changes were not noticed")
+		}
+		if pods, _ = p.selectPods("mygraph", nil, monitoring); len(pods) > 0 {
+			break
+		}
+	}
+	assert.Equal(t, map[string]string{"monitoring/prometheus-1": "10.1.0.1"}, pods)
+}
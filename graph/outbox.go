@@ -0,0 +1,452 @@
+package graph
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/metrics"
+	"github.com/SunSince90/ASTRID-kube/settings"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	outboxFile              = "outbox.json"
+	defaultOutboxMaxPending = 1000
+	defaultOutboxBackoff    = time.Second
+	maxOutboxBackoff        = 5 * time.Minute
+)
+
+// outbox keeps the data that must be delivered to each subscription, in order, until it is delivered.
+// It is saved on disk, so nothing is lost if ASTRID-kube restarts in the meantime.
+type outbox struct {
+	lock     sync.Mutex
+	path     string
+	sequence uint64
+	//	dirty is true when something changed since it was last saved on disk
+	dirty bool
+	//	saving makes sure that only one save at a time writes the file
+	saving sync.Mutex
+	queues map[outboxKey][]*outboxEntry
+	//	sent are the most recent events that were delivered, to be sent again if the subscription did not get them
+	sent map[outboxKey][]*outboxEntry
+	//	busy are the queues that are being delivered right now, and sending the entries on their way
+	busy    map[outboxKey]bool
+	sending map[outboxKey]uint64
+	//	stale are the queues that lost events, and need the infrastructure info again
+	stale map[outboxKey]bool
+	//	dispatchers wake up the goroutine that delivers the data of each graph
+	dispatchers map[string]chan struct{}
+	stop        chan struct{}
+}
+
+// outboxKey identifies the data of a graph for a subscription, which must be delivered in order
+type outboxKey struct {
+	graph string
+	sink  string
+}
+
+type outboxEntry struct {
+	ID          uint64 `json:"id"`
+	Graph       string `json:"graph"`
+	Sink        string `json:"sink"`
+	URL         string `json:"url"`
+	ContentType string `json:"contentType"`
+	Data        []byte `json:"data"`
+	Info        bool   `json:"info"`
+	//	Delivery and Last are the first and the last delivery of the events to the subscription
+	Delivery uint64    `json:"delivery,omitempty"`
+	Last     uint64    `json:"last,omitempty"`
+	Created  time.Time `json:"created"`
+	Attempts int       `json:"attempts"`
+	Next     time.Time `json:"next"`
+}
+
+var deliveries = newOutbox()
+
+func newOutbox() *outbox {
+	return &outbox{
+		queues:      map[outboxKey][]*outboxEntry{},
+		sent:        map[outboxKey][]*outboxEntry{},
+		busy:        map[outboxKey]bool{},
+		sending:     map[outboxKey]uint64{},
+		stale:       map[outboxKey]bool{},
+		dispatchers: map[string]chan struct{}{},
+	}
+}
+
+// load reads the data saved in the provided folder and starts delivering it
+func (o *outbox) load(folder string, stop chan struct{}) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.path = filepath.Join(folder, outboxFile)
+	o.stop = stop
+	entries := []*outboxEntry{}
+	data, err := ioutil.ReadFile(o.path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorln("Could not read outbox:", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			log.Errorln("Could not parse outbox:", err)
+		}
+	}
+	for _, entry := range entries {
+		key := outboxKey{graph: entry.Graph, sink: entry.Sink}
+		o.queues[key] = append(o.queues[key], entry)
+		if entry.ID > o.sequence {
+			o.sequence = entry.ID
+		}
+	}
+	for key := range o.queues {
+		o.updatePending(key)
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				o.save()
+				return
+			case <-ticker.C:
+				o.save()
+				o.retry()
+			}
+		}
+	}()
+}
+
+// save writes all pending data on disk, along with the sequences, if it changed since the last time.
+// It is called by the dispatchers and once a second, so that nobody queueing data waits for the disk.
+func (o *outbox) save() {
+	o.saving.Lock()
+	defer o.saving.Unlock()
+	defer counters.save()
+
+	o.lock.Lock()
+	if !o.dirty || len(o.path) < 1 {
+		o.lock.Unlock()
+		return
+	}
+	o.dirty = false
+	path := o.path
+	data, err := o.marshal()
+	o.lock.Unlock()
+
+	if err != nil {
+		log.Errorln("Could not marshal outbox:", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		log.Errorln("Could not save outbox:", err)
+		return
+	}
+
+	//	Write it in another file first, so a crash never leaves it half written
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		log.Errorln("Could not save outbox:", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		log.Errorln("Could not save outbox:", err)
+	}
+}
+
+// marshal encodes all pending data. It must be called with the lock held.
+func (o *outbox) marshal() ([]byte, error) {
+	//	Entries that are sent again are put back at the front, so they must be saved in the order of their queue
+	keys := []outboxKey{}
+	for key := range o.queues {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].graph != keys[j].graph {
+			return keys[i].graph < keys[j].graph
+		}
+		return keys[i].sink < keys[j].sink
+	})
+	entries := []*outboxEntry{}
+	for _, key := range keys {
+		entries = append(entries, o.queues[key]...)
+	}
+
+	return json.Marshal(entries)
+}
+
+// push queues data for a subscription, to be delivered by the dispatcher of its graph.
+// The infrastructure info replaces everything that is still waiting, as it already includes it.
+// When too many events are waiting, the oldest is dropped and the infrastructure info is going to be sent again.
+func (o *outbox) push(entry outboxEntry) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	key := outboxKey{graph: entry.Graph, sink: entry.Sink}
+	queue := o.queues[key]
+
+	switch {
+	case entry.Info:
+		queue = o.inFlight(key)
+		delete(o.stale, key)
+	case len(queue) >= o.maxPending():
+		//	Events keep coming until the infrastructure info is queued, so this is only logged once
+		if !o.stale[key] {
+			log.WithFields(log.Fields{"GRAPH": entry.Graph}).Errorf("Too many events waiting for %s, going to send the infrastructure info again", entry.Sink)
+		}
+		metrics.OutboxOverflows.WithLabelValues(entry.Graph, entry.Sink).Inc()
+		if oldest := len(o.inFlight(key)); oldest < len(queue) {
+			queue = append(queue[:oldest:oldest], queue[oldest+1:]...)
+		}
+		o.stale[key] = true
+	}
+
+	o.sequence++
+	entry.ID = o.sequence
+	if entry.Created.IsZero() {
+		entry.Created = time.Now()
+	}
+	o.queues[key] = append(queue, &entry)
+	o.updatePending(key)
+	o.dirty = true
+}
+
+// inFlight returns the part of a queue that cannot be dropped, as it is being delivered.
+// It must be called with the lock held.
+func (o *outbox) inFlight(key outboxKey) []*outboxEntry {
+	if queue := o.queues[key]; len(queue) > 0 && queue[0].ID == o.sending[key] {
+		return queue[:1]
+	}
+	return []*outboxEntry{}
+}
+
+// flush delivers the data waiting for a subscription, in order, until something cannot be delivered
+func (o *outbox) flush(graph, sinkID string) {
+	key := outboxKey{graph: graph, sink: sinkID}
+
+	o.lock.Lock()
+	if o.busy[key] {
+		o.lock.Unlock()
+		return
+	}
+	o.busy[key] = true
+	o.lock.Unlock()
+
+	idle := false
+	defer func() {
+		if idle {
+			return
+		}
+		o.lock.Lock()
+		delete(o.busy, key)
+		o.lock.Unlock()
+	}()
+
+	for {
+		o.lock.Lock()
+		queue := o.queues[key]
+		//	It stops being busy along with the check, or what is queued in the meantime could wait for the next retry
+		if len(queue) == 0 || queue[0].Next.After(time.Now()) {
+			delete(o.busy, key)
+			idle = true
+			o.lock.Unlock()
+			return
+		}
+		entry := queue[0]
+		o.sending[key] = entry.ID
+		o.lock.Unlock()
+
+		s, builder := subscriptions.get(sinkID), subscriptions.builder(graph)
+		if s == nil {
+			o.forget(key)
+			return
+		}
+		//	The policy can only be enforced by the graph, which needs to be running again after a restart
+		if s.policy && builder == nil {
+			return
+		}
+
+		delivered, missing := s.deliver(builder, entry)
+
+		o.lock.Lock()
+		delete(o.sending, key)
+		done := o.complete(key, entry, delivered, s.subscription.Retry.Attempts, s.subscription.Retry.Backoff)
+		o.lock.Unlock()
+
+		//	The subscription reported that it did not get some events before this one
+		if delivered && missing > 0 && !o.resend(key, missing, entry.Delivery) && builder != nil {
+			builder.resync(sinkID)
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// complete updates a queue after trying to deliver its first entry, which may have been replaced in the meantime.
+// It returns true if nothing else must be delivered for now. It must be called with the lock held.
+func (o *outbox) complete(key outboxKey, entry *outboxEntry, delivered bool, attempts, backoff int) bool {
+	defer o.updatePending(key)
+	o.dirty = true
+
+	queue := o.queues[key]
+	if len(queue) == 0 || queue[0].ID != entry.ID {
+		return !delivered
+	}
+	if delivered {
+		metrics.OutboxLatency.WithLabelValues(key.graph, key.sink).Observe(time.Since(entry.Created).Seconds())
+		o.pop(key)
+		//	Events sent again are already there
+		if sent := o.sent[key]; entry.Delivery > 0 && (len(sent) == 0 || entry.Delivery > sent[len(sent)-1].Last) {
+			o.sent[key] = append(sent, entry)
+			if len(o.sent[key]) > o.maxPending() {
+				o.sent[key] = append([]*outboxEntry{}, o.sent[key][len(o.sent[key])-o.maxPending():]...)
+			}
+		}
+		return false
+	}
+
+	entry.Attempts++
+	if attempts > 0 && entry.Attempts >= attempts {
+		log.WithFields(log.Fields{"GRAPH": key.graph}).Errorf("Giving up sending data to %s after %d attempts", key.sink, entry.Attempts)
+		delete(o.queues, key)
+		o.stale[key] = true
+		return true
+	}
+
+	wait := defaultOutboxBackoff
+	if backoff > 0 {
+		wait = time.Duration(backoff) * time.Second
+	}
+	for j := 1; j < entry.Attempts && wait < maxOutboxBackoff; j++ {
+		wait *= 2
+	}
+	if wait > maxOutboxBackoff {
+		wait = maxOutboxBackoff
+	}
+	entry.Next = time.Now().Add(wait)
+	return true
+}
+
+// resend puts the events that were delivered from a delivery up to another one, excluded, back at the front of a queue,
+// to be delivered before everything else. It returns false if some of them are not available anymore.
+// It must only be called while the queue is being flushed, so that nothing is in flight.
+func (o *outbox) resend(key outboxKey, from, to uint64) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if from >= to {
+		return true
+	}
+
+	queue := []*outboxEntry{}
+	next := from
+	for _, sent := range o.sent[key] {
+		if sent.Last < next || sent.Delivery >= to {
+			continue
+		}
+		if sent.Delivery > next {
+			break
+		}
+		entry := *sent
+		o.sequence++
+		entry.ID = o.sequence
+		entry.Created = time.Now()
+		entry.Attempts, entry.Next = 0, time.Time{}
+		queue = append(queue, &entry)
+		next = sent.Last + 1
+	}
+	if next < to {
+		return false
+	}
+
+	log.WithFields(log.Fields{"GRAPH": key.graph}).Infof("Sending events from %d to %d again to %s", from, to-1, key.sink)
+	o.queues[key] = append(queue, o.queues[key]...)
+	o.updatePending(key)
+	o.dirty = true
+	return true
+}
+
+// pop removes the first entry of a queue. It must be called with the lock held.
+func (o *outbox) pop(key outboxKey) {
+	o.queues[key] = o.queues[key][1:]
+	if len(o.queues[key]) == 0 {
+		delete(o.queues, key)
+	}
+}
+
+// forget drops all data waiting for a subscription
+func (o *outbox) forget(key outboxKey) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	delete(o.queues, key)
+	delete(o.sent, key)
+	delete(o.stale, key)
+	o.updatePending(key)
+	o.dirty = true
+}
+
+// forgetSink drops all data waiting for a subscription, in all graphs
+func (o *outbox) forgetSink(sinkID string) {
+	o.lock.Lock()
+	keys := []outboxKey{}
+	for key := range o.queues {
+		if key.sink == sinkID {
+			keys = append(keys, key)
+		}
+	}
+	for key := range o.stale {
+		if key.sink == sinkID {
+			keys = append(keys, key)
+		}
+	}
+	for key := range o.sent {
+		if key.sink == sinkID {
+			keys = append(keys, key)
+		}
+	}
+	o.lock.Unlock()
+
+	for _, key := range keys {
+		o.forget(key)
+	}
+}
+
+// retry wakes up the dispatchers of the graphs with data that could not be delivered before,
+// or that need to send the infrastructure info again
+func (o *outbox) retry() {
+	o.lock.Lock()
+	graphs := map[string]bool{}
+	for key := range o.queues {
+		graphs[key.graph] = true
+	}
+	for key := range o.stale {
+		graphs[key.graph] = true
+	}
+	o.lock.Unlock()
+
+	for graph := range graphs {
+		o.dispatch(graph)
+	}
+}
+
+// maxPending is how many entries can wait for the same subscription and graph
+func (o *outbox) maxPending() int {
+	if settings.Settings.Outbox.MaxPending > 0 {
+		return settings.Settings.Outbox.MaxPending
+	}
+	return defaultOutboxMaxPending
+}
+
+// updatePending updates the metric of what is waiting in a queue. It must be called with the lock held.
+func (o *outbox) updatePending(key outboxKey) {
+	metrics.OutboxPending.WithLabelValues(key.graph, key.sink).Set(float64(len(o.queues[key])))
+}
@@ -0,0 +1,276 @@
+package graph
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/settings"
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/stretchr/testify/assert"
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testOutbox(t *testing.T) (string, func()) {
+	folder, err := ioutil.TempDir("", "outbox")
+	assert.NoError(t, err)
+
+	registry, previous := subscriptions, deliveries
+	subscriptions = &subscriptionRegistry{sinks: map[string]*sink{}, builders: map[string]*InfrastructureInfoBuilder{}}
+	deliveries = newOutbox()
+	deliveries.path = filepath.Join(folder, outboxFile)
+	deliveries.stop = make(chan struct{})
+	counters.lock.Lock()
+	numbering, path := counters.state, counters.path
+	counters.state, counters.path = newCounterStore().state, filepath.Join(folder, countersFile)
+	counters.lock.Unlock()
+
+	return folder, func() {
+		close(deliveries.stop)
+		subscriptions, deliveries = registry, previous
+		counters.lock.Lock()
+		counters.state, counters.path = numbering, path
+		counters.lock.Unlock()
+		os.RemoveAll(folder)
+	}
+}
+
+// waitFor waits a second at most for a condition to be true
+func waitFor(t *testing.T, condition func() bool) {
+	for j := 0; j < 100 && !condition(); j++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, condition())
+}
+
+func isStale(key outboxKey) bool {
+	deliveries.lock.Lock()
+	defer deliveries.lock.Unlock()
+
+	return deliveries.stale[key]
+}
+
+func TestOutboxRetries(t *testing.T) {
+	folder, restore := testOutbox(t)
+	defer restore()
+
+	server, toSIEM := testSink(http.StatusServiceUnavailable, http.StatusOK, http.StatusOK)
+	defer server.Close()
+	subscriptions.sinks["siem"] = newSink(types.Subscription{ID: "siem", URL: server.URL, Format: types.JSON})
+
+	deliveries.push(outboxEntry{Graph: "mygraph", Sink: "siem", URL: server.URL + "/first", Data: []byte("{}")})
+	deliveries.push(outboxEntry{Graph: "mygraph", Sink: "siem", URL: server.URL + "/second", Data: []byte("{}")})
+	deliveries.flush("mygraph", "siem")
+	assert.Equal(t, "/first", receive(t, toSIEM).path)
+
+	//	The first one failed, so nothing else is sent until it is its time again
+	key := outboxKey{graph: "mygraph", sink: "siem"}
+	assert.Len(t, deliveries.queues[key], 2)
+	assert.Equal(t, 1, deliveries.queues[key][0].Attempts)
+	assert.True(t, deliveries.queues[key][0].Next.After(time.Now()))
+
+	//	and it survives a restart, once saved
+	deliveries.save()
+	restarted := newOutbox()
+	stop := make(chan struct{})
+	close(stop)
+	restarted.load(folder, stop)
+	assert.Len(t, restarted.queues[key], 2)
+	assert.Equal(t, uint64(2), restarted.sequence)
+
+	deliveries.queues[key][0].Next = time.Time{}
+	deliveries.flush("mygraph", "siem")
+	assert.Equal(t, "/first", receive(t, toSIEM).path)
+	assert.Equal(t, "/second", receive(t, toSIEM).path)
+	assert.Empty(t, deliveries.queues)
+}
+
+func TestOutboxResync(t *testing.T) {
+	_, restore := testOutbox(t)
+	defer restore()
+
+	server, toSIEM := testSink(http.StatusServiceUnavailable)
+	defer server.Close()
+	subscriptions.load(types.VerekubeEndPoints{}, types.Formats{}, []types.Subscription{{ID: "siem", URL: server.URL, Format: types.JSON, Retry: types.RetryPolicy{Attempts: 1}}})
+
+	builder := newBuilder(fake.NewSimpleClientset(), "mygraph", types.DirectEnforcement)
+	builder.EnableSending()
+	receive(t, toSIEM)
+
+	//	The info could not be delivered, so it needs to be sent again
+	key := outboxKey{graph: "mygraph", sink: "siem"}
+	waitFor(t, func() bool { return isStale(key) })
+	builder.PushInstance("apache", "10.0.0.1", "apache-1")
+
+	deliveries.retry()
+	d := receive(t, toSIEM)
+	assert.Contains(t, string(d.body), "\"kind\"")
+	waitFor(t, func() bool { return !isStale(key) })
+}
+
+func TestOutboxOverflow(t *testing.T) {
+	_, restore := testOutbox(t)
+	defer restore()
+	defer func(outbox types.Outbox) { settings.Settings.Outbox = outbox }(settings.Settings.Outbox)
+	settings.Settings.Outbox = types.Outbox{MaxPending: 1, Overflow: types.DropOldest}
+
+	//	The oldest event is dropped, and the info is going to be sent again
+	key := outboxKey{graph: "mygraph", sink: "siem"}
+	deliveries.push(outboxEntry{Graph: "mygraph", Sink: "siem", Data: []byte("first")})
+	deliveries.push(outboxEntry{Graph: "mygraph", Sink: "siem", Data: []byte("second")})
+	assert.True(t, deliveries.stale[key])
+	assert.Len(t, deliveries.queues[key], 1)
+	assert.Equal(t, []byte("second"), deliveries.queues[key][0].Data)
+
+	//	Events are still queued until the info is, each one dropping the oldest
+	deliveries.push(outboxEntry{Graph: "mygraph", Sink: "siem", Data: []byte("third")})
+	assert.True(t, deliveries.stale[key])
+	assert.Len(t, deliveries.queues[key], 1)
+	assert.Equal(t, []byte("third"), deliveries.queues[key][0].Data)
+
+	//	Nothing is written on disk until the outbox is saved
+	_, err := os.Stat(deliveries.path)
+	assert.True(t, os.IsNotExist(err))
+	deliveries.save()
+	_, err = os.Stat(deliveries.path)
+	assert.NoError(t, err)
+
+	//	The info replaces the events
+	settings.Settings.Outbox.Overflow = types.Coalesce
+	s := newSink(types.Subscription{ID: "siem", URL: "http://siem", Format: types.JSON})
+	builder := newBuilder(fake.NewSimpleClientset(), "mygraph", types.DirectEnforcement).(*InfrastructureInfoBuilder)
+	builder.lock.Lock()
+	builder.queue(s, types.InfrastructureEvent{Type: types.New}, false)
+	builder.lock.Unlock()
+	assert.False(t, deliveries.stale[key])
+	assert.Len(t, deliveries.queues[key], 1)
+	assert.True(t, deliveries.queues[key][0].Info)
+}
+
+func TestOutboxMissingDelivery(t *testing.T) {
+	_, restore := testOutbox(t)
+	defer restore()
+
+	received := make(chan types.InfrastructureEvent, 10)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := ioutil.ReadAll(r.Body)
+		if requests == 1 {
+			return
+		}
+		event := types.InfrastructureEvent{}
+		json.Unmarshal(body, &event)
+		//	The first event got lost
+		if event.Delivery == 2 && requests == 3 {
+			w.Header().Set(types.MissingDeliveryHeader, "1")
+		}
+		received <- event
+	}))
+	defer server.Close()
+	subscriptions.load(types.VerekubeEndPoints{}, types.Formats{}, []types.Subscription{{ID: "siem", URL: server.URL, Format: types.JSON}})
+
+	builder := newBuilder(fake.NewSimpleClientset(), "gaps", types.DirectEnforcement)
+	builder.PushService("apache", &core_v1.ServiceSpec{}, []string{"firewall"})
+	builder.EnableSending()
+	builder.PushInstance("apache", "10.0.0.1", "apache-1")
+	builder.PushInstance("apache", "10.0.0.2", "apache-2")
+
+	sequences, delivered := []uint64{}, []uint64{}
+	for j := 0; j < 3; j++ {
+		select {
+		case event := <-received:
+			sequences, delivered = append(sequences, event.Sequence), append(delivered, event.Delivery)
+			assert.Equal(t, "gaps", event.GraphName)
+		case <-time.After(time.Second):
+			t.Fatal("Nothing was delivered")
+		}
+	}
+	assert.Equal(t, []uint64{1, 2, 1}, sequences)
+	assert.Equal(t, []uint64{1, 2, 1}, delivered)
+	assert.Equal(t, uint64(2), builder.Info().Metadata.Sequence)
+}
+
+func TestSubscriptionDeliveries(t *testing.T) {
+	folder, restore := testOutbox(t)
+	defer restore()
+
+	server, toSIEM := testSink()
+	defer server.Close()
+	subscriptions.load(types.VerekubeEndPoints{}, types.Formats{}, []types.Subscription{{ID: "siem", URL: server.URL, Format: types.JSON, Filter: types.SubscriptionFilter{EventTypes: []types.InfrastructureEventType{types.Delete}}}})
+
+	builder := newBuilder(fake.NewSimpleClientset(), "filtered", types.DirectEnforcement)
+	builder.PushService("apache", &core_v1.ServiceSpec{}, []string{"firewall"})
+	builder.EnableSending()
+	receive(t, toSIEM)
+
+	//	Events the subscription does not want are not counted in its deliveries, while they are in the sequence of the graph
+	builder.PushInstance("apache", "10.0.0.1", "apache-1")
+	builder.PopInstance("apache-1")
+	event := types.InfrastructureEvent{}
+	assert.NoError(t, json.Unmarshal(receive(t, toSIEM).body, &event))
+	assert.Equal(t, types.Delete, event.Type)
+	assert.Equal(t, uint64(2), event.Sequence)
+	assert.Equal(t, uint64(1), event.Delivery)
+	assert.Equal(t, uint64(2), builder.Info().Metadata.Sequence)
+	assert.Zero(t, builder.Info().Metadata.Delivery)
+
+	//	The infrastructure info tells the last event the subscription got
+	key := outboxKey{graph: "filtered", sink: "siem"}
+	builder.(*InfrastructureInfoBuilder).resync("siem")
+	deliveries.flush("filtered", "siem")
+	info := types.InfrastructureInfo{}
+	assert.NoError(t, json.Unmarshal(receive(t, toSIEM).body, &info))
+	assert.Equal(t, uint64(2), info.Metadata.Sequence)
+	assert.Equal(t, uint64(1), info.Metadata.Delivery)
+
+	//	Events that were delivered can be sent again, the others cannot
+	assert.False(t, deliveries.resend(key, 1, 3))
+	assert.True(t, deliveries.resend(key, 1, 2))
+	deliveries.flush("filtered", "siem")
+	event = types.InfrastructureEvent{}
+	assert.NoError(t, json.Unmarshal(receive(t, toSIEM).body, &event))
+	assert.Equal(t, uint64(2), event.Sequence)
+	assert.Equal(t, uint64(1), event.Delivery)
+
+	//	Sequences and deliveries go on after a restart
+	deliveries.save()
+	restarted := newCounterStore()
+	restarted.load(folder)
+	metadata := builder.Info().Metadata
+	assert.Equal(t, graphCounters{Sequence: metadata.Sequence, Revision: metadata.Revision}, restarted.graph("filtered"))
+	assert.Equal(t, uint64(2), restarted.next("filtered", "siem"))
+	assert.Equal(t, metadata.Revision, newBuilder(fake.NewSimpleClientset(), "filtered", types.DirectEnforcement).Info().Metadata.Revision)
+}
+
+func TestOutboxSlowSink(t *testing.T) {
+	_, restore := testOutbox(t)
+	defer restore()
+
+	//	The first subscription does not answer until the end of the test
+	blocked := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-blocked
+	}))
+	defer slow.Close()
+	defer close(blocked)
+	server, toSIEM := testSink()
+	defer server.Close()
+	subscriptions.load(types.VerekubeEndPoints{}, types.Formats{}, []types.Subscription{
+		{ID: "archive", URL: slow.URL, Format: types.JSON},
+		{ID: "siem", URL: server.URL, Format: types.JSON},
+	})
+
+	builder := newBuilder(fake.NewSimpleClientset(), "mygraph", types.DirectEnforcement)
+	builder.PushService("apache", &core_v1.ServiceSpec{}, []string{"firewall"})
+	builder.EnableSending()
+	receive(t, toSIEM)
+	builder.PushInstance("apache", "10.0.0.1", "apache-1")
+	receive(t, toSIEM)
+}
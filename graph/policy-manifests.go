@@ -0,0 +1,307 @@
+package graph
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	log "github.com/sirupsen/logrus"
+	core_v1 "k8s.io/api/core/v1"
+	networking_v1 "k8s.io/api/networking/v1"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "astrid-kube"
+	//	policyManifestPrefix is put before the name of the service in the NetworkPolicy that protects it
+	policyManifestPrefix = "astrid-"
+)
+
+// applyPolicyManifests enforces a policy by creating a NetworkPolicy for each service it mentions
+func (handler *InfrastructureHandler) applyPolicyManifests(policy types.Policy) {
+	handler.lock.Lock()
+	selectors := map[string]map[string]string{}
+	for deployment, selector := range handler.selectors {
+		selectors[deployment] = selector
+	}
+	handler.lock.Unlock()
+
+	manifests, err := policyManifests(policy, handler.name, selectors)
+	if err != nil {
+		handler.log.Errorf("Rejected policy version %s, as it cannot be enforced with NetworkPolicies: %s", policy.Version, err)
+		return
+	}
+	if err := syncPolicyManifests(handler.clientset, handler.name, manifests); err != nil {
+		handler.log.Errorln("Could not enforce policy with NetworkPolicies:", err)
+		return
+	}
+	handler.log.Infof("Enforced policy version %s with %d NetworkPolicies", policy.Version, len(manifests))
+
+	services := map[string]bool{}
+	for _, rule := range policy.Rules {
+		services[rule.Service] = true
+	}
+
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	for pod := range handler.unprotected {
+		if services[strings.Split(pod, "-")[0]] {
+			handler.infoBuilder.SetPolicyVersion(pod, policy.Version)
+		}
+	}
+}
+
+// policyManifests translates a policy into one NetworkPolicy for each service it mentions.
+// Selectors are the labels selecting the pods of each service.
+// Services in the policy have both directions isolated, as the policy describes all the traffic they can have.
+// NetworkPolicies can only allow traffic: as in firewalls, a rule that drops traffic takes precedence over
+// the rules after it, so it becomes an exception of the addresses they allow, or removes them if it includes them all.
+// An error is returned if a rule that drops traffic cannot be translated this way.
+func policyManifests(policy types.Policy, namespace string, selectors map[string]map[string]string) ([]networking_v1.NetworkPolicy, error) {
+	manifests := map[string]*networking_v1.NetworkPolicy{}
+
+	for j, rule := range policy.Rules {
+		selector, exists := selectors[rule.Service]
+		if !exists {
+			log.Errorf("Could not find the pods of service %s, going to skip its rule", rule.Service)
+			continue
+		}
+
+		manifest, exists := manifests[rule.Service]
+		if !exists {
+			manifest = &networking_v1.NetworkPolicy{
+				ObjectMeta: meta_v1.ObjectMeta{
+					Name:      policyManifestPrefix + rule.Service,
+					Namespace: namespace,
+					Labels:    map[string]string{managedByLabel: managedByValue},
+				},
+				Spec: networking_v1.NetworkPolicySpec{
+					PodSelector: meta_v1.LabelSelector{MatchLabels: selector},
+					PolicyTypes: []networking_v1.PolicyType{networking_v1.PolicyTypeIngress, networking_v1.PolicyTypeEgress},
+					Ingress:     []networking_v1.NetworkPolicyIngressRule{},
+					Egress:      []networking_v1.NetworkPolicyEgressRule{},
+				},
+			}
+			manifests[rule.Service] = manifest
+		}
+
+		if strings.ToLower(rule.Action) != "forward" {
+			continue
+		}
+
+		//	The other end of the traffic: no peers means any address
+		peers := []networking_v1.NetworkPolicyPeer{}
+		switch {
+		case len(rule.Peer) > 0:
+			//	An empty selector would select all pods: better to allow nothing
+			peerSelector, exists := selectors[rule.Peer]
+			if !exists {
+				log.Errorf("Could not find the pods of service %s, going to skip its rule", rule.Peer)
+				continue
+			}
+			peers = append(peers, networking_v1.NetworkPolicyPeer{
+				PodSelector: &meta_v1.LabelSelector{MatchLabels: peerSelector},
+			})
+		case len(rule.IP) > 0:
+			peers = append(peers, networking_v1.NetworkPolicyPeer{
+				IPBlock: &networking_v1.IPBlock{CIDR: cidr(rule.IP)},
+			})
+		}
+
+		//	Rules that drop this traffic before it is forwarded
+		shadowed := false
+		for _, drop := range policy.Rules[:j] {
+			if strings.ToLower(drop.Action) != "drop" || drop.Service != rule.Service || !strings.EqualFold(drop.Direction, rule.Direction) {
+				continue
+			}
+			excluded, all, err := applyDrop(drop, rule, peers)
+			if err != nil {
+				return nil, err
+			}
+			peers = excluded
+			shadowed = shadowed || all
+		}
+		if shadowed {
+			continue
+		}
+
+		ports := []networking_v1.NetworkPolicyPort{}
+		if protocol, port := ruleProtocol(rule); len(protocol) > 0 {
+			policyProtocol := core_v1.Protocol(protocol)
+			policyPort := networking_v1.NetworkPolicyPort{Protocol: &policyProtocol}
+			if port > 0 {
+				value := intstr.FromInt(int(port))
+				policyPort.Port = &value
+			}
+			ports = append(ports, policyPort)
+		}
+
+		switch strings.ToLower(rule.Direction) {
+		case "ingress":
+			manifest.Spec.Ingress = append(manifest.Spec.Ingress, networking_v1.NetworkPolicyIngressRule{From: peers, Ports: ports})
+		case "egress":
+			manifest.Spec.Egress = append(manifest.Spec.Egress, networking_v1.NetworkPolicyEgressRule{To: peers, Ports: ports})
+		}
+	}
+
+	names := []string{}
+	for name := range manifests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := []networking_v1.NetworkPolicy{}
+	for _, name := range names {
+		list = append(list, *manifests[name])
+	}
+	return list, nil
+}
+
+// ruleProtocol returns the protocol and port of a rule, where an empty protocol is any:
+// as in NetworkPolicies, a port without a protocol is a TCP one
+func ruleProtocol(rule types.PolicyRule) (string, int32) {
+	protocol := strings.ToUpper(rule.Protocol)
+	if len(protocol) == 0 && rule.Port > 0 {
+		protocol = string(core_v1.ProtocolTCP)
+	}
+	return protocol, rule.Port
+}
+
+// applyDrop makes the peers of a rule that forwards traffic exclude what a previous rule drops, and returns them.
+// It returns true if the rule drops all the traffic the other one forwards, and an error if it drops only part of it
+// and that cannot be expressed by a NetworkPolicy.
+func applyDrop(drop, forward types.PolicyRule, peers []networking_v1.NetworkPolicyPeer) ([]networking_v1.NetworkPolicyPeer, bool, error) {
+	dropProtocol, dropPort := ruleProtocol(drop)
+	forwardProtocol, forwardPort := ruleProtocol(forward)
+	covers := func(protocol string, port int32, otherProtocol string, otherPort int32) bool {
+		return (len(protocol) == 0 || protocol == otherProtocol) && (port == 0 || port == otherPort)
+	}
+	allPorts := covers(dropProtocol, dropPort, forwardProtocol, forwardPort)
+	if !allPorts && !covers(forwardProtocol, forwardPort, dropProtocol, dropPort) {
+		//	They are about different ports
+		return peers, false, nil
+	}
+	cannot := errors.New("rule dropping the " + strings.ToLower(drop.Direction) + " traffic of " + drop.Service + " with " + policyPeer(drop) +
+		" cannot be expressed along with the one forwarding it with " + policyPeer(forward))
+
+	switch {
+	//	Any address
+	case len(drop.Peer) == 0 && len(drop.IP) == 0:
+		if !allPorts {
+			return peers, false, cannot
+		}
+		return peers, true, nil
+
+	//	As in NetworkPolicies, addresses in ranges are not the ones of the pods of services
+	case len(drop.Peer) > 0 && len(forward.IP) > 0, len(drop.IP) > 0 && len(forward.Peer) > 0:
+		return peers, false, nil
+
+	case len(drop.Peer) > 0:
+		if len(forward.Peer) > 0 && forward.Peer != drop.Peer {
+			return peers, false, nil
+		}
+		//	Pods cannot be excluded from any address
+		if len(forward.Peer) == 0 || !allPorts {
+			return peers, false, cannot
+		}
+		return peers, true, nil
+	}
+
+	dropped, err := parseBlock(cidr(drop.IP))
+	if err != nil {
+		return peers, false, err
+	}
+	if len(peers) == 0 {
+		peers = append(peers, networking_v1.NetworkPolicyPeer{IPBlock: &networking_v1.IPBlock{CIDR: "0.0.0.0/0"}})
+	}
+	block := peers[0].IPBlock
+	allowed, err := parseBlock(block.CIDR)
+	if err != nil {
+		return peers, false, err
+	}
+
+	switch {
+	case dropped.contains(allowed):
+		if !allPorts {
+			return peers, false, cannot
+		}
+		return peers, true, nil
+	case allowed.contains(dropped):
+		if !allPorts {
+			return peers, false, cannot
+		}
+		block.Except = append(block.Except, dropped.network.String())
+	}
+	return peers, false, nil
+}
+
+// policyPeer describes the other end of the traffic of a rule
+func policyPeer(rule types.PolicyRule) string {
+	switch {
+	case len(rule.Peer) > 0:
+		return "service " + rule.Peer
+	case len(rule.IP) > 0:
+		return rule.IP
+	}
+	return "any address"
+}
+
+// cidr returns the range including only the provided address, unless it is a range already
+func cidr(ip string) string {
+	if strings.Contains(ip, "/") {
+		return ip
+	}
+	if strings.Contains(ip, ":") {
+		return ip + "/128"
+	}
+	return ip + "/32"
+}
+
+// syncPolicyManifests makes the NetworkPolicies managed by ASTRID-kube in a namespace be the provided ones:
+// missing ones are created, changed ones are updated and the others are deleted.
+func syncPolicyManifests(clientset kubernetes.Interface, namespace string, manifests []networking_v1.NetworkPolicy) error {
+	client := clientset.NetworkingV1().NetworkPolicies(namespace)
+
+	existing, err := client.List(meta_v1.ListOptions{LabelSelector: managedByLabel + "=" + managedByValue})
+	if err != nil {
+		return err
+	}
+	current := map[string]networking_v1.NetworkPolicy{}
+	for _, manifest := range existing.Items {
+		current[manifest.Name] = manifest
+	}
+
+	for _, manifest := range manifests {
+		old, exists := current[manifest.Name]
+		delete(current, manifest.Name)
+
+		if !exists {
+			if _, err := client.Create(&manifest); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if reflect.DeepEqual(old.Spec, manifest.Spec) {
+			continue
+		}
+		old.Spec = manifest.Spec
+		if _, err := client.Update(&old); err != nil {
+			return err
+		}
+	}
+
+	for name := range current {
+		if err := client.Delete(name, &meta_v1.DeleteOptions{}); err != nil && !k8s_errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
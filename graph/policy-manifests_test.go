@@ -0,0 +1,153 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/stretchr/testify/assert"
+	core_v1 "k8s.io/api/core/v1"
+	networking_v1 "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPolicyManifests(t *testing.T) {
+	selectors := map[string]map[string]string{
+		"apache": {"app": "apache"},
+		"nodejs": {"app": "nodejs"},
+	}
+	policy := types.Policy{
+		Version: "1",
+		Rules: []types.PolicyRule{
+			{Service: "apache", Direction: "ingress", Action: "FORWARD", Peer: "nodejs", Protocol: "tcp", Port: 80},
+			{Service: "nodejs", Direction: "egress", Action: "forward", IP: "1.2.3.4", Protocol: "udp", Port: 53},
+			{Service: "nodejs", Direction: "ingress", Action: "drop", IP: "5.6.7.8"},
+			{Service: "redis", Direction: "ingress", Action: "forward"},
+		},
+	}
+
+	manifests, err := policyManifests(policy, "graph", selectors)
+	assert.NoError(t, err)
+	assert.Len(t, manifests, 2)
+
+	tcp, udp := core_v1.ProtocolTCP, core_v1.ProtocolUDP
+	port80, port53 := intstr.FromInt(80), intstr.FromInt(53)
+
+	apache := manifests[0]
+	assert.Equal(t, "astrid-apache", apache.Name)
+	assert.Equal(t, managedByValue, apache.Labels[managedByLabel])
+	assert.Equal(t, map[string]string{"app": "apache"}, apache.Spec.PodSelector.MatchLabels)
+	assert.Equal(t, []networking_v1.NetworkPolicyIngressRule{{
+		From:  []networking_v1.NetworkPolicyPeer{{PodSelector: &meta_v1.LabelSelector{MatchLabels: map[string]string{"app": "nodejs"}}}},
+		Ports: []networking_v1.NetworkPolicyPort{{Protocol: &tcp, Port: &port80}},
+	}}, apache.Spec.Ingress)
+	assert.Empty(t, apache.Spec.Egress)
+
+	//	Drop rules are implied, but the service is still isolated
+	nodejs := manifests[1]
+	assert.Empty(t, nodejs.Spec.Ingress)
+	assert.Equal(t, []networking_v1.NetworkPolicyEgressRule{{
+		To:    []networking_v1.NetworkPolicyPeer{{IPBlock: &networking_v1.IPBlock{CIDR: "1.2.3.4/32"}}},
+		Ports: []networking_v1.NetworkPolicyPort{{Protocol: &udp, Port: &port53}},
+	}}, nodejs.Spec.Egress)
+}
+
+func TestPolicyManifestsDrop(t *testing.T) {
+	selectors := map[string]map[string]string{
+		"apache": {"app": "apache"},
+		"nodejs": {"app": "nodejs"},
+	}
+	tcp := core_v1.ProtocolTCP
+	port80 := intstr.FromInt(80)
+	ingress := func(rules ...types.PolicyRule) []networking_v1.NetworkPolicyIngressRule {
+		manifests, err := policyManifests(types.Policy{Rules: rules}, "graph", selectors)
+		assert.NoError(t, err)
+		return manifests[0].Spec.Ingress
+	}
+
+	//	A drop becomes an exception of the addresses forwarded after it
+	assert.Equal(t, []networking_v1.NetworkPolicyIngressRule{{
+		From:  []networking_v1.NetworkPolicyPeer{{IPBlock: &networking_v1.IPBlock{CIDR: "0.0.0.0/0", Except: []string{"5.6.7.8/32"}}}},
+		Ports: []networking_v1.NetworkPolicyPort{},
+	}}, ingress(
+		types.PolicyRule{Service: "apache", Direction: "ingress", Action: "drop", IP: "5.6.7.8"},
+		types.PolicyRule{Service: "apache", Direction: "ingress", Action: "forward"},
+	))
+	assert.Equal(t, []networking_v1.NetworkPolicyIngressRule{{
+		From:  []networking_v1.NetworkPolicyPeer{{IPBlock: &networking_v1.IPBlock{CIDR: "5.0.0.0/8", Except: []string{"5.6.0.0/16"}}}},
+		Ports: []networking_v1.NetworkPolicyPort{{Protocol: &tcp, Port: &port80}},
+	}}, ingress(
+		types.PolicyRule{Service: "apache", Direction: "ingress", Action: "drop", IP: "5.6.0.0/16", Protocol: "tcp"},
+		types.PolicyRule{Service: "apache", Direction: "ingress", Action: "forward", IP: "5.0.0.0/8", Port: 80},
+	))
+
+	//	or removes them if it includes all of them
+	assert.Empty(t, ingress(
+		types.PolicyRule{Service: "apache", Direction: "ingress", Action: "drop", Peer: "nodejs"},
+		types.PolicyRule{Service: "apache", Direction: "ingress", Action: "forward", Peer: "nodejs", Port: 80},
+		types.PolicyRule{Service: "apache", Direction: "ingress", Action: "drop"},
+		types.PolicyRule{Service: "apache", Direction: "ingress", Action: "forward", IP: "1.2.3.4"},
+	))
+
+	//	Drops of other services, directions and ports, or after the forward, do not change it
+	assert.Equal(t, []networking_v1.NetworkPolicyIngressRule{{
+		From:  []networking_v1.NetworkPolicyPeer{{PodSelector: &meta_v1.LabelSelector{MatchLabels: map[string]string{"app": "nodejs"}}}},
+		Ports: []networking_v1.NetworkPolicyPort{{Protocol: &tcp, Port: &port80}},
+	}}, ingress(
+		types.PolicyRule{Service: "nodejs", Direction: "ingress", Action: "drop"},
+		types.PolicyRule{Service: "apache", Direction: "egress", Action: "drop"},
+		types.PolicyRule{Service: "apache", Direction: "ingress", Action: "drop", Port: 443},
+		types.PolicyRule{Service: "apache", Direction: "ingress", Action: "drop", IP: "5.6.7.8"},
+		types.PolicyRule{Service: "apache", Direction: "ingress", Action: "forward", Peer: "nodejs", Port: 80},
+		types.PolicyRule{Service: "apache", Direction: "ingress", Action: "drop", Peer: "nodejs"},
+	))
+
+	//	Drops that cannot be expressed make the whole policy rejected
+	for _, rules := range [][]types.PolicyRule{
+		{
+			{Service: "apache", Direction: "ingress", Action: "drop", IP: "5.6.7.8", Port: 22},
+			{Service: "apache", Direction: "ingress", Action: "forward"},
+		},
+		{
+			{Service: "apache", Direction: "ingress", Action: "drop", Peer: "nodejs"},
+			{Service: "apache", Direction: "ingress", Action: "forward"},
+		},
+	} {
+		_, err := policyManifests(types.Policy{Rules: rules}, "graph", selectors)
+		assert.Error(t, err)
+	}
+}
+
+func TestSyncPolicyManifests(t *testing.T) {
+	unmanaged := &networking_v1.NetworkPolicy{ObjectMeta: meta_v1.ObjectMeta{Name: "users", Namespace: "graph"}}
+	stale := &networking_v1.NetworkPolicy{ObjectMeta: meta_v1.ObjectMeta{
+		Name:      "astrid-redis",
+		Namespace: "graph",
+		Labels:    map[string]string{managedByLabel: managedByValue},
+	}}
+	clientset := fake.NewSimpleClientset(unmanaged, stale)
+
+	selectors := map[string]map[string]string{"apache": {"app": "apache"}}
+	policy := types.Policy{Rules: []types.PolicyRule{{Service: "apache", Direction: "ingress", Action: "forward", Port: 80}}}
+	manifests, err := policyManifests(policy, "graph", selectors)
+	assert.NoError(t, err)
+	assert.NoError(t, syncPolicyManifests(clientset, "graph", manifests))
+
+	list, err := clientset.NetworkingV1().NetworkPolicies("graph").List(meta_v1.ListOptions{})
+	assert.NoError(t, err)
+	names := []string{}
+	for _, manifest := range list.Items {
+		names = append(names, manifest.Name)
+	}
+	assert.ElementsMatch(t, []string{"users", "astrid-apache"}, names)
+
+	//	Changes are applied to the existing one
+	policy.Rules[0].Port = 8080
+	manifests, err = policyManifests(policy, "graph", selectors)
+	assert.NoError(t, err)
+	assert.NoError(t, syncPolicyManifests(clientset, "graph", manifests))
+	manifest, err := clientset.NetworkingV1().NetworkPolicies("graph").Get("astrid-apache", meta_v1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(8080), manifest.Spec.Ingress[0].Ports[0].Port.IntVal)
+}
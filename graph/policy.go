@@ -0,0 +1,111 @@
+package graph
+
+import (
+	"strings"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
+)
+
+// handlePolicy enforces a policy received from verekube in all firewalls of the graph
+func (handler *InfrastructureHandler) handlePolicy(policy types.Policy) {
+	handler.policyLock.Lock()
+	handler.policy = &policy
+	handler.policyLock.Unlock()
+
+	handler.log.Infof("Received policy version %s with %d rules", policy.Version, len(policy.Rules))
+	if handler.enforcement == types.NetworkPolicyEnforcement {
+		handler.applyPolicyManifests(policy)
+		return
+	}
+	handler.enforcePolicy()
+}
+
+// enforcePolicy computes again the rules of the current policy and pushes them to all firewalls.
+// It must be called whenever instances change, as rules depend on their addresses.
+func (handler *InfrastructureHandler) enforcePolicy() {
+	handler.policyLock.Lock()
+	defer handler.policyLock.Unlock()
+
+	if handler.policy == nil {
+		return
+	}
+
+	tracked := handler.reconciler.tracked()
+	for pod, directions := range policyRules(*handler.policy, tracked) {
+		failed := false
+		for direction, rules := range directions {
+			if err := handler.reconciler.setRules(ruleSourcePolicy, pod, direction, rules); err != nil {
+				handler.log.Errorf("Could not enforce policy in %s of %s: %s", direction, pod, err)
+				failed = true
+			}
+		}
+
+		if !failed {
+			handler.infoBuilder.SetPolicyVersion(pod, handler.policy.Version)
+		}
+	}
+}
+
+// policyRules translates a policy into the rules of each instance of the services it mentions, by direction.
+// Instances are the ones protected by a firewall, with their addresses and services, by pod name.
+func policyRules(policy types.Policy, instances map[string]desiredFirewall) map[string]map[string][]k8sfirewall.ChainRule {
+	ipsOf := map[string][]string{}
+	for _, instance := range instances {
+		ipsOf[instance.service] = append(ipsOf[instance.service], instance.ip)
+	}
+
+	//	Services in the policy get both directions declared, even when empty,
+	//	as the policy describes all the traffic they can have
+	rules := map[string]map[string][]k8sfirewall.ChainRule{}
+	for pod, instance := range instances {
+		for _, rule := range policy.Rules {
+			if rule.Service == instance.service {
+				rules[pod] = map[string][]k8sfirewall.ChainRule{
+					"ingress": []k8sfirewall.ChainRule{},
+					"egress":  []k8sfirewall.ChainRule{},
+				}
+				break
+			}
+		}
+	}
+
+	for _, rule := range policy.Rules {
+		direction := strings.ToLower(rule.Direction)
+		if direction != "ingress" && direction != "egress" {
+			continue
+		}
+
+		//	The other end of the traffic: no peers means any address
+		peers := []string{""}
+		switch {
+		case len(rule.Peer) > 0:
+			peers = ipsOf[rule.Peer]
+		case len(rule.IP) > 0:
+			peers = []string{rule.IP}
+		}
+
+		for pod, instance := range instances {
+			if instance.service != rule.Service {
+				continue
+			}
+
+			for _, peer := range peers {
+				chainRule := k8sfirewall.ChainRule{
+					Action:  strings.ToLower(rule.Action),
+					L4proto: strings.ToUpper(rule.Protocol),
+					Dport:   rule.Port,
+				}
+				if direction == "ingress" {
+					chainRule.Src, chainRule.Dst = peer, instance.ip
+				} else {
+					chainRule.Src, chainRule.Dst = instance.ip, peer
+				}
+
+				rules[pod][direction] = append(rules[pod][direction], chainRule)
+			}
+		}
+	}
+
+	return rules
+}
@@ -0,0 +1,37 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyRules(t *testing.T) {
+	instances := map[string]desiredFirewall{
+		"apache-1": {ip: "10.0.0.1", service: "apache"},
+		"apache-2": {ip: "10.0.0.2", service: "apache"},
+		"nodejs-1": {ip: "10.0.0.3", service: "nodejs"},
+		"redis-1":  {ip: "10.0.0.4", service: "redis"},
+	}
+	policy := types.Policy{
+		Version: "1",
+		Rules: []types.PolicyRule{
+			{Service: "apache", Direction: "ingress", Action: "FORWARD", Peer: "nodejs", Protocol: "tcp", Port: 80},
+			{Service: "nodejs", Direction: "egress", Action: "forward", Peer: "apache", Protocol: "tcp", Port: 80},
+			{Service: "nodejs", Direction: "ingress", Action: "drop", IP: "1.2.3.4"},
+		},
+	}
+
+	rules := policyRules(policy, instances)
+
+	assert.Equal(t, []k8sfirewall.ChainRule{{Src: "10.0.0.3", Dst: "10.0.0.1", L4proto: "TCP", Dport: 80, Action: "forward"}}, rules["apache-1"]["ingress"])
+	assert.Empty(t, rules["apache-1"]["egress"])
+	assert.Len(t, rules["nodejs-1"]["egress"], 2)
+	assert.Equal(t, []k8sfirewall.ChainRule{{Src: "1.2.3.4", Dst: "10.0.0.3", Action: "drop"}}, rules["nodejs-1"]["ingress"])
+
+	//	Services not in the policy are not touched
+	_, exists := rules["redis-1"]
+	assert.False(t, exists)
+}
@@ -0,0 +1,77 @@
+package graph
+
+import (
+	"strconv"
+
+	"github.com/SunSince90/ASTRID-kube/settings"
+	log "github.com/sirupsen/logrus"
+	core_v1 "k8s.io/api/core/v1"
+)
+
+const (
+	polycubePortAnnotation = "astrid.io/polycube-port"
+	interfaceAnnotation    = "astrid.io/interface"
+	firewallNameAnnotation = "astrid.io/firewall-name"
+	defaultPolycubePort    = 9000
+	defaultFirewallName    = "fw"
+	defaultFirewallIface   = "eth0"
+)
+
+// polycubeEndpoint is where the polycube of a pod listens and how its firewall must be named and attached
+type polycubeEndpoint struct {
+	port  int32
+	iface string
+	cube  string
+}
+
+// resolvePolycubeEndpoint finds the polycube endpoint of a pod.
+// Each value is taken from the annotations of the pod first, then from the settings, and then the default is used.
+// The port can also be the one named polycubed in the containers of the pod.
+func resolvePolycubeEndpoint(pod *core_v1.Pod) polycubeEndpoint {
+	endpoint := polycubeEndpoint{
+		port:  settings.Settings.Polycube.Port,
+		iface: settings.Settings.Polycube.Interface,
+		cube:  settings.Settings.Polycube.Firewall,
+	}
+
+	if port := namedPolycubePort(pod); port > 0 {
+		endpoint.port = port
+	}
+	if value, exists := pod.Annotations[polycubePortAnnotation]; exists {
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			log.Errorf("Invalid polycube port %s in pod %s, going to ignore it", value, pod.Name)
+		} else {
+			endpoint.port = int32(port)
+		}
+	}
+	if value, exists := pod.Annotations[interfaceAnnotation]; exists && len(value) > 0 {
+		endpoint.iface = value
+	}
+	if value, exists := pod.Annotations[firewallNameAnnotation]; exists && len(value) > 0 {
+		endpoint.cube = value
+	}
+
+	if endpoint.port < 1 {
+		endpoint.port = defaultPolycubePort
+	}
+	if len(endpoint.iface) < 1 {
+		endpoint.iface = defaultFirewallIface
+	}
+	if len(endpoint.cube) < 1 {
+		endpoint.cube = defaultFirewallName
+	}
+	return endpoint
+}
+
+// namedPolycubePort returns the container port named like the polycube container, or 0 if there is none
+func namedPolycubePort(pod *core_v1.Pod) int32 {
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == polycubeContainer {
+				return port.ContainerPort
+			}
+		}
+	}
+	return 0
+}
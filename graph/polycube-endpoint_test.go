@@ -0,0 +1,45 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/SunSince90/ASTRID-kube/settings"
+	"github.com/stretchr/testify/assert"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResolvePolycubeEndpoint(t *testing.T) {
+	pod := &core_v1.Pod{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "apache-1"},
+		Spec: core_v1.PodSpec{
+			Containers: []core_v1.Container{{Name: "apache"}, {Name: polycubeContainer}},
+		},
+	}
+
+	//	Defaults
+	assert.Equal(t, polycubeEndpoint{port: 9000, iface: "eth0", cube: "fw"}, resolvePolycubeEndpoint(pod))
+
+	//	Settings
+	defaults := settings.Settings.Polycube
+	defer func() { settings.Settings.Polycube = defaults }()
+	settings.Settings.Polycube.Port = 9100
+	settings.Settings.Polycube.Interface = "net1"
+	assert.Equal(t, polycubeEndpoint{port: 9100, iface: "net1", cube: "fw"}, resolvePolycubeEndpoint(pod))
+
+	//	Named port
+	pod.Spec.Containers[1].Ports = []core_v1.ContainerPort{{Name: polycubeContainer, ContainerPort: 9200}}
+	assert.Equal(t, int32(9200), resolvePolycubeEndpoint(pod).port)
+
+	//	Annotations
+	pod.Annotations = map[string]string{
+		polycubePortAnnotation: "9300",
+		interfaceAnnotation:    "eth1",
+		firewallNameAnnotation: "fw-apache",
+	}
+	assert.Equal(t, polycubeEndpoint{port: 9300, iface: "eth1", cube: "fw-apache"}, resolvePolycubeEndpoint(pod))
+
+	//	Invalid ports are ignored
+	pod.Annotations[polycubePortAnnotation] = "polycube"
+	assert.Equal(t, int32(9200), resolvePolycubeEndpoint(pod).port)
+}
@@ -0,0 +1,238 @@
+package graph
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/metrics"
+	"github.com/SunSince90/ASTRID-kube/settings"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	defaultProvisioningWorkers       = 4
+	defaultGlobalProvisioningWorkers = 32
+	defaultProvisioningRate          = 10
+	defaultProvisioningBurst         = 50
+	defaultProvisioningAttempts      = 3
+	provisioningMaxBackoff           = time.Minute
+)
+
+var (
+	//	provisioningSlots limits how many firewalls are provisioned at the same time in all graphs
+	provisioningSlots chan struct{}
+	//	provisioningLimiter limits how many firewalls are provisioned each second in all graphs
+	provisioningLimiter *rate.Limiter
+	provisioningOnce    sync.Once
+)
+
+// provisioningQueue provisions and heals the firewalls of a graph with a bounded number of workers.
+// Instances are queued by pod name, so events about a pod that is still waiting are merged into one,
+// and the firewall of a pod is never worked on by two workers at the same time.
+type provisioningQueue struct {
+	graph   string
+	log     *log.Entry
+	queue   workqueue.RateLimitingInterface
+	lock    sync.Mutex
+	pending map[string]*provisioningRequest
+	//	running are the requests being worked on, by pod
+	running   map[string]*provisioningRequest
+	provision func(*core_v1.Pod, *count) bool
+	restore   func(string) bool
+	//	attempts is how many times a pod is tried before giving up
+	attempts int
+}
+
+// provisioningRequest is the latest known state of a pod waiting for its firewall
+type provisioningRequest struct {
+	//	pod is nil if the firewall only needs to be healed
+	pod *core_v1.Pod
+	dep *count
+	//	heal is true if the firewall must be checked, and provisioned again if missing
+	heal bool
+	//	when the pod is expected to be taken by a worker, for the latency
+	ready time.Time
+	//	when provisioning was first tried, for the duration
+	start time.Time
+	//	forgotten is true if the pod went away while it was being worked on, so it must not be tried again
+	forgotten bool
+}
+
+func newProvisioningQueue(graph string, logger *log.Entry, provision func(*core_v1.Pod, *count) bool, restore func(string) bool) *provisioningQueue {
+	provisioningOnce.Do(func() {
+		slots := settings.Settings.Provisioning.GlobalWorkers
+		if slots < 1 {
+			slots = defaultGlobalProvisioningWorkers
+		}
+		limit, burst := settings.Settings.Provisioning.Rate, settings.Settings.Provisioning.Burst
+		if limit <= 0 {
+			limit = defaultProvisioningRate
+		}
+		if burst < 1 {
+			burst = defaultProvisioningBurst
+		}
+		provisioningSlots = make(chan struct{}, slots)
+		provisioningLimiter = rate.NewLimiter(rate.Limit(limit), burst)
+	})
+
+	attempts := settings.Settings.Provisioning.Attempts
+	if attempts < 1 {
+		attempts = defaultProvisioningAttempts
+	}
+
+	return &provisioningQueue{
+		graph:     graph,
+		log:       logger,
+		queue:     workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(provisioningBackoff, provisioningMaxBackoff), "provisioning-"+graph),
+		pending:   map[string]*provisioningRequest{},
+		running:   map[string]*provisioningRequest{},
+		provision: provision,
+		restore:   restore,
+		attempts:  attempts,
+	}
+}
+
+// start starts the workers of the queue
+func (p *provisioningQueue) start() {
+	workers := settings.Settings.Provisioning.Workers
+	if workers < 1 {
+		workers = defaultProvisioningWorkers
+	}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for p.processNext() {
+			}
+		}()
+	}
+}
+
+// add queues a pod to be provisioned after the provided delay.
+// If the pod is already waiting, it is going to be provisioned only once, with its latest state.
+func (p *provisioningQueue) add(pod *core_v1.Pod, dep *count, delay time.Duration) {
+	p.lock.Lock()
+	request := &provisioningRequest{pod: pod, dep: dep, ready: time.Now().Add(delay)}
+	if existing, exists := p.pending[pod.Name]; exists {
+		request.heal = existing.heal
+	}
+	p.pending[pod.Name] = request
+	metrics.ProvisioningQueueDepth.WithLabelValues(p.graph).Set(float64(len(p.pending)))
+	p.lock.Unlock()
+
+	p.queue.AddAfter(pod.Name, delay)
+}
+
+// heal queues the firewall of a pod to be checked after the provided delay, and provisioned again if missing.
+// Failures are retried with backoff, as polycube may not be listening yet, i.e. right after it restarted.
+func (p *provisioningQueue) heal(pod string, delay time.Duration) {
+	p.lock.Lock()
+	request, exists := p.pending[pod]
+	if !exists {
+		request = &provisioningRequest{ready: time.Now().Add(delay)}
+		p.pending[pod] = request
+	}
+	request.heal = true
+	metrics.ProvisioningQueueDepth.WithLabelValues(p.graph).Set(float64(len(p.pending)))
+	p.lock.Unlock()
+
+	p.queue.AddAfter(pod, delay)
+}
+
+// forget removes a pod from the queue, i.e. because it died.
+// If a worker is provisioning it, it is not going to try again, as its address may belong to another pod by then.
+func (p *provisioningQueue) forget(pod string) {
+	p.lock.Lock()
+	delete(p.pending, pod)
+	if request, exists := p.running[pod]; exists {
+		request.forgotten = true
+	}
+	metrics.ProvisioningQueueDepth.WithLabelValues(p.graph).Set(float64(len(p.pending)))
+	p.lock.Unlock()
+
+	p.queue.Forget(pod)
+}
+
+// processNext provisions the next pod in the queue. It returns false when the queue is shut down.
+func (p *provisioningQueue) processNext() bool {
+	key, shutdown := p.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer p.queue.Done(key)
+	pod := key.(string)
+
+	p.lock.Lock()
+	request, exists := p.pending[pod]
+	delete(p.pending, pod)
+	if exists {
+		request.forgotten = false
+		p.running[pod] = request
+	}
+	metrics.ProvisioningQueueDepth.WithLabelValues(p.graph).Set(float64(len(p.pending)))
+	p.lock.Unlock()
+
+	//	Forgotten while waiting
+	if !exists {
+		p.queue.Forget(key)
+		return true
+	}
+
+	if request.start.IsZero() {
+		metrics.ProvisioningQueueLatency.WithLabelValues(p.graph).Observe(time.Since(request.ready).Seconds())
+		request.start = time.Now()
+	}
+
+	provisioningSlots <- struct{}{}
+	provisioningLimiter.Wait(context.Background())
+	provisioned := true
+	if request.pod != nil {
+		provisioned = p.provision(request.pod, request.dep)
+	}
+	if provisioned && request.heal {
+		provisioned = p.restore(pod)
+	}
+	<-provisioningSlots
+
+	p.lock.Lock()
+	delete(p.running, pod)
+	forgotten := request.forgotten
+	p.lock.Unlock()
+
+	if forgotten && !provisioned {
+		p.log.Infoln("Not trying again to provision firewall for pod that went away:", pod)
+		p.queue.Forget(key)
+		return true
+	}
+
+	if provisioned {
+		metrics.ProvisioningDuration.WithLabelValues(p.graph).Observe(time.Since(request.start).Seconds())
+		p.queue.Forget(key)
+		return true
+	}
+
+	attempt := p.queue.NumRequeues(key) + 1
+	if attempt >= p.attempts {
+		p.log.Errorln("Giving up provisioning firewall for pod:", pod)
+		p.queue.Forget(key)
+		return true
+	}
+	p.log.Infof("Could not provision firewall for pod %s (attempt %d of %d)", pod, attempt, p.attempts)
+
+	//	A newer state of the pod may have been queued in the meantime: that one wins
+	p.lock.Lock()
+	if newer, exists := p.pending[pod]; exists {
+		newer.heal = newer.heal || request.heal
+	} else {
+		p.pending[pod] = request
+		metrics.ProvisioningQueueDepth.WithLabelValues(p.graph).Set(float64(len(p.pending)))
+	}
+	p.lock.Unlock()
+
+	metrics.ProvisioningRetries.WithLabelValues(p.graph).Inc()
+	p.queue.AddRateLimited(key)
+	return true
+}
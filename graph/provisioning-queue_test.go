@@ -0,0 +1,166 @@
+package graph
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/settings"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func testProvisioningQueue(provision func(*core_v1.Pod, *count) bool) *provisioningQueue {
+	p := newProvisioningQueue("mygraph", log.WithField("GRAPH", "mygraph"), provision, nil)
+	p.queue = workqueue.NewRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, 10*time.Millisecond))
+	return p
+}
+
+func provisioningPod(ip string) *core_v1.Pod {
+	return &core_v1.Pod{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "apache-1"},
+		Status:     core_v1.PodStatus{PodIP: ip},
+	}
+}
+
+func TestProvisioningQueueMergesEvents(t *testing.T) {
+	provisioned := []string{}
+	p := testProvisioningQueue(func(pod *core_v1.Pod, dep *count) bool {
+		provisioned = append(provisioned, pod.Status.PodIP)
+		return true
+	})
+
+	p.add(provisioningPod("10.0.0.1"), &count{}, 0)
+	p.add(provisioningPod("10.0.0.2"), &count{}, 0)
+	assert.Equal(t, 1, p.queue.Len())
+
+	assert.True(t, p.processNext())
+	assert.Equal(t, []string{"10.0.0.2"}, provisioned)
+	assert.Zero(t, p.queue.Len())
+}
+
+func TestProvisioningQueueRetries(t *testing.T) {
+	var p *provisioningQueue
+	calls := 0
+	p = testProvisioningQueue(func(pod *core_v1.Pod, dep *count) bool {
+		calls++
+		return calls == p.attempts
+	})
+
+	p.add(provisioningPod("10.0.0.1"), &count{}, 0)
+	for i := 0; i < p.attempts; i++ {
+		p.processNext()
+	}
+	assert.Equal(t, p.attempts, calls)
+	assert.Zero(t, p.queue.NumRequeues("apache-1"))
+	assert.Empty(t, p.pending)
+}
+
+func TestProvisioningQueueGivesUp(t *testing.T) {
+	calls := 0
+	p := testProvisioningQueue(func(pod *core_v1.Pod, dep *count) bool {
+		calls++
+		return false
+	})
+
+	p.add(provisioningPod("10.0.0.1"), &count{}, 0)
+	for i := 0; i < p.attempts; i++ {
+		p.processNext()
+	}
+	assert.Equal(t, p.attempts, calls)
+	assert.Empty(t, p.pending)
+
+	//	Nothing else is queued
+	time.Sleep(20 * time.Millisecond)
+	assert.Zero(t, p.queue.Len())
+}
+
+func TestProvisioningQueueAttempts(t *testing.T) {
+	defer func(attempts int) { settings.Settings.Provisioning.Attempts = attempts }(settings.Settings.Provisioning.Attempts)
+
+	settings.Settings.Provisioning.Attempts = 0
+	assert.Equal(t, defaultProvisioningAttempts, testProvisioningQueue(nil).attempts)
+
+	settings.Settings.Provisioning.Attempts = 5
+	calls := 0
+	p := testProvisioningQueue(func(pod *core_v1.Pod, dep *count) bool {
+		calls++
+		return false
+	})
+	p.add(provisioningPod("10.0.0.1"), &count{}, 0)
+	for i := 0; i < 5; i++ {
+		p.processNext()
+	}
+	assert.Equal(t, 5, calls)
+	assert.Empty(t, p.pending)
+}
+
+func TestProvisioningQueueForget(t *testing.T) {
+	calls := 0
+	p := testProvisioningQueue(func(pod *core_v1.Pod, dep *count) bool {
+		calls++
+		return true
+	})
+
+	p.add(provisioningPod("10.0.0.1"), &count{}, 0)
+	p.forget("apache-1")
+	assert.True(t, p.processNext())
+	assert.Zero(t, calls)
+}
+
+func TestProvisioningQueueHeal(t *testing.T) {
+	provisioned, healed := 0, 0
+	p := testProvisioningQueue(func(pod *core_v1.Pod, dep *count) bool {
+		provisioned++
+		return true
+	})
+	p.restore = func(pod string) bool {
+		healed++
+		return true
+	}
+
+	//	A heal waiting for the pod is not lost when a newer state of it comes
+	p.heal("apache-1", 0)
+	p.add(provisioningPod("10.0.0.1"), &count{}, 0)
+	assert.True(t, p.processNext())
+	assert.Equal(t, 1, provisioned)
+	assert.Equal(t, 1, healed)
+
+	p.heal("apache-1", 0)
+	assert.True(t, p.processNext())
+	assert.Equal(t, 1, provisioned)
+	assert.Equal(t, 2, healed)
+}
+
+func TestProvisioningQueueForgetWhileProvisioning(t *testing.T) {
+	var p *provisioningQueue
+	calls := 0
+	p = testProvisioningQueue(func(pod *core_v1.Pod, dep *count) bool {
+		calls++
+		//	The pod dies while its firewall is being provisioned
+		p.forget(pod.Name)
+		return false
+	})
+
+	p.add(provisioningPod("10.0.0.1"), &count{}, 0)
+	assert.True(t, p.processNext())
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, p.pending)
+	assert.Empty(t, p.running)
+	assert.Zero(t, p.queue.NumRequeues("apache-1"))
+
+	//	Nothing is tried again on its address
+	time.Sleep(20 * time.Millisecond)
+	assert.Zero(t, p.queue.Len())
+
+	//	A new pod with the same name is provisioned as usual
+	p.provision = func(pod *core_v1.Pod, dep *count) bool {
+		calls++
+		return true
+	}
+	p.add(provisioningPod("10.0.0.2"), &count{}, 0)
+	assert.True(t, p.processNext())
+	assert.Equal(t, 2, calls)
+}
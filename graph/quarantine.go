@@ -0,0 +1,160 @@
+package graph
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
+	log "github.com/sirupsen/logrus"
+)
+
+const quarantinesFile = "quarantines.json"
+
+// quarantineStore keeps the instances that are quarantined, along with what is needed to release them.
+// They are saved on disk, so they stay quarantined, and can be released, even if ASTRID-kube restarts in the meantime.
+type quarantineStore struct {
+	lock sync.Mutex
+	path string
+	//	quarantines are by graph, then by pod
+	quarantines map[string]map[string]quarantineRecord
+}
+
+// quarantineRecord is how the firewall of an instance was before it was quarantined
+type quarantineRecord struct {
+	BeforeQuarantine    map[string][]k8sfirewall.ChainRule `json:"beforeQuarantine"`
+	AcceptedEstablished bool                               `json:"acceptedEstablished"`
+}
+
+var quarantines = &quarantineStore{
+	quarantines: map[string]map[string]quarantineRecord{},
+}
+
+// load reads the quarantines saved in the provided folder
+func (q *quarantineStore) load(folder string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.path = filepath.Join(folder, quarantinesFile)
+	data, err := ioutil.ReadFile(q.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorln("Could not read quarantines:", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &q.quarantines); err != nil {
+		log.Errorln("Could not parse quarantines:", err)
+	}
+}
+
+// save writes all quarantines on disk. It must be called with the lock held.
+func (q *quarantineStore) save() {
+	if len(q.path) < 1 {
+		return
+	}
+
+	data, err := json.MarshalIndent(q.quarantines, "", "   ")
+	if err != nil {
+		log.Errorln("Could not marshal quarantines:", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(q.path), 0700); err != nil {
+		log.Errorln("Could not save quarantines:", err)
+		return
+	}
+
+	//	Write it in another file first, so a crash never leaves it half written
+	tmp := q.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		log.Errorln("Could not save quarantines:", err)
+		return
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		log.Errorln("Could not save quarantines:", err)
+	}
+}
+
+// get returns how the firewall of a quarantined instance was, and false if it is not quarantined
+func (q *quarantineStore) get(graph, pod string) (quarantineRecord, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	record, exists := q.quarantines[graph][pod]
+	return record, exists
+}
+
+// set records that an instance is quarantined
+func (q *quarantineStore) set(graph, pod string, record quarantineRecord) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if _, exists := q.quarantines[graph]; !exists {
+		q.quarantines[graph] = map[string]quarantineRecord{}
+	}
+	q.quarantines[graph][pod] = record
+	q.save()
+}
+
+// remove records that an instance is not quarantined anymore
+func (q *quarantineStore) remove(graph, pod string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if _, exists := q.quarantines[graph][pod]; !exists {
+		return
+	}
+	delete(q.quarantines[graph], pod)
+	if len(q.quarantines[graph]) == 0 {
+		delete(q.quarantines, graph)
+	}
+	q.save()
+}
+
+// Quarantine drops all traffic of an instance, except the one needed to manage its firewall
+func (handler *InfrastructureHandler) Quarantine(uid string) error {
+	if err := handler.reconciler.quarantine(uid); err != nil {
+		handler.log.Errorf("Could not quarantine %s: %s", uid, err)
+		return err
+	}
+
+	handler.log.Infoln("Quarantined instance:", uid)
+	handler.infoBuilder.SetQuarantined(uid, true)
+	handler.pushInstanceEvent(uid, types.Quarantined)
+	return nil
+}
+
+// Release lets traffic of a quarantined instance flow again, as it did before being quarantined
+func (handler *InfrastructureHandler) Release(uid string) error {
+	if err := handler.reconciler.release(uid); err != nil {
+		handler.log.Errorf("Could not release %s: %s", uid, err)
+		return err
+	}
+
+	handler.log.Infoln("Released instance:", uid)
+	handler.infoBuilder.SetQuarantined(uid, false)
+	handler.pushInstanceEvent(uid, types.Released)
+	return nil
+}
+
+func (handler *InfrastructureHandler) pushInstanceEvent(uid string, eventType types.InfrastructureEventType) {
+	instance, exists := handler.reconciler.tracked()[uid]
+	if !exists {
+		return
+	}
+
+	handler.infoBuilder.PushEvent(types.InfrastructureEvent{
+		GraphName: handler.name,
+		Type:      eventType,
+		EventData: types.InfrastructureEventResource{
+			ResourceType: types.Pod,
+			Name:         instance.service,
+			Ip:           instance.ip,
+			Uid:          uid,
+		},
+	})
+}
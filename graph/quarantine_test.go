@@ -0,0 +1,146 @@
+package graph
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/SunSince90/ASTRID-kube/utils"
+	"github.com/SunSince90/ASTRID-kube/utils/polycubetest"
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// testQuarantines replaces the quarantines with the ones saved in a new folder, which is returned
+func testQuarantines(t *testing.T) (string, func()) {
+	folder, err := ioutil.TempDir("", "quarantines")
+	assert.NoError(t, err)
+
+	previous := quarantines
+	quarantines = loadQuarantines(folder)
+	return folder, func() {
+		quarantines = previous
+		os.RemoveAll(folder)
+	}
+}
+
+func loadQuarantines(folder string) *quarantineStore {
+	store := &quarantineStore{quarantines: map[string]map[string]quarantineRecord{}}
+	store.load(folder)
+	return store
+}
+
+func TestQuarantine(t *testing.T) {
+	_, restoreQuarantines := testQuarantines(t)
+	defer restoreQuarantines()
+	polycube, fw, restore := testPolycube(t)
+	defer restore()
+
+	recorder := &eventRecorder{}
+	handler := &InfrastructureHandler{name: "quarantine", log: log.WithField("GRAPH", "quarantine"), infoBuilder: recorder}
+	handler.reconciler = newFirewallReconciler("quarantine", handler.log, recorder)
+
+	//	Rules in ingress are declared, while the ones in egress were put by someone else
+	drop := k8sfirewall.ChainRule{Action: "drop", Src: "10.0.0.5"}
+	forward := k8sfirewall.ChainRule{Action: "forward", Dst: "10.0.0.9"}
+	assert.True(t, utils.ProvisionFirewall(fw, false))
+	assert.NoError(t, utils.InsertRule(fw, "egress", 1, forward))
+	handler.reconciler.track("apache-1", "apache", fw)
+	assert.NoError(t, handler.reconciler.setRules(ruleSourceAPI, "apache-1", "ingress", []k8sfirewall.ChainRule{drop}))
+
+	assert.NoError(t, handler.Quarantine("apache-1"))
+	for _, direction := range utils.Directions {
+		assert.Equal(t, []k8sfirewall.ChainRule{utils.ManagementRule(fw, direction), utils.DropAllRule()}, withoutIds(polycube.Rules("fw", direction)))
+	}
+	assert.Equal(t, "OFF", polycube.Firewall("fw").AcceptEstablished)
+	assert.True(t, recorder.quarantined["apache-1"])
+	assert.Error(t, handler.Quarantine("apache-1"))
+
+	assert.NoError(t, handler.Release("apache-1"))
+	assert.Equal(t, []k8sfirewall.ChainRule{utils.ManagementRule(fw, "ingress"), drop}, withoutIds(polycube.Rules("fw", "ingress")))
+	assert.Equal(t, []k8sfirewall.ChainRule{utils.ManagementRule(fw, "egress"), forward}, withoutIds(polycube.Rules("fw", "egress")))
+	assert.Equal(t, "ON", polycube.Firewall("fw").AcceptEstablished)
+	assert.False(t, recorder.quarantined["apache-1"])
+	assert.Error(t, handler.Release("apache-1"))
+
+	if assert.Len(t, recorder.events, 2) {
+		assert.Equal(t, types.Quarantined, recorder.events[0].Type)
+		assert.Equal(t, types.Released, recorder.events[1].Type)
+	}
+
+	assert.Equal(t, ErrInstanceNotFound, handler.Quarantine("apache-2"))
+}
+
+func TestQuarantineNodeFirewall(t *testing.T) {
+	_, restoreQuarantines := testQuarantines(t)
+	defer restoreQuarantines()
+	polycube, sidecar, restore := testPolycube(t)
+	defer restore()
+	ip := "10.0.0.9"
+	fw := utils.NodeFirewall(ip, sidecar.IP(), polycube.Port())
+
+	recorder := &eventRecorder{}
+	handler := &InfrastructureHandler{name: "quarantine", log: log.WithField("GRAPH", "quarantine"), infoBuilder: recorder}
+	handler.reconciler = newFirewallReconciler("quarantine", handler.log, recorder)
+
+	//	The firewall of pcn-k8s does not accept established connections
+	pcn := k8sfirewall.ChainRule{Action: "forward", Src: "10.0.0.2"}
+	polycube.SetFirewall("fw-"+ip, polycubetest.Firewall{AcceptEstablished: "OFF", Chains: map[string][]k8sfirewall.ChainRule{"egress": {pcn}}})
+	assert.True(t, utils.ProvisionFirewall(fw, false))
+	handler.reconciler.track("apache-1", "apache", fw)
+
+	//	There is no polycube in the pod to keep reachable
+	assert.NoError(t, handler.Quarantine("apache-1"))
+	for _, chain := range utils.Directions {
+		assert.Equal(t, []k8sfirewall.ChainRule{utils.DropAllRule()}, withoutIds(polycube.Rules("fw-"+ip, chain)))
+	}
+
+	//	and it is put back as it was
+	assert.NoError(t, handler.Release("apache-1"))
+	assert.Equal(t, []k8sfirewall.ChainRule{pcn}, withoutIds(polycube.Rules("fw-"+ip, "egress")))
+	assert.Empty(t, polycube.Rules("fw-"+ip, "ingress"))
+	assert.Equal(t, "OFF", polycube.Firewall("fw-"+ip).AcceptEstablished)
+	assert.False(t, polycube.Firewall("fw-"+ip).Interactive)
+}
+
+func TestQuarantineRestart(t *testing.T) {
+	folder, restoreQuarantines := testQuarantines(t)
+	defer restoreQuarantines()
+	polycube, fw, restore := testPolycube(t)
+	defer restore()
+
+	recorder := &eventRecorder{}
+	handler := &InfrastructureHandler{name: "quarantine", log: log.WithField("GRAPH", "quarantine"), infoBuilder: recorder}
+	handler.reconciler = newFirewallReconciler("quarantine", handler.log, recorder)
+
+	forward := k8sfirewall.ChainRule{Action: "forward", Dst: "10.0.0.9"}
+	assert.True(t, utils.ProvisionFirewall(fw, false))
+	assert.NoError(t, utils.InsertRule(fw, "egress", 1, forward))
+	handler.reconciler.track("apache-1", "apache", fw)
+	assert.NoError(t, handler.Quarantine("apache-1"))
+
+	//	It is saved, along with the rules to put back
+	saved, quarantined := loadQuarantines(folder).get("quarantine", "apache-1")
+	assert.True(t, quarantined)
+	assert.Equal(t, []k8sfirewall.ChainRule{forward}, saved.BeforeQuarantine["egress"])
+	assert.True(t, saved.AcceptedEstablished)
+
+	//	After a restart, its firewall is adopted as it is, and it is still quarantined
+	quarantines = loadQuarantines(folder)
+	calls := len(polycube.Calls())
+	assert.True(t, utils.ProvisionFirewall(fw, true))
+	assert.Equal(t, []string{"GET firewall/fw/"}, polycube.Calls()[calls:])
+
+	handler.reconciler = newFirewallReconciler("quarantine", handler.log, recorder)
+	handler.reconciler.track("apache-1", "apache", fw)
+	assert.True(t, handler.reconciler.tracked()["apache-1"].quarantined)
+	assert.Error(t, handler.Quarantine("apache-1"))
+
+	assert.NoError(t, handler.Release("apache-1"))
+	assert.Equal(t, []k8sfirewall.ChainRule{utils.ManagementRule(fw, "egress"), forward}, withoutIds(polycube.Rules("fw", "egress")))
+	assert.Equal(t, "ON", polycube.Firewall("fw").AcceptEstablished)
+	_, quarantined = loadQuarantines(folder).get("quarantine", "apache-1")
+	assert.False(t, quarantined)
+}
@@ -0,0 +1,139 @@
+package graph
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/metrics"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	misconfiguredReason = "PolycubeMisconfigured"
+	eventSource         = "astrid-kube"
+)
+
+// requiredMounts are the host folders that polycubed needs to compile and load its programs
+var requiredMounts = []string{"/lib/modules", "/usr/src"}
+
+// sidecarProblems checks that the pod has a polycubed sidecar that can run a firewall and listens on the provided port,
+// and returns a description of everything that is missing.
+func sidecarProblems(pod *core_v1.Pod, polycubePort int32) []string {
+	var sidecar *core_v1.Container
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == polycubeContainer {
+			sidecar = &pod.Spec.Containers[i]
+			break
+		}
+	}
+	if sidecar == nil {
+		return []string{fmt.Sprintf("no %s container", polycubeContainer)}
+	}
+
+	problems := []string{}
+
+	exposed := false
+	for _, port := range sidecar.Ports {
+		if port.ContainerPort == polycubePort {
+			exposed = true
+		}
+	}
+	if !exposed {
+		problems = append(problems, fmt.Sprintf("%s does not expose port %d", polycubeContainer, polycubePort))
+	}
+
+	if sidecar.SecurityContext == nil || sidecar.SecurityContext.Privileged == nil || !*sidecar.SecurityContext.Privileged {
+		problems = append(problems, fmt.Sprintf("%s is not privileged", polycubeContainer))
+	}
+
+	hostPaths := map[string]bool{}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.HostPath != nil {
+			hostPaths[volume.Name] = true
+		}
+	}
+	for _, path := range requiredMounts {
+		mounted := false
+		for _, mount := range sidecar.VolumeMounts {
+			if mount.MountPath == path && hostPaths[mount.Name] {
+				mounted = true
+			}
+		}
+		if !mounted {
+			problems = append(problems, fmt.Sprintf("%s does not mount %s from the host", polycubeContainer, path))
+		}
+	}
+
+	return problems
+}
+
+// reportMisconfiguration records what is wrong with the sidecar of a pod
+// and tells it with a Kubernetes event on the pod and on the namespace of the graph.
+// Nothing is reported if the problems did not change since the last time.
+func (handler *InfrastructureHandler) reportMisconfiguration(pod *core_v1.Pod, problems []string) {
+	handler.lock.Lock()
+	previous, exists := handler.misconfigured[pod.Name]
+	if exists && reflect.DeepEqual(previous, problems) {
+		handler.lock.Unlock()
+		return
+	}
+	handler.misconfigured[pod.Name] = problems
+	metrics.MisconfiguredInstances.WithLabelValues(handler.name).Set(float64(len(handler.misconfigured)))
+	handler.lock.Unlock()
+
+	message := fmt.Sprintf("Cannot protect pod %s with a firewall: %s", pod.Name, strings.Join(problems, ", "))
+	handler.log.Warnln(message)
+
+	handler.recordEvent(&core_v1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  pod.Namespace,
+		Name:       pod.Name,
+		UID:        pod.UID,
+	}, message)
+	handler.recordEvent(&core_v1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Namespace",
+		Name:       handler.name,
+	}, message)
+}
+
+// forgetMisconfiguration stops reporting a pod as misconfigured
+func (handler *InfrastructureHandler) forgetMisconfiguration(pod string) {
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+
+	if _, exists := handler.misconfigured[pod]; !exists {
+		return
+	}
+	delete(handler.misconfigured, pod)
+	metrics.MisconfiguredInstances.WithLabelValues(handler.name).Set(float64(len(handler.misconfigured)))
+}
+
+// recordEvent creates a warning event about an object of the graph
+func (handler *InfrastructureHandler) recordEvent(object *core_v1.ObjectReference, message string) {
+	t := time.Now()
+	now := meta_v1.NewTime(t)
+	event := &core_v1.Event{
+		ObjectMeta: meta_v1.ObjectMeta{
+			//	Named like the ones of Kubernetes' event recorder
+			Name:      fmt.Sprintf("%v.%x", object.Name, t.UnixNano()),
+			Namespace: handler.name,
+		},
+		InvolvedObject: *object,
+		Reason:         misconfiguredReason,
+		Message:        message,
+		Type:           core_v1.EventTypeWarning,
+		Source:         core_v1.EventSource{Component: eventSource},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	if _, err := handler.clientset.CoreV1().Events(handler.name).Create(event); err != nil {
+		handler.log.Errorln("Could not record event:", err)
+	}
+}
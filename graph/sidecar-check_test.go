@@ -0,0 +1,88 @@
+package graph
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func sidecarPod() *core_v1.Pod {
+	privileged := true
+	hostPath := func(name, path string) core_v1.Volume {
+		return core_v1.Volume{Name: name, VolumeSource: core_v1.VolumeSource{HostPath: &core_v1.HostPathVolumeSource{Path: path}}}
+	}
+
+	return &core_v1.Pod{
+		ObjectMeta: meta_v1.ObjectMeta{Name: "apache-1", Namespace: "mygraph"},
+		Spec: core_v1.PodSpec{
+			Containers: []core_v1.Container{
+				{Name: "apache"},
+				{
+					Name:            polycubeContainer,
+					Ports:           []core_v1.ContainerPort{{ContainerPort: 9000}},
+					SecurityContext: &core_v1.SecurityContext{Privileged: &privileged},
+					VolumeMounts: []core_v1.VolumeMount{
+						{Name: "lib-modules", MountPath: "/lib/modules"},
+						{Name: "usr-src", MountPath: "/usr/src"},
+					},
+				},
+			},
+			Volumes: []core_v1.Volume{hostPath("lib-modules", "/lib/modules"), hostPath("usr-src", "/usr/src")},
+		},
+	}
+}
+
+func TestSidecarProblems(t *testing.T) {
+	assert.Empty(t, sidecarProblems(sidecarPod(), 9000))
+
+	pod := sidecarPod()
+	pod.Spec.Containers = pod.Spec.Containers[:1]
+	assert.Equal(t, []string{"no polycubed container"}, sidecarProblems(pod, 9000))
+
+	pod = sidecarPod()
+	pod.Spec.Containers[1].Ports = nil
+	pod.Spec.Containers[1].SecurityContext = nil
+	pod.Spec.Volumes[1].HostPath = nil
+	assert.Equal(t, []string{
+		"polycubed does not expose port 9000",
+		"polycubed is not privileged",
+		"polycubed does not mount /usr/src from the host",
+	}, sidecarProblems(pod, 9000))
+
+	//	polycubed can listen on another port
+	assert.Equal(t, []string{"polycubed does not expose port 9001"}, sidecarProblems(sidecarPod(), 9001))
+}
+
+func TestReportMisconfiguration(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	handler := &InfrastructureHandler{
+		name:          "mygraph",
+		clientset:     clientset,
+		log:           log.WithFields(log.Fields{"GRAPH": "mygraph"}),
+		misconfigured: map[string][]string{},
+	}
+
+	pod := sidecarPod()
+	pod.Spec.Containers = pod.Spec.Containers[:1]
+	handler.reportMisconfiguration(pod, sidecarProblems(pod, 9000))
+	//	The same problems are not reported twice
+	handler.reportMisconfiguration(pod, sidecarProblems(pod, 9000))
+
+	events, err := clientset.CoreV1().Events("mygraph").List(meta_v1.ListOptions{})
+	assert.NoError(t, err)
+	kinds := []string{}
+	for _, event := range events.Items {
+		assert.Equal(t, core_v1.EventTypeWarning, event.Type)
+		assert.Equal(t, "Cannot protect pod apache-1 with a firewall: no polycubed container", event.Message)
+		kinds = append(kinds, event.InvolvedObject.Kind)
+	}
+	assert.ElementsMatch(t, []string{"Pod", "Namespace"}, kinds)
+	assert.Equal(t, map[string][]string{"apache-1": {"no polycubed container"}}, handler.Status().Misconfigured)
+
+	handler.forgetMisconfiguration("apache-1")
+	assert.Empty(t, handler.Status().Misconfigured)
+}
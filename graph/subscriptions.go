@@ -0,0 +1,343 @@
+package graph
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/SunSince90/ASTRID-kube/metrics"
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/SunSince90/ASTRID-kube/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	verekubeSink = "verekube"
+)
+
+var (
+	// ErrSubscriptionNotFound is returned when the requested subscription does not exist
+	ErrSubscriptionNotFound = errors.New("Subscription does not exist")
+)
+
+// subscriptionRegistry keeps all destinations of the infrastructure info and events,
+// along with the graphs whose data can be sent to them
+type subscriptionRegistry struct {
+	lock     sync.Mutex
+	sinks    map[string]*sink
+	builders map[string]*InfrastructureInfoBuilder
+}
+
+// sink is a destination of data
+type sink struct {
+	subscription types.Subscription
+	//	verekube has its own URL and format for events, all others use the ones of the subscription
+	infoURL     string
+	eventURL    string
+	infoFormat  types.EncodingType
+	eventFormat types.EncodingType
+	//	policy is true if responses carry the policy to enforce
+	policy bool
+	//	ready are the graphs whose infrastructure info has been sent, and so can have events sent
+	ready map[string]bool
+}
+
+var subscriptions = &subscriptionRegistry{
+	sinks:    map[string]*sink{},
+	builders: map[string]*InfrastructureInfoBuilder{},
+}
+
+// load adds verekube and the subscriptions in the settings
+func (r *subscriptionRegistry) load(endpoints types.VerekubeEndPoints, formats types.Formats, list []types.Subscription) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(endpoints.InfrastructureInfo) > 0 || len(endpoints.InfrastructureEvent) > 0 {
+		r.sinks[verekubeSink] = &sink{
+			subscription: types.Subscription{
+				ID:     verekubeSink,
+				URL:    endpoints.InfrastructureInfo,
+				Format: formats.InfrastructureInfo,
+			},
+			infoURL:     endpoints.InfrastructureInfo,
+			eventURL:    endpoints.InfrastructureEvent,
+			infoFormat:  formats.InfrastructureInfo,
+			eventFormat: formats.InfrastructureEvent,
+			policy:      true,
+			ready:       map[string]bool{},
+		}
+	}
+
+	for j, subscription := range list {
+		if len(subscription.ID) < 1 {
+			subscription.ID = "settings-" + strconv.Itoa(j)
+		}
+		if err := validateSubscription(subscription); err != nil {
+			log.Errorf("Invalid subscription %s, going to skip it: %s", subscription.ID, err)
+			continue
+		}
+		r.sinks[subscription.ID] = newSink(subscription)
+	}
+}
+
+func newSink(subscription types.Subscription) *sink {
+	return &sink{
+		subscription: subscription,
+		infoURL:      subscription.URL,
+		eventURL:     subscription.URL,
+		infoFormat:   subscription.Format,
+		eventFormat:  subscription.Format,
+		ready:        map[string]bool{},
+	}
+}
+
+func validateSubscription(subscription types.Subscription) error {
+	if len(subscription.URL) < 1 {
+		return errors.New("A URL must be specified")
+	}
+	switch subscription.Format {
+	case types.XML, types.YAML, types.JSON:
+	default:
+		return errors.New("Format must be one of xml, yaml or json")
+	}
+	switch subscription.Mode {
+	case "", types.EventsMode, types.DeltaMode:
+	default:
+		return errors.New("Mode must be events or delta")
+	}
+	if subscription.Retry.Attempts < 0 || subscription.Retry.Backoff < 0 {
+		return errors.New("Retry attempts and backoff cannot be negative")
+	}
+	return nil
+}
+
+// add registers a new subscription. It gets the infrastructure info of all graphs it is interested in
+// that are already running, and then their events.
+func (r *subscriptionRegistry) add(subscription types.Subscription) (types.Subscription, error) {
+	if err := validateSubscription(subscription); err != nil {
+		return types.Subscription{}, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return types.Subscription{}, err
+	}
+	subscription.ID = hex.EncodeToString(id)
+	s := newSink(subscription)
+
+	r.lock.Lock()
+	r.sinks[subscription.ID] = s
+	builders := []*InfrastructureInfoBuilder{}
+	for graph, builder := range r.builders {
+		if s.wants(graph, nil) {
+			builders = append(builders, builder)
+		}
+	}
+	r.lock.Unlock()
+
+	for _, builder := range builders {
+		go builder.welcome(s)
+	}
+	return subscription, nil
+}
+
+// remove deletes a subscription
+func (r *subscriptionRegistry) remove(id string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, exists := r.sinks[id]; !exists {
+		return ErrSubscriptionNotFound
+	}
+	//	The policy comes from verekube
+	if id == verekubeSink {
+		return errors.New("verekube cannot be unsubscribed")
+	}
+	delete(r.sinks, id)
+
+	//	Nothing is going to be delivered to it anymore
+	deliveries.forgetSink(id)
+	counters.forgetSink(id)
+	return nil
+}
+
+// get returns a sink, or nil if it does not exist
+func (r *subscriptionRegistry) get(id string) *sink {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.sinks[id]
+}
+
+// builder returns the builder of a graph that is sending data, or nil if there is none
+func (r *subscriptionRegistry) builder(graph string) *InfrastructureInfoBuilder {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.builders[graph]
+}
+
+// list returns all subscriptions, by id
+func (r *subscriptionRegistry) list() []types.Subscription {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	list := []types.Subscription{}
+	for _, s := range r.sinks {
+		list = append(list, s.subscription)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// enable registers the builder of a graph that is ready to send data, and returns the sinks that want its infrastructure info
+func (r *subscriptionRegistry) enable(graph string, builder *InfrastructureInfoBuilder) []*sink {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.builders[graph] = builder
+	sinks := []*sink{}
+	for _, s := range r.sinks {
+		if s.wants(graph, nil) {
+			sinks = append(sinks, s)
+		}
+	}
+	return sorted(sinks)
+}
+
+// forEvent returns the sinks that want an event and already have the infrastructure info of its graph
+func (r *subscriptionRegistry) forEvent(event types.InfrastructureEvent) []*sink {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	sinks := []*sink{}
+	for _, s := range r.sinks {
+		if s.ready[event.GraphName] && s.subscription.Mode != types.DeltaMode && s.wants(event.GraphName, &event) {
+			sinks = append(sinks, s)
+		}
+	}
+	return sorted(sinks)
+}
+
+// forEvents returns the sinks that want the events of a graph, any of them, and already have its infrastructure info
+func (r *subscriptionRegistry) forEvents(graph string) []*sink {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	sinks := []*sink{}
+	for _, s := range r.sinks {
+		if s.ready[graph] && s.subscription.Mode != types.DeltaMode && s.wants(graph, nil) {
+			sinks = append(sinks, s)
+		}
+	}
+	return sorted(sinks)
+}
+
+// forDelta returns the sinks that want the changes to the infrastructure info of a graph, and already have it
+func (r *subscriptionRegistry) forDelta(graph string) []*sink {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	sinks := []*sink{}
+	for _, s := range r.sinks {
+		if s.ready[graph] && s.subscription.Mode == types.DeltaMode && s.wants(graph, nil) {
+			sinks = append(sinks, s)
+		}
+	}
+	return sorted(sinks)
+}
+
+// markReady records that a sink has the infrastructure info of a graph
+func (r *subscriptionRegistry) markReady(s *sink, graph string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	s.ready[graph] = true
+}
+
+// sorted puts verekube first and the others by id, so that data is always sent in the same order
+func sorted(sinks []*sink) []*sink {
+	sort.Slice(sinks, func(i, j int) bool {
+		if sinks[i].policy != sinks[j].policy {
+			return sinks[i].policy
+		}
+		return sinks[i].subscription.ID < sinks[j].subscription.ID
+	})
+	return sinks
+}
+
+// wants checks if the filter of a sink matches a graph and, if not nil, an event
+func (s *sink) wants(graph string, event *types.InfrastructureEvent) bool {
+	filter := s.subscription.Filter
+
+	matches := len(filter.Graphs) == 0
+	for _, g := range filter.Graphs {
+		matches = matches || g == graph
+	}
+	if !matches || event == nil {
+		return matches
+	}
+
+	matches = len(filter.ResourceTypes) == 0
+	for _, resourceType := range filter.ResourceTypes {
+		matches = matches || resourceType == event.EventData.ResourceType
+	}
+	if !matches {
+		return false
+	}
+
+	matches = len(filter.EventTypes) == 0
+	for _, eventType := range filter.EventTypes {
+		matches = matches || eventType == event.Type
+	}
+	return matches
+}
+
+// deliver sends data waiting in the outbox to a sink, and passes the response of verekube to the builder of its graph.
+// It returns false if the data could not be delivered, and the sequence of the first event the sink reported missing, if any.
+func (s *sink) deliver(builder *InfrastructureInfoBuilder, entry *outboxEntry) (bool, uint64) {
+	logger := log.WithFields(log.Fields{"GRAPH": entry.Graph})
+
+	response, err := s.post(entry.URL, entry.ContentType, entry.Data)
+	if err != nil {
+		metrics.SendFailures.WithLabelValues(entry.Graph, s.subscription.ID).Inc()
+		logger.Errorf("Could not send data to %s (attempt %d): %s", s.subscription.ID, entry.Attempts+1, err)
+		return false, 0
+	}
+	defer response.Body.Close()
+
+	//	It is not sent again, as it would be rejected again, but it was not accepted either.
+	//	The body is an error then, not a policy.
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		metrics.SendFailures.WithLabelValues(entry.Graph, s.subscription.ID).Inc()
+		logger.Errorf("Data sent to %s was rejected with %d", s.subscription.ID, response.StatusCode)
+	} else {
+		logger.Printf("Sent data to %s and received %d", s.subscription.ID, response.StatusCode)
+		if s.policy && builder != nil {
+			builder.handleResponse(response)
+		}
+	}
+
+	missing, _ := strconv.ParseUint(response.Header.Get(types.MissingDeliveryHeader), 10, 64)
+	return true, missing
+}
+
+// post sends data to a sink.
+// Responses with server errors are failures too, as the data was not processed.
+func (s *sink) post(url, contentType string, data []byte) (*http.Response, error) {
+	response, err := utils.Post(url, contentType, data)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= http.StatusInternalServerError {
+		response.Body.Close()
+		return nil, errors.New("Received " + response.Status)
+	}
+	return response, nil
+}
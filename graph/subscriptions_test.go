@@ -0,0 +1,265 @@
+package graph
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/metrics"
+	"github.com/SunSince90/ASTRID-kube/settings"
+	"github.com/SunSince90/ASTRID-kube/types"
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// delivery is a request received by a test sink
+type delivery struct {
+	path        string
+	contentType string
+	body        []byte
+}
+
+func testSink(status ...int) (*httptest.Server, chan delivery) {
+	deliveries := make(chan delivery, 10)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		deliveries <- delivery{path: r.URL.Path, contentType: r.Header.Get("Content-Type"), body: body}
+		if requests < len(status) {
+			w.WriteHeader(status[requests])
+		}
+		requests++
+	}))
+	return server, deliveries
+}
+
+func receive(t *testing.T, deliveries chan delivery) delivery {
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("Nothing was delivered")
+		return delivery{}
+	}
+}
+
+func TestSinkWants(t *testing.T) {
+	s := newSink(types.Subscription{Filter: types.SubscriptionFilter{
+		Graphs:     []string{"web"},
+		EventTypes: []types.InfrastructureEventType{types.Delete, types.Quarantined},
+	}})
+
+	assert.True(t, s.wants("web", nil))
+	assert.False(t, s.wants("database", nil))
+	assert.True(t, s.wants("web", &types.InfrastructureEvent{Type: types.Delete, EventData: types.InfrastructureEventResource{ResourceType: types.Pod}}))
+	assert.False(t, s.wants("web", &types.InfrastructureEvent{Type: types.New}))
+
+	s.subscription.Filter.ResourceTypes = []types.InfrastructureEventResourceType{types.Node}
+	assert.False(t, s.wants("web", &types.InfrastructureEvent{Type: types.Delete, EventData: types.InfrastructureEventResource{ResourceType: types.Pod}}))
+}
+
+func TestSubscriptions(t *testing.T) {
+	defer func(registry *subscriptionRegistry) { subscriptions = registry }(subscriptions)
+	subscriptions = &subscriptionRegistry{sinks: map[string]*sink{}, builders: map[string]*InfrastructureInfoBuilder{}}
+
+	verekube, toVerekube := testSink()
+	defer verekube.Close()
+	siem, toSIEM := testSink()
+	defer siem.Close()
+
+	subscriptions.load(
+		types.VerekubeEndPoints{InfrastructureInfo: verekube.URL + "/info", InfrastructureEvent: verekube.URL + "/event"},
+		types.Formats{InfrastructureInfo: types.XML, InfrastructureEvent: types.XML},
+		[]types.Subscription{{
+			ID:     "siem",
+			URL:    siem.URL,
+			Format: types.JSON,
+			Filter: types.SubscriptionFilter{EventTypes: []types.InfrastructureEventType{types.Delete}},
+		}},
+	)
+
+	builder := newBuilder(fake.NewSimpleClientset(), "mygraph", types.DirectEnforcement)
+	builder.PushService("apache", &core_v1.ServiceSpec{}, []string{"firewall"})
+	builder.PushInstance("apache", "10.0.0.1", "apache-1")
+	builder.EnableSending()
+
+	//	Everyone gets the infrastructure info first, each in its own format
+	d := receive(t, toVerekube)
+	assert.Equal(t, "/info", d.path)
+	assert.Equal(t, types.ContentTypeXML, d.contentType)
+	d = receive(t, toSIEM)
+	assert.Equal(t, types.ContentTypeJSON, d.contentType)
+	info := types.InfrastructureInfo{}
+	assert.NoError(t, json.Unmarshal(d.body, &info))
+	assert.Equal(t, "apache-1", info.Spec.Services[0].Instances[0].UID)
+
+	//	and then the events they want
+	builder.PushInstance("apache", "10.0.0.2", "apache-2")
+	assert.Equal(t, "/event", receive(t, toVerekube).path)
+	builder.PopInstance("apache-2")
+	assert.Equal(t, "/event", receive(t, toVerekube).path)
+	event := types.InfrastructureEvent{}
+	assert.NoError(t, json.Unmarshal(receive(t, toSIEM).body, &event))
+	assert.Equal(t, types.Delete, event.Type)
+	assert.Equal(t, "apache-2", event.EventData.Uid)
+
+	//	Subscriptions added later get the infrastructure info as it is now
+	audit, toAudit := testSink()
+	defer audit.Close()
+	subscription, err := subscriptions.add(types.Subscription{URL: audit.URL, Format: types.YAML})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, subscription.ID)
+	assert.Equal(t, types.ContentTypeYAML, receive(t, toAudit).contentType)
+
+	assert.NoError(t, subscriptions.remove(subscription.ID))
+	assert.Error(t, subscriptions.remove(verekubeSink))
+	assert.Len(t, subscriptions.list(), 2)
+}
+
+func TestSinkPost(t *testing.T) {
+	server, deliveries := testSink(http.StatusServiceUnavailable, http.StatusOK)
+	defer server.Close()
+
+	s := newSink(types.Subscription{ID: "flaky", URL: server.URL, Format: types.JSON})
+	_, err := s.post(server.URL, types.ContentTypeJSON, []byte("{}"))
+	assert.Error(t, err)
+	response, err := s.post(server.URL, types.ContentTypeJSON, []byte("{}"))
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Len(t, deliveries, 2)
+
+	_, err = s.post("http://127.0.0.1:0", types.ContentTypeJSON, []byte("{}"))
+	assert.Error(t, err)
+
+	_, err = subscriptions.add(types.Subscription{URL: server.URL, Format: "csv"})
+	assert.Error(t, err)
+}
+
+func TestSinkRejected(t *testing.T) {
+	server, deliveries := testSink(http.StatusBadRequest)
+	defer server.Close()
+
+	//	It is not sent again, but it is a failure
+	failures := metrics.SendFailures.WithLabelValues("mygraph", "rejecting")
+	before := testutil.ToFloat64(failures)
+	s := newSink(types.Subscription{ID: "rejecting", URL: server.URL, Format: types.JSON})
+	delivered, _ := s.deliver(nil, &outboxEntry{Graph: "mygraph", Sink: "rejecting", URL: server.URL, Data: []byte("{}")})
+	assert.True(t, delivered)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, before+1, testutil.ToFloat64(failures))
+}
+
+func TestDeltaSubscription(t *testing.T) {
+	_, restore := testOutbox(t)
+	defer restore()
+
+	server, toSIEM := testSink()
+	defer server.Close()
+	subscriptions.load(types.VerekubeEndPoints{}, types.Formats{}, []types.Subscription{{ID: "siem", URL: server.URL, Format: types.JSON, Mode: types.DeltaMode}})
+
+	builder := newBuilder(fake.NewSimpleClientset(), "mygraph", types.DirectEnforcement)
+	builder.PushService("apache", &core_v1.ServiceSpec{}, []string{"firewall"})
+	builder.EnableSending()
+	document := receive(t, toSIEM).body
+
+	//	Changes that have an event, and ones that do not
+	builder.PushInstance("apache", "10.0.0.1", "apache-1")
+	builder.SetQuarantined("apache-1", true)
+	for j := 0; j < 2; j++ {
+		delta := types.InfrastructureInfoDelta{}
+		assert.NoError(t, json.Unmarshal(receive(t, toSIEM).body, &delta))
+		assert.Equal(t, delta.BaseRevision+1, delta.TargetRevision)
+
+		data, _ := json.Marshal(delta.Patch)
+		patch, err := jsonpatch.DecodePatch(data)
+		assert.NoError(t, err)
+		document, err = patch.Apply(document)
+		assert.NoError(t, err)
+	}
+
+	info := types.InfrastructureInfo{}
+	assert.NoError(t, json.Unmarshal(document, &info))
+	assert.Equal(t, builder.Info(), info)
+	assert.Len(t, toSIEM, 0)
+}
+
+func TestBatching(t *testing.T) {
+	_, restore := testOutbox(t)
+	defer restore()
+
+	server, toSIEM := testSink()
+	defer server.Close()
+	subscriptions.load(types.VerekubeEndPoints{}, types.Formats{}, []types.Subscription{{ID: "siem", URL: server.URL, Format: types.JSON}})
+
+	builder := newBuilder(fake.NewSimpleClientset(), "mygraph", types.DirectEnforcement)
+	builder.SetBatching(types.Batching{Window: 50, MaxSize: 3, MaxLatency: 1000})
+	builder.PushService("apache", &core_v1.ServiceSpec{}, []string{"firewall"})
+	builder.EnableSending()
+	receive(t, toSIEM)
+
+	//	The first three fill a batch, the last one is sent when the window is over
+	for _, uid := range []string{"apache-1", "apache-2", "apache-3", "apache-4"} {
+		builder.PushInstance("apache", "10.0.0.1", uid)
+	}
+	batch := types.InfrastructureEventBatch{}
+	assert.NoError(t, json.Unmarshal(receive(t, toSIEM).body, &batch))
+	assert.Len(t, batch.Events, 3)
+	assert.Equal(t, uint64(1), batch.Events[0].Sequence)
+
+	batch = types.InfrastructureEventBatch{}
+	assert.NoError(t, json.Unmarshal(receive(t, toSIEM).body, &batch))
+	assert.Equal(t, "mygraph", batch.GraphName)
+	assert.Len(t, batch.Events, 1)
+	assert.Equal(t, "apache-4", batch.Events[0].EventData.Uid)
+}
+
+func TestGraphBatching(t *testing.T) {
+	defer func(batching types.Batching) { settings.Settings.Batching = batching }(settings.Settings.Batching)
+	settings.Settings.Batching = types.Batching{Window: 100, MaxSize: 50, MaxLatency: 1000}
+
+	assert.Equal(t, settings.Settings.Batching, graphBatching(map[string]string{}))
+	assert.Equal(t, types.Batching{Window: 500, MaxSize: 50, MaxLatency: 1000}, graphBatching(map[string]string{batchingAnnotation: `{"window": 500}`}))
+	assert.Equal(t, settings.Settings.Batching, graphBatching(map[string]string{batchingAnnotation: "500"}))
+}
+
+func TestRejectedPolicy(t *testing.T) {
+	_, restore := testOutbox(t)
+	defer restore()
+
+	//	verekube rejects the infrastructure info, with a body that would be a valid policy
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", types.ContentTypeJSON)
+		if r.URL.Path == "/info" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"version": "rejected"}`))
+			return
+		}
+		w.Write([]byte(`{"version": "accepted"}`))
+	}))
+	defer server.Close()
+	subscriptions.load(types.VerekubeEndPoints{InfrastructureInfo: server.URL + "/info", InfrastructureEvent: server.URL + "/event"}, types.Formats{InfrastructureInfo: types.JSON, InfrastructureEvent: types.JSON}, nil)
+
+	applied := make(chan string, 10)
+	builder := newBuilder(fake.NewSimpleClientset(), "mygraph", types.DirectEnforcement)
+	builder.OnPolicy(func(policy types.Policy) {
+		applied <- policy.Version
+	})
+	builder.PushService("apache", &core_v1.ServiceSpec{}, []string{"firewall"})
+	builder.EnableSending()
+	builder.PushInstance("apache", "10.0.0.1", "apache-1")
+
+	//	Only the accepted one is enforced
+	select {
+	case version := <-applied:
+		assert.Equal(t, "accepted", version)
+	case <-time.After(time.Second):
+		t.Fatal("No policy was enforced")
+	}
+	assert.Len(t, applied, 0)
+}
@@ -0,0 +1,294 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/SunSince90/ASTRID-kube/utils"
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//	temporaryRulePrefix marks rules that expire, in their description
+	temporaryRulePrefix = "astrid-ttl:"
+	temporaryRulesFile  = "temporary-rules.json"
+)
+
+// temporaryRuleStore keeps track of all rules that must be removed when they expire.
+// Rules are saved on disk, so they are removed even if ASTRID-kube restarts in the meantime.
+type temporaryRuleStore struct {
+	lock  sync.Mutex
+	path  string
+	rules []types.TemporaryRule
+	//	called when a rule of a graph expires, to remove it from its firewall: it returns false if it must be tried again
+	onExpire map[string]func(types.TemporaryRule) bool
+}
+
+var temporaryRules = &temporaryRuleStore{
+	rules:    []types.TemporaryRule{},
+	onExpire: map[string]func(types.TemporaryRule) bool{},
+}
+
+// load reads the rules saved in the provided folder and starts removing them when they expire
+func (t *temporaryRuleStore) load(folder string, stop chan struct{}) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.path = filepath.Join(folder, temporaryRulesFile)
+	data, err := ioutil.ReadFile(t.path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorln("Could not read temporary rules:", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &t.rules); err != nil {
+			log.Errorln("Could not parse temporary rules:", err)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				t.expire(now)
+			}
+		}
+	}()
+}
+
+// save writes all rules on disk. It must be called with the lock held.
+func (t *temporaryRuleStore) save() {
+	if len(t.path) < 1 {
+		return
+	}
+
+	data, err := json.MarshalIndent(t.rules, "", "   ")
+	if err != nil {
+		log.Errorln("Could not marshal temporary rules:", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0700); err != nil {
+		log.Errorln("Could not save temporary rules:", err)
+		return
+	}
+
+	//	Write it in another file first, so a crash never leaves it half written
+	tmp := t.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		log.Errorln("Could not save temporary rules:", err)
+		return
+	}
+	if err := os.Rename(tmp, t.path); err != nil {
+		log.Errorln("Could not save temporary rules:", err)
+	}
+}
+
+// register starts expiring the rules of a graph, calling onExpire for each of them.
+// Rules of graphs that are not registered are kept until they are, even if they expired,
+// i.e. the ones that expired while ASTRID-kube was not running, so that no rule-expired event is lost.
+// Rules are also kept as long as onExpire returns false, and it is called again the next time.
+func (t *temporaryRuleStore) register(graph string, onExpire func(types.TemporaryRule) bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.onExpire[graph] = onExpire
+}
+
+func (t *temporaryRuleStore) add(rule types.TemporaryRule) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.rules = append(t.rules, rule)
+	t.save()
+}
+
+// list returns all rules of a graph, including the expired ones that were not removed yet
+func (t *temporaryRuleStore) list(graph string) []types.TemporaryRule {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	list := []types.TemporaryRule{}
+	for _, rule := range t.rules {
+		if rule.Graph == graph {
+			list = append(list, rule)
+		}
+	}
+	return list
+}
+
+// active returns the rules of a pod that did not expire yet, by direction
+// Expired ones are not, even if they were not removed yet.
+func (t *temporaryRuleStore) active(graph, pod string) map[string][]k8sfirewall.ChainRule {
+	now := time.Now()
+	active := map[string][]k8sfirewall.ChainRule{}
+	for _, rule := range t.list(graph) {
+		if rule.Pod == pod && now.Before(rule.Expires) {
+			active[rule.Direction] = append(active[rule.Direction], rule.Rule)
+		}
+	}
+	return active
+}
+
+// forget removes all rules of a pod, without removing them from its firewall
+func (t *temporaryRuleStore) forget(graph, pod string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	remaining := []types.TemporaryRule{}
+	for _, rule := range t.rules {
+		if rule.Graph != graph || rule.Pod != pod {
+			remaining = append(remaining, rule)
+		}
+	}
+	t.rules = remaining
+	t.save()
+}
+
+// expire removes all expired rules of registered graphs from their firewalls.
+// Each rule is forgotten only once it is removed, so the ones that could not be are tried again the next time.
+func (t *temporaryRuleStore) expire(now time.Time) {
+	expired := func() []types.TemporaryRule {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+
+		expired := []types.TemporaryRule{}
+		for _, rule := range t.rules {
+			if _, registered := t.onExpire[rule.Graph]; registered && now.After(rule.Expires) {
+				expired = append(expired, rule)
+			}
+		}
+		return expired
+	}()
+
+	for _, rule := range expired {
+		t.lock.Lock()
+		onExpire := t.onExpire[rule.Graph]
+		t.lock.Unlock()
+		if onExpire(rule) {
+			t.remove(rule)
+		}
+	}
+}
+
+// remove forgets a rule, if it is still there
+func (t *temporaryRuleStore) remove(removed types.TemporaryRule) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for j, rule := range t.rules {
+		if rule.Graph == removed.Graph && rule.Pod == removed.Pod && rule.Direction == removed.Direction &&
+			rule.Rule == removed.Rule && rule.Added.Equal(removed.Added) {
+			t.rules = append(t.rules[:j:j], t.rules[j+1:]...)
+			t.save()
+			return
+		}
+	}
+}
+
+// isTemporary checks if the rule was put by ASTRID-kube as a temporary rule
+func isTemporary(rule k8sfirewall.ChainRule) bool {
+	return strings.HasPrefix(rule.Description, temporaryRulePrefix)
+}
+
+// AddTemporaryRule puts a rule in the firewall of a pod, which is removed automatically after the provided time.
+// The owner is written in the description of the rule, so it can be recognized in the firewall.
+func (handler *InfrastructureHandler) AddTemporaryRule(uid, direction string, rule k8sfirewall.ChainRule, ttl time.Duration, owner, reason string) error {
+	if direction != "ingress" && direction != "egress" {
+		return errors.New("Unrecognized direction")
+	}
+	if ttl <= 0 {
+		return errors.New("Rules must expire in the future")
+	}
+
+	rule.Id = 0
+	rule.Description = temporaryRulePrefix + owner
+
+	//	The rule is saved along with putting it, so that a reconcile does not find it in the firewall without knowing it
+	return handler.reconciler.change(uid, func() error {
+		instance, exists := handler.reconciler.tracked()[uid]
+		if !exists {
+			return ErrInstanceNotFound
+		}
+
+		//	Quarantined instances get it when they are released.
+		//	It goes after the management rules and the other temporary rules, where the reconciler expects it.
+		if !instance.quarantined {
+			position := len(utils.ManagementRules(instance.firewall, direction)) + len(temporaryRules.active(handler.name, uid)[direction])
+			if err := utils.InsertRule(instance.firewall, direction, int32(position), rule); err != nil {
+				handler.log.Errorf("Could not add temporary rule to %s: %s", uid, err)
+				return err
+			}
+		}
+
+		now := time.Now().UTC()
+		temporaryRules.add(types.TemporaryRule{
+			Graph:     handler.name,
+			Pod:       uid,
+			IP:        instance.ip,
+			Direction: direction,
+			Rule:      rule,
+			Owner:     owner,
+			Reason:    reason,
+			Added:     now,
+			Expires:   now.Add(ttl),
+		})
+		handler.log.Infof("Added temporary rule to %s in %s by %s, expiring in %s", uid, direction, owner, ttl)
+		return nil
+	})
+}
+
+// TemporaryRules returns all temporary rules in the firewalls of the graph
+func (handler *InfrastructureHandler) TemporaryRules() []types.TemporaryRule {
+	return temporaryRules.list(handler.name)
+}
+
+// handleExpiredRule removes an expired rule from the firewall of its pod, which can be in the sidecar or on the node.
+// It returns false if it could not, and it must be tried again.
+func (handler *InfrastructureHandler) handleExpiredRule(rule types.TemporaryRule) bool {
+	//	After a restart, the firewall of the pod is only known once it is tracked again
+	instance, exists := handler.reconciler.tracked()[rule.Pod]
+	if !exists {
+		return false
+	}
+
+	err := handler.reconciler.change(rule.Pod, func() error {
+		return utils.DeleteMatchingRule(instance.firewall, rule.Direction, rule.Rule)
+	})
+	if err != nil {
+		handler.log.Errorf("Could not remove expired rule from %s, going to try again: %s", rule.Pod, err)
+		return false
+	}
+	handler.log.Infof("Temporary rule of %s in %s by %s expired", rule.Pod, rule.Direction, rule.Owner)
+
+	handler.infoBuilder.PushEvent(types.InfrastructureEvent{
+		GraphName: handler.name,
+		Type:      types.RuleExpired,
+		EventData: types.InfrastructureEventResource{
+			ResourceType: types.Pod,
+			Name:         instance.service,
+			Ip:           instance.ip,
+			Uid:          rule.Pod,
+			Firewall: &types.InfrastructureEventFirewall{
+				Chain:  rule.Direction,
+				Action: rule.Rule.Action,
+				Src:    rule.Rule.Src,
+				Dst:    rule.Rule.Dst,
+				Owner:  rule.Owner,
+				Reason: rule.Reason,
+			},
+		},
+	})
+	return true
+}
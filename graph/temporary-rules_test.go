@@ -0,0 +1,185 @@
+package graph
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/SunSince90/ASTRID-kube/utils"
+	"github.com/SunSince90/ASTRID-kube/utils/polycubetest"
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// testTemporaryRules replaces the temporary rules with the ones saved in a new folder, which is returned
+func testTemporaryRules(t *testing.T) (string, func()) {
+	folder, err := ioutil.TempDir("", "temporary-rules")
+	assert.NoError(t, err)
+
+	previous := temporaryRules
+	temporaryRules = loadTemporaryRules(folder)
+	return folder, func() {
+		temporaryRules = previous
+		os.RemoveAll(folder)
+	}
+}
+
+// loadTemporaryRules reads the rules saved in a folder, without expiring them in background
+func loadTemporaryRules(folder string) *temporaryRuleStore {
+	store := &temporaryRuleStore{rules: []types.TemporaryRule{}, onExpire: map[string]func(types.TemporaryRule) bool{}}
+	stop := make(chan struct{})
+	close(stop)
+	store.load(folder, stop)
+	return store
+}
+
+func TestTemporaryRules(t *testing.T) {
+	folder, restore := testTemporaryRules(t)
+	defer restore()
+	polycube, fw, stop := testPolycube(t)
+	defer stop()
+
+	recorder := &eventRecorder{}
+	handler := &InfrastructureHandler{name: "ttl", log: log.WithField("GRAPH", "ttl"), infoBuilder: recorder}
+	handler.reconciler = newFirewallReconciler("ttl", handler.log, recorder)
+	temporaryRules.register("ttl", handler.handleExpiredRule)
+
+	assert.True(t, utils.ProvisionFirewall(fw, false))
+	forward := k8sfirewall.ChainRule{Action: "forward"}
+	assert.NoError(t, utils.InsertRule(fw, "ingress", 1, forward))
+	handler.reconciler.track("apache-1", "apache", fw)
+
+	//	It takes precedence over the rules that are there
+	drop := k8sfirewall.ChainRule{Action: "drop", Src: "10.0.0.5"}
+	assert.NoError(t, handler.AddTemporaryRule("apache-1", "ingress", drop, time.Minute, "soc", "port scan"))
+	added := drop
+	added.Description = temporaryRulePrefix + "soc"
+	assert.Equal(t, []k8sfirewall.ChainRule{utils.ManagementRule(fw, "ingress"), added, forward}, withoutIds(polycube.Rules("fw", "ingress")))
+	assert.Equal(t, ErrInstanceNotFound, handler.AddTemporaryRule("apache-2", "ingress", drop, time.Minute, "soc", "port scan"))
+
+	//	and it is saved
+	saved := loadTemporaryRules(folder).list("ttl")
+	if assert.Len(t, saved, 1) {
+		assert.Equal(t, "soc", saved[0].Owner)
+		assert.Equal(t, "apache-1", saved[0].Pod)
+	}
+
+	//	Nothing happens until it expires
+	temporaryRules.expire(time.Now())
+	assert.Len(t, handler.TemporaryRules(), 1)
+	assert.Empty(t, recorder.events)
+
+	temporaryRules.expire(time.Now().Add(2 * time.Minute))
+	assert.Empty(t, handler.TemporaryRules())
+	assert.Empty(t, loadTemporaryRules(folder).list("ttl"))
+	assert.Equal(t, []k8sfirewall.ChainRule{utils.ManagementRule(fw, "ingress"), forward}, withoutIds(polycube.Rules("fw", "ingress")))
+	if assert.Len(t, recorder.events, 1) {
+		assert.Equal(t, types.RuleExpired, recorder.events[0].Type)
+		assert.Equal(t, "apache", recorder.events[0].EventData.Name)
+		assert.Equal(t, "port scan", recorder.events[0].EventData.Firewall.Reason)
+	}
+}
+
+func TestTemporaryRulesRestart(t *testing.T) {
+	folder, restore := testTemporaryRules(t)
+	defer restore()
+	polycube, fw, stop := testPolycube(t)
+	defer stop()
+
+	assert.True(t, utils.ProvisionFirewall(fw, false))
+	drop := k8sfirewall.ChainRule{Action: "drop", Src: "10.0.0.5", Description: temporaryRulePrefix + "soc"}
+	assert.NoError(t, utils.InsertRule(fw, "ingress", 1, drop))
+
+	//	It expired while ASTRID-kube was not running
+	now := time.Now()
+	temporaryRules.add(types.TemporaryRule{Graph: "restarted", Pod: "apache-1", IP: fw.IP(), Direction: "ingress", Rule: drop, Owner: "soc", Added: now.Add(-time.Hour), Expires: now.Add(-time.Minute)})
+	temporaryRules.add(types.TemporaryRule{Graph: "restarted", Pod: "apache-2", IP: "10.0.0.2", Direction: "ingress", Rule: drop, Owner: "soc", Added: now, Expires: now.Add(time.Hour)})
+	temporaryRules = loadTemporaryRules(folder)
+	assert.Len(t, temporaryRules.list("restarted"), 2)
+
+	//	It is kept until its graph is back, so that the event is sent
+	temporaryRules.expire(now)
+	assert.Len(t, temporaryRules.list("restarted"), 2)
+	assert.Len(t, polycube.Rules("fw", "ingress"), 2)
+
+	//	and its pod is tracked again, so that it is removed from the right firewall
+	recorder := &eventRecorder{}
+	handler := &InfrastructureHandler{name: "restarted", log: log.WithField("GRAPH", "restarted"), infoBuilder: recorder}
+	handler.reconciler = newFirewallReconciler("restarted", handler.log, recorder)
+	temporaryRules.register("restarted", handler.handleExpiredRule)
+	temporaryRules.expire(now)
+	assert.Len(t, temporaryRules.list("restarted"), 2)
+	assert.Len(t, polycube.Rules("fw", "ingress"), 2)
+	assert.Empty(t, recorder.events)
+
+	handler.reconciler.track("apache-1", "apache", fw)
+	temporaryRules.expire(now)
+	if assert.Len(t, recorder.events, 1) {
+		assert.Equal(t, "apache-1", recorder.events[0].EventData.Uid)
+	}
+	assert.Equal(t, []k8sfirewall.ChainRule{utils.ManagementRule(fw, "ingress")}, withoutIds(polycube.Rules("fw", "ingress")))
+
+	remaining := loadTemporaryRules(folder).list("restarted")
+	if assert.Len(t, remaining, 1) {
+		assert.Equal(t, "apache-2", remaining[0].Pod)
+	}
+}
+
+func TestTemporaryRulesRetry(t *testing.T) {
+	folder, restore := testTemporaryRules(t)
+	defer restore()
+	polycube, fw, stop := testPolycube(t)
+	defer stop()
+
+	recorder := &eventRecorder{}
+	handler := &InfrastructureHandler{name: "retry", log: log.WithField("GRAPH", "retry"), infoBuilder: recorder}
+	handler.reconciler = newFirewallReconciler("retry", handler.log, recorder)
+	temporaryRules.register("retry", handler.handleExpiredRule)
+
+	assert.True(t, utils.ProvisionFirewall(fw, false))
+	handler.reconciler.track("apache-1", "apache", fw)
+	drop := k8sfirewall.ChainRule{Action: "drop", Src: "10.0.0.5"}
+	assert.NoError(t, handler.AddTemporaryRule("apache-1", "ingress", drop, time.Minute, "soc", "port scan"))
+
+	//	It is kept, without any event, until it is removed from the firewall
+	polycube.Fail("DELETE", "firewall/fw/chain/ingress/rule/1/", 500)
+	temporaryRules.expire(time.Now().Add(2 * time.Minute))
+	assert.Len(t, loadTemporaryRules(folder).list("retry"), 1)
+	assert.Len(t, polycube.Rules("fw", "ingress"), 2)
+	assert.Empty(t, recorder.events)
+
+	polycube.Fail("DELETE", "firewall/fw/chain/ingress/rule/1/", 0)
+	temporaryRules.expire(time.Now().Add(2 * time.Minute))
+	assert.Empty(t, loadTemporaryRules(folder).list("retry"))
+	assert.Equal(t, []k8sfirewall.ChainRule{utils.ManagementRule(fw, "ingress")}, withoutIds(polycube.Rules("fw", "ingress")))
+	assert.Len(t, recorder.events, 1)
+}
+
+func TestTemporaryRulesNodeFirewall(t *testing.T) {
+	_, restore := testTemporaryRules(t)
+	defer restore()
+	polycube, sidecar, stop := testPolycube(t)
+	defer stop()
+	ip := "10.0.0.9"
+	fw := utils.NodeFirewall(ip, sidecar.IP(), polycube.Port())
+
+	recorder := &eventRecorder{}
+	handler := &InfrastructureHandler{name: "node-ttl", log: log.WithField("GRAPH", "node-ttl"), infoBuilder: recorder}
+	handler.reconciler = newFirewallReconciler("node-ttl", handler.log, recorder)
+
+	//	The firewall of pcn-k8s has no management rules and is not interactive
+	pcn := k8sfirewall.ChainRule{Action: "forward", Src: "10.0.0.2"}
+	polycube.SetFirewall("fw-"+ip, polycubetest.Firewall{Chains: map[string][]k8sfirewall.ChainRule{"egress": {pcn}}})
+	handler.reconciler.track("apache-1", "apache", fw)
+
+	drop := k8sfirewall.ChainRule{Action: "drop", Src: "10.0.0.5"}
+	calls := len(polycube.Calls())
+	assert.NoError(t, handler.AddTemporaryRule("apache-1", "ingress", drop, time.Minute, "soc", "port scan"))
+	added := drop
+	added.Description = temporaryRulePrefix + "soc"
+	assert.Equal(t, []k8sfirewall.ChainRule{added, pcn}, withoutIds(polycube.Rules("fw-"+ip, "egress")))
+	assert.Contains(t, polycube.Calls()[calls:], "POST firewall/fw-"+ip+"/chain/egress/apply-rules/")
+}
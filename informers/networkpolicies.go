@@ -0,0 +1,120 @@
+package informers
+
+import (
+	"github.com/SunSince90/ASTRID-kube/settings"
+	log "github.com/sirupsen/logrus"
+	networking_v1 "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+type NetworkPoliciesInformer struct {
+	informer    cache.SharedIndexInformer
+	namespace   string
+	stopChannel chan struct{}
+}
+
+func newNetworkPoliciesInformer(namespace string) Informer {
+	npInformer := &NetworkPoliciesInformer{
+		namespace:   namespace,
+		stopChannel: make(chan struct{}),
+	}
+
+	npInformer.initInformer()
+
+	return npInformer
+}
+
+func (npInformer *NetworkPoliciesInformer) initInformer() {
+	//	Get the informer
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+			return settings.Clientset.NetworkingV1().NetworkPolicies(npInformer.namespace).List(options)
+		},
+		WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+			return settings.Clientset.NetworkingV1().NetworkPolicies(npInformer.namespace).Watch(options)
+		},
+	},
+		&networking_v1.NetworkPolicy{},
+		0, //Skip resync
+		cache.Indexers{},
+	)
+
+	npInformer.informer = informer
+}
+
+func (npInformer *NetworkPoliciesInformer) Start() {
+	go npInformer.informer.Run(npInformer.stopChannel)
+}
+
+func (npInformer *NetworkPoliciesInformer) Stop() {
+	close(npInformer.stopChannel)
+}
+
+func (npInformer *NetworkPoliciesInformer) AddEventHandler(add func(interface{}), update func(interface{}, interface{}), delete func(interface{})) {
+	npInformer.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			policy := npInformer.parseObject(obj)
+			if policy != nil && add != nil {
+				add(policy)
+			}
+		},
+		UpdateFunc: func(old, obj interface{}) {
+			policy := npInformer.parseObject(obj)
+			if policy != nil && update != nil {
+				update(old, policy)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			policy := npInformer.parseObject(obj)
+			if policy != nil && delete != nil {
+				delete(policy)
+			}
+		},
+	})
+}
+
+func (npInformer *NetworkPoliciesInformer) parseObject(obj interface{}) *networking_v1.NetworkPolicy {
+	//------------------------------------
+	//	Try to get it
+	//------------------------------------
+
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		log.Errorln("Error while trying to parse obj:", err)
+		return nil
+	}
+
+	//	try to get the object
+	parsedObject, _, err := npInformer.informer.GetIndexer().GetByKey(key)
+	if err != nil {
+		log.Errorf("An error occurred: cannot find cache element with key %s from store %v", key, err)
+		return nil
+	}
+
+	var policy *networking_v1.NetworkPolicy
+	policy, ok := parsedObject.(*networking_v1.NetworkPolicy)
+	if !ok {
+		policy, ok = obj.(*networking_v1.NetworkPolicy)
+		if !ok {
+			tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+			if !ok {
+				log.Errorln("error decoding object, invalid type")
+				return nil
+			}
+			policy, ok = tombstone.Obj.(*networking_v1.NetworkPolicy)
+			if !ok {
+				log.Errorln("error decoding object tombstone, invalid type")
+				return nil
+			}
+			log.Infof("Recovered deleted object '%s' from tombstone", policy.Name)
+		}
+	}
+
+	//------------------------------------
+	//	Add it
+	//------------------------------------
+	return policy
+}
@@ -1,6 +1,7 @@
 package informers
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/SunSince90/ASTRID-kube/settings"
@@ -147,5 +148,18 @@ func (nodeInformer *NodeInformer) Current() []types.InfrastructureInfoNode {
 		nodes = append(nodes, val)
 	}
 
+	//	Always in the same order, so that the same nodes give the same infrastructure info
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].IP < nodes[j].IP
+	})
 	return nodes
 }
+
+// IP returns the address of a node, by its hostname
+func (nodeInformer *NodeInformer) IP(name string) (string, bool) {
+	nodeInformer.lock.Lock()
+	defer nodeInformer.lock.Unlock()
+
+	node, exists := nodeInformer.current[name]
+	return node.IP, exists
+}
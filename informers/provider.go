@@ -15,6 +15,8 @@ func New(what astrid_types.InformerType, namespace string) Informer {
 		return newPodsInformer(namespace)
 	case astrid_types.Nodes:
 		return newNodesInformer()
+	case astrid_types.NetworkPolicies:
+		return newNetworkPoliciesInformer(namespace)
 	}
 
 	return nil
@@ -4,10 +4,14 @@ import (
 	"os"
 	"os/signal"
 
+	"github.com/SunSince90/ASTRID-kube/api"
 	graph "github.com/SunSince90/ASTRID-kube/graph"
 	"github.com/SunSince90/ASTRID-kube/informers"
+	"github.com/SunSince90/ASTRID-kube/metrics"
+	"github.com/SunSince90/ASTRID-kube/rpc"
 	"github.com/SunSince90/ASTRID-kube/settings"
 	types "github.com/SunSince90/ASTRID-kube/types"
+	"github.com/SunSince90/ASTRID-kube/webhook"
 	"github.com/kardianos/osext"
 	log "github.com/sirupsen/logrus"
 	"k8s.io/client-go/kubernetes"
@@ -30,6 +34,9 @@ func main() {
 	}
 
 	settings.Load(folderPath + "/settings/conf.yaml")
+	if len(settings.Settings.Paths.State) < 1 {
+		settings.Settings.Paths.State = folderPath + "/state"
+	}
 	log.Infoln("Configuration file loaded successfully")
 
 	//----------------------------------------
@@ -38,6 +45,10 @@ func main() {
 	clientset := getClientSet()
 	settings.Clientset = clientset
 
+	if len(settings.Settings.Metrics.Address) > 0 {
+		go metrics.Serve(settings.Settings.Metrics.Address)
+	}
+
 	//	Set up the node informer
 	informers.Nodes = informers.New(types.Nodes, "").(*informers.NodeInformer)
 	informers.Nodes.AddEventHandler(nil, nil, nil)
@@ -48,6 +59,18 @@ func main() {
 	graphManager := graph.InitManager(clientset, stop)
 	graphManager.Start()
 
+	if len(settings.Settings.API.Address) > 0 {
+		go api.Serve(settings.Settings.API.Address, settings.Settings.API.Token, graphManager)
+	}
+
+	if len(settings.Settings.GRPC.Address) > 0 {
+		go rpc.Serve(settings.Settings.GRPC.Address, settings.Settings.GRPC.Token, graphManager)
+	}
+
+	if len(settings.Settings.Webhook.Address) > 0 {
+		startWebhook(clientset)
+	}
+
 	cleanupDone = make(chan struct{})
 	signal.Notify(signalChan, os.Interrupt)
 	go cleanUp()
@@ -70,6 +93,23 @@ func getClientSet() kubernetes.Interface {
 	return clientset
 }
 
+func startWebhook(clientset kubernetes.Interface) {
+	//	pcn-k8s already runs polycube on each node
+	if settings.Settings.FirewallMode == types.NodeMode {
+		log.Infoln("Firewalls run on nodes, sidecars will not be injected")
+		return
+	}
+
+	template, err := webhook.LoadTemplate(settings.Settings.Webhook.Template)
+	if err != nil {
+		log.Errorln("Could not load the sidecar template, sidecars will not be injected:", err)
+		return
+	}
+
+	injector := webhook.New(clientset, template)
+	go webhook.Serve(settings.Settings.Webhook.Address, settings.Settings.Webhook.Cert, settings.Settings.Webhook.Key, injector)
+}
+
 func cleanUp() {
 	<-signalChan
 	close(stop)
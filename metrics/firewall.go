@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// FirewallCounters are the packets and bytes that matched a rule of a firewall
+type FirewallCounters struct {
+	//	Rule is the id of the rule in its chain
+	Rule        int32
+	Action      string
+	Description string
+	Packets     uint64
+	Bytes       uint64
+}
+
+type firewallKey struct {
+	graph     string
+	service   string
+	pod       string
+	direction string
+}
+
+// firewallCollector exposes the counters read from firewalls as they are, without keeping its own counters
+type firewallCollector struct {
+	lock        sync.Mutex
+	packets     *prometheus.Desc
+	bytes       *prometheus.Desc
+	rulePackets *prometheus.Desc
+	ruleBytes   *prometheus.Desc
+	current     map[firewallKey][]FirewallCounters
+}
+
+var firewallStats = &firewallCollector{
+	packets:     prometheus.NewDesc(namespace+"_firewall_packets_total", "Packets that matched rules of the firewall, by action.", []string{"graph", "service", "pod", "direction", "action"}, nil),
+	bytes:       prometheus.NewDesc(namespace+"_firewall_bytes_total", "Bytes that matched rules of the firewall, by action.", []string{"graph", "service", "pod", "direction", "action"}, nil),
+	rulePackets: prometheus.NewDesc(namespace+"_firewall_rule_packets_total", "Packets that matched each rule of the firewall.", []string{"graph", "service", "pod", "direction", "rule", "action", "description"}, nil),
+	ruleBytes:   prometheus.NewDesc(namespace+"_firewall_rule_bytes_total", "Bytes that matched each rule of the firewall.", []string{"graph", "service", "pod", "direction", "rule", "action", "description"}, nil),
+	current:     map[firewallKey][]FirewallCounters{},
+}
+
+func (c *firewallCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.packets
+	ch <- c.bytes
+	ch <- c.rulePackets
+	ch <- c.ruleBytes
+}
+
+func (c *firewallCollector) Collect(ch chan<- prometheus.Metric) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for k, rules := range c.current {
+		byAction := map[string]FirewallCounters{}
+		for _, rule := range rules {
+			rule.Action = strings.ToLower(rule.Action)
+			if len(rule.Action) < 1 {
+				rule.Action = "drop"
+			}
+			id := strconv.Itoa(int(rule.Rule))
+			ch <- prometheus.MustNewConstMetric(c.rulePackets, prometheus.CounterValue, float64(rule.Packets), k.graph, k.service, k.pod, k.direction, id, rule.Action, rule.Description)
+			ch <- prometheus.MustNewConstMetric(c.ruleBytes, prometheus.CounterValue, float64(rule.Bytes), k.graph, k.service, k.pod, k.direction, id, rule.Action, rule.Description)
+
+			total := byAction[rule.Action]
+			total.Packets += rule.Packets
+			total.Bytes += rule.Bytes
+			byAction[rule.Action] = total
+		}
+
+		//	Totals by action are there for convenience, i.e. to see everything that was dropped
+		for action, total := range byAction {
+			ch <- prometheus.MustNewConstMetric(c.packets, prometheus.CounterValue, float64(total.Packets), k.graph, k.service, k.pod, k.direction, action)
+			ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.CounterValue, float64(total.Bytes), k.graph, k.service, k.pod, k.direction, action)
+		}
+	}
+}
+
+// SetFirewallCounters replaces the counters of the rules in a chain of a pod's firewall
+func SetFirewallCounters(graph, service, pod, direction string, rules []FirewallCounters) {
+	firewallStats.lock.Lock()
+	defer firewallStats.lock.Unlock()
+
+	for k := range firewallStats.current {
+		if k.graph == graph && k.pod == pod && k.direction == direction {
+			delete(firewallStats.current, k)
+		}
+	}
+
+	firewallStats.current[firewallKey{graph: graph, service: service, pod: pod, direction: direction}] = append([]FirewallCounters{}, rules...)
+}
+
+// DeleteFirewallCounters stops exposing the counters of a pod's firewall
+func DeleteFirewallCounters(graph, pod string) {
+	firewallStats.lock.Lock()
+	defer firewallStats.lock.Unlock()
+
+	for k := range firewallStats.current {
+		if k.graph == graph && k.pod == pod {
+			delete(firewallStats.current, k)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+const namespace = "astrid"
+
+var (
+	// FirewallDrift counts the times the rules enforced in a firewall were found different from the declared ones
+	FirewallDrift = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "firewall_drift_total",
+		Help:      "Number of times the live firewall rules were found different from the declared ones.",
+	}, []string{"graph", "pod", "direction"})
+
+	// Graphs is the number of graphs in each phase
+	Graphs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "graphs",
+		Help:      "Number of graphs in each phase.",
+	}, []string{"phase"})
+
+	// ProvisioningDuration is how long it takes to provision a firewall
+	ProvisioningDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "firewall_provisioning_duration_seconds",
+		Help:      "Time needed to provision the firewall of an instance, retries included.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"graph"})
+
+	// SendFailures counts the data that could not be delivered
+	SendFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "send_failures_total",
+		Help:      "Number of times data could not be delivered to an endpoint.",
+	}, []string{"graph", "destination"})
+
+	// MisconfiguredInstances is the number of instances that cannot be protected because of their polycube sidecar
+	MisconfiguredInstances = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "misconfigured_instances",
+		Help:      "Number of instances whose polycube sidecar is missing or misconfigured.",
+	}, []string{"graph"})
+
+	// ProvisioningQueueDepth is the number of instances waiting to be provisioned
+	ProvisioningQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "provisioning_queue_depth",
+		Help:      "Number of instances waiting for their firewall to be provisioned.",
+	}, []string{"graph"})
+
+	// ProvisioningQueueLatency is how long instances wait in the queue before being provisioned
+	ProvisioningQueueLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provisioning_queue_latency_seconds",
+		Help:      "Time an instance waits in the provisioning queue, init timer excluded.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"graph"})
+
+	// ProvisioningRetries counts the times provisioning a firewall was tried again
+	ProvisioningRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provisioning_retries_total",
+		Help:      "Number of times provisioning a firewall failed and was queued again.",
+	}, []string{"graph"})
+
+	// OutboxPending is the data waiting to be delivered to an endpoint
+	OutboxPending = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "outbox_pending",
+		Help:      "Number of infrastructure info and events waiting to be delivered to an endpoint.",
+	}, []string{"graph", "destination"})
+
+	// OutboxOverflows counts the times too many events were waiting to be delivered to an endpoint
+	OutboxOverflows = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_overflows_total",
+		Help:      "Number of times events were coalesced or dropped because too many were waiting for an endpoint.",
+	}, []string{"graph", "destination"})
+
+	// OutboxLatency is how long data waits before being delivered to an endpoint
+	OutboxLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "outbox_latency_seconds",
+		Help:      "Time from when data is generated to when it is delivered to an endpoint, retries included.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"graph", "destination"})
+)
+
+func init() {
+	prometheus.MustRegister(FirewallDrift, Graphs, ProvisioningDuration, SendFailures, MisconfiguredInstances,
+		ProvisioningQueueDepth, ProvisioningQueueLatency, ProvisioningRetries, OutboxPending, OutboxOverflows, OutboxLatency, firewallStats)
+}
+
+// Serve exposes all metrics on /metrics at the provided address
+func Serve(address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	log.Infoln("Serving metrics on", address)
+	if err := http.ListenAndServe(address, mux); err != nil {
+		log.Errorln("Could not serve metrics:", err)
+	}
+}
@@ -0,0 +1,1324 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: astrid.proto
+
+package rpc
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
+	wrappers "github.com/golang/protobuf/ptypes/wrappers"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type ListGraphsRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListGraphsRequest) Reset()         { *m = ListGraphsRequest{} }
+func (m *ListGraphsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListGraphsRequest) ProtoMessage()    {}
+func (*ListGraphsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d99b360a3c24bca1, []int{0}
+}
+
+func (m *ListGraphsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListGraphsRequest.Unmarshal(m, b)
+}
+func (m *ListGraphsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListGraphsRequest.Marshal(b, m, deterministic)
+}
+func (m *ListGraphsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListGraphsRequest.Merge(m, src)
+}
+func (m *ListGraphsRequest) XXX_Size() int {
+	return xxx_messageInfo_ListGraphsRequest.Size(m)
+}
+func (m *ListGraphsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListGraphsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListGraphsRequest proto.InternalMessageInfo
+
+type ListGraphsResponse struct {
+	Graphs               []*Graph `protobuf:"bytes,1,rep,name=graphs,proto3" json:"graphs,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListGraphsResponse) Reset()         { *m = ListGraphsResponse{} }
+func (m *ListGraphsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListGraphsResponse) ProtoMessage()    {}
+func (*ListGraphsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d99b360a3c24bca1, []int{1}
+}
+
+func (m *ListGraphsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListGraphsResponse.Unmarshal(m, b)
+}
+func (m *ListGraphsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListGraphsResponse.Marshal(b, m, deterministic)
+}
+func (m *ListGraphsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListGraphsResponse.Merge(m, src)
+}
+func (m *ListGraphsResponse) XXX_Size() int {
+	return xxx_messageInfo_ListGraphsResponse.Size(m)
+}
+func (m *ListGraphsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListGraphsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListGraphsResponse proto.InternalMessageInfo
+
+func (m *ListGraphsResponse) GetGraphs() []*Graph {
+	if m != nil {
+		return m.Graphs
+	}
+	return nil
+}
+
+type Graph struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Phase string `protobuf:"bytes,2,opt,name=phase,proto3" json:"phase,omitempty"`
+	// Instances that cannot be protected, with everything that is wrong in each of them
+	Misconfigured        map[string]*Problems `protobuf:"bytes,3,rep,name=misconfigured,proto3" json:"misconfigured,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *Graph) Reset()         { *m = Graph{} }
+func (m *Graph) String() string { return proto.CompactTextString(m) }
+func (*Graph) ProtoMessage()    {}
+func (*Graph) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d99b360a3c24bca1, []int{2}
+}
+
+func (m *Graph) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Graph.Unmarshal(m, b)
+}
+func (m *Graph) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Graph.Marshal(b, m, deterministic)
+}
+func (m *Graph) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Graph.Merge(m, src)
+}
+func (m *Graph) XXX_Size() int {
+	return xxx_messageInfo_Graph.Size(m)
+}
+func (m *Graph) XXX_DiscardUnknown() {
+	xxx_messageInfo_Graph.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Graph proto.InternalMessageInfo
+
+func (m *Graph) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Graph) GetPhase() string {
+	if m != nil {
+		return m.Phase
+	}
+	return ""
+}
+
+func (m *Graph) GetMisconfigured() map[string]*Problems {
+	if m != nil {
+		return m.Misconfigured
+	}
+	return nil
+}
+
+type Problems struct {
+	Problems             []string `protobuf:"bytes,1,rep,name=problems,proto3" json:"problems,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Problems) Reset()         { *m = Problems{} }
+func (m *Problems) String() string { return proto.CompactTextString(m) }
+func (*Problems) ProtoMessage()    {}
+func (*Problems) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d99b360a3c24bca1, []int{3}
+}
+
+func (m *Problems) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Problems.Unmarshal(m, b)
+}
+func (m *Problems) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Problems.Marshal(b, m, deterministic)
+}
+func (m *Problems) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Problems.Merge(m, src)
+}
+func (m *Problems) XXX_Size() int {
+	return xxx_messageInfo_Problems.Size(m)
+}
+func (m *Problems) XXX_DiscardUnknown() {
+	xxx_messageInfo_Problems.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Problems proto.InternalMessageInfo
+
+func (m *Problems) GetProblems() []string {
+	if m != nil {
+		return m.Problems
+	}
+	return nil
+}
+
+type GetInfrastructureInfoRequest struct {
+	Graph                string   `protobuf:"bytes,1,opt,name=graph,proto3" json:"graph,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetInfrastructureInfoRequest) Reset()         { *m = GetInfrastructureInfoRequest{} }
+func (m *GetInfrastructureInfoRequest) String() string { return proto.CompactTextString(m) }
+func (*GetInfrastructureInfoRequest) ProtoMessage()    {}
+func (*GetInfrastructureInfoRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d99b360a3c24bca1, []int{4}
+}
+
+func (m *GetInfrastructureInfoRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetInfrastructureInfoRequest.Unmarshal(m, b)
+}
+func (m *GetInfrastructureInfoRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetInfrastructureInfoRequest.Marshal(b, m, deterministic)
+}
+func (m *GetInfrastructureInfoRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetInfrastructureInfoRequest.Merge(m, src)
+}
+func (m *GetInfrastructureInfoRequest) XXX_Size() int {
+	return xxx_messageInfo_GetInfrastructureInfoRequest.Size(m)
+}
+func (m *GetInfrastructureInfoRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetInfrastructureInfoRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetInfrastructureInfoRequest proto.InternalMessageInfo
+
+func (m *GetInfrastructureInfoRequest) GetGraph() string {
+	if m != nil {
+		return m.Graph
+	}
+	return ""
+}
+
+type WatchEventsRequest struct {
+	// Empty to watch all graphs
+	Graph string `protobuf:"bytes,1,opt,name=graph,proto3" json:"graph,omitempty"`
+	// Only the events after this sequence are sent before the new ones, if set
+	Since                *wrappers.UInt64Value `protobuf:"bytes,2,opt,name=since,proto3" json:"since,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}              `json:"-"`
+	XXX_unrecognized     []byte                `json:"-"`
+	XXX_sizecache        int32                 `json:"-"`
+}
+
+func (m *WatchEventsRequest) Reset()         { *m = WatchEventsRequest{} }
+func (m *WatchEventsRequest) String() string { return proto.CompactTextString(m) }
+func (*WatchEventsRequest) ProtoMessage()    {}
+func (*WatchEventsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d99b360a3c24bca1, []int{5}
+}
+
+func (m *WatchEventsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WatchEventsRequest.Unmarshal(m, b)
+}
+func (m *WatchEventsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WatchEventsRequest.Marshal(b, m, deterministic)
+}
+func (m *WatchEventsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WatchEventsRequest.Merge(m, src)
+}
+func (m *WatchEventsRequest) XXX_Size() int {
+	return xxx_messageInfo_WatchEventsRequest.Size(m)
+}
+func (m *WatchEventsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_WatchEventsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WatchEventsRequest proto.InternalMessageInfo
+
+func (m *WatchEventsRequest) GetGraph() string {
+	if m != nil {
+		return m.Graph
+	}
+	return ""
+}
+
+func (m *WatchEventsRequest) GetSince() *wrappers.UInt64Value {
+	if m != nil {
+		return m.Since
+	}
+	return nil
+}
+
+// InfrastructureInfo mirrors types.InfrastructureInfo
+type InfrastructureInfo struct {
+	Kind                 string                      `protobuf:"bytes,1,opt,name=kind,proto3" json:"kind,omitempty"`
+	Metadata             *InfrastructureInfoMetadata `protobuf:"bytes,2,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	Spec                 *InfrastructureInfoSpec     `protobuf:"bytes,3,opt,name=spec,proto3" json:"spec,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                    `json:"-"`
+	XXX_unrecognized     []byte                      `json:"-"`
+	XXX_sizecache        int32                       `json:"-"`
+}
+
+func (m *InfrastructureInfo) Reset()         { *m = InfrastructureInfo{} }
+func (m *InfrastructureInfo) String() string { return proto.CompactTextString(m) }
+func (*InfrastructureInfo) ProtoMessage()    {}
+func (*InfrastructureInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d99b360a3c24bca1, []int{6}
+}
+
+func (m *InfrastructureInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InfrastructureInfo.Unmarshal(m, b)
+}
+func (m *InfrastructureInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InfrastructureInfo.Marshal(b, m, deterministic)
+}
+func (m *InfrastructureInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InfrastructureInfo.Merge(m, src)
+}
+func (m *InfrastructureInfo) XXX_Size() int {
+	return xxx_messageInfo_InfrastructureInfo.Size(m)
+}
+func (m *InfrastructureInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_InfrastructureInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InfrastructureInfo proto.InternalMessageInfo
+
+func (m *InfrastructureInfo) GetKind() string {
+	if m != nil {
+		return m.Kind
+	}
+	return ""
+}
+
+func (m *InfrastructureInfo) GetMetadata() *InfrastructureInfoMetadata {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
+func (m *InfrastructureInfo) GetSpec() *InfrastructureInfoSpec {
+	if m != nil {
+		return m.Spec
+	}
+	return nil
+}
+
+type InfrastructureInfoMetadata struct {
+	Name                 string               `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	LastUpdate           *timestamp.Timestamp `protobuf:"bytes,2,opt,name=last_update,json=lastUpdate,proto3" json:"last_update,omitempty"`
+	Revision             uint64               `protobuf:"varint,3,opt,name=revision,proto3" json:"revision,omitempty"`
+	Sequence             uint64               `protobuf:"varint,4,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *InfrastructureInfoMetadata) Reset()         { *m = InfrastructureInfoMetadata{} }
+func (m *InfrastructureInfoMetadata) String() string { return proto.CompactTextString(m) }
+func (*InfrastructureInfoMetadata) ProtoMessage()    {}
+func (*InfrastructureInfoMetadata) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d99b360a3c24bca1, []int{7}
+}
+
+func (m *InfrastructureInfoMetadata) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InfrastructureInfoMetadata.Unmarshal(m, b)
+}
+func (m *InfrastructureInfoMetadata) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InfrastructureInfoMetadata.Marshal(b, m, deterministic)
+}
+func (m *InfrastructureInfoMetadata) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InfrastructureInfoMetadata.Merge(m, src)
+}
+func (m *InfrastructureInfoMetadata) XXX_Size() int {
+	return xxx_messageInfo_InfrastructureInfoMetadata.Size(m)
+}
+func (m *InfrastructureInfoMetadata) XXX_DiscardUnknown() {
+	xxx_messageInfo_InfrastructureInfoMetadata.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InfrastructureInfoMetadata proto.InternalMessageInfo
+
+func (m *InfrastructureInfoMetadata) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *InfrastructureInfoMetadata) GetLastUpdate() *timestamp.Timestamp {
+	if m != nil {
+		return m.LastUpdate
+	}
+	return nil
+}
+
+func (m *InfrastructureInfoMetadata) GetRevision() uint64 {
+	if m != nil {
+		return m.Revision
+	}
+	return 0
+}
+
+func (m *InfrastructureInfoMetadata) GetSequence() uint64 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+type InfrastructureInfoSpec struct {
+	Nodes                []*InfrastructureInfoNode    `protobuf:"bytes,1,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	Services             []*InfrastructureInfoService `protobuf:"bytes,2,rep,name=services,proto3" json:"services,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                     `json:"-"`
+	XXX_unrecognized     []byte                       `json:"-"`
+	XXX_sizecache        int32                        `json:"-"`
+}
+
+func (m *InfrastructureInfoSpec) Reset()         { *m = InfrastructureInfoSpec{} }
+func (m *InfrastructureInfoSpec) String() string { return proto.CompactTextString(m) }
+func (*InfrastructureInfoSpec) ProtoMessage()    {}
+func (*InfrastructureInfoSpec) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d99b360a3c24bca1, []int{8}
+}
+
+func (m *InfrastructureInfoSpec) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InfrastructureInfoSpec.Unmarshal(m, b)
+}
+func (m *InfrastructureInfoSpec) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InfrastructureInfoSpec.Marshal(b, m, deterministic)
+}
+func (m *InfrastructureInfoSpec) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InfrastructureInfoSpec.Merge(m, src)
+}
+func (m *InfrastructureInfoSpec) XXX_Size() int {
+	return xxx_messageInfo_InfrastructureInfoSpec.Size(m)
+}
+func (m *InfrastructureInfoSpec) XXX_DiscardUnknown() {
+	xxx_messageInfo_InfrastructureInfoSpec.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InfrastructureInfoSpec proto.InternalMessageInfo
+
+func (m *InfrastructureInfoSpec) GetNodes() []*InfrastructureInfoNode {
+	if m != nil {
+		return m.Nodes
+	}
+	return nil
+}
+
+func (m *InfrastructureInfoSpec) GetServices() []*InfrastructureInfoService {
+	if m != nil {
+		return m.Services
+	}
+	return nil
+}
+
+type InfrastructureInfoNode struct {
+	Ip                   string   `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InfrastructureInfoNode) Reset()         { *m = InfrastructureInfoNode{} }
+func (m *InfrastructureInfoNode) String() string { return proto.CompactTextString(m) }
+func (*InfrastructureInfoNode) ProtoMessage()    {}
+func (*InfrastructureInfoNode) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d99b360a3c24bca1, []int{9}
+}
+
+func (m *InfrastructureInfoNode) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InfrastructureInfoNode.Unmarshal(m, b)
+}
+func (m *InfrastructureInfoNode) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InfrastructureInfoNode.Marshal(b, m, deterministic)
+}
+func (m *InfrastructureInfoNode) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InfrastructureInfoNode.Merge(m, src)
+}
+func (m *InfrastructureInfoNode) XXX_Size() int {
+	return xxx_messageInfo_InfrastructureInfoNode.Size(m)
+}
+func (m *InfrastructureInfoNode) XXX_DiscardUnknown() {
+	xxx_messageInfo_InfrastructureInfoNode.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InfrastructureInfoNode proto.InternalMessageInfo
+
+func (m *InfrastructureInfoNode) GetIp() string {
+	if m != nil {
+		return m.Ip
+	}
+	return ""
+}
+
+type InfrastructureInfoService struct {
+	Name                 string                                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	SecurityComponents   []*InfrastructureInfoSecurityComponent `protobuf:"bytes,2,rep,name=security_components,json=securityComponents,proto3" json:"security_components,omitempty"`
+	Ports                []*InfrastructureInfoServicePort       `protobuf:"bytes,3,rep,name=ports,proto3" json:"ports,omitempty"`
+	Instances            []*InfrastructureInfoServiceInstance   `protobuf:"bytes,4,rep,name=instances,proto3" json:"instances,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                               `json:"-"`
+	XXX_unrecognized     []byte                                 `json:"-"`
+	XXX_sizecache        int32                                  `json:"-"`
+}
+
+func (m *InfrastructureInfoService) Reset()         { *m = InfrastructureInfoService{} }
+func (m *InfrastructureInfoService) String() string { return proto.CompactTextString(m) }
+func (*InfrastructureInfoService) ProtoMessage()    {}
+func (*InfrastructureInfoService) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d99b360a3c24bca1, []int{10}
+}
+
+func (m *InfrastructureInfoService) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InfrastructureInfoService.Unmarshal(m, b)
+}
+func (m *InfrastructureInfoService) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InfrastructureInfoService.Marshal(b, m, deterministic)
+}
+func (m *InfrastructureInfoService) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InfrastructureInfoService.Merge(m, src)
+}
+func (m *InfrastructureInfoService) XXX_Size() int {
+	return xxx_messageInfo_InfrastructureInfoService.Size(m)
+}
+func (m *InfrastructureInfoService) XXX_DiscardUnknown() {
+	xxx_messageInfo_InfrastructureInfoService.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InfrastructureInfoService proto.InternalMessageInfo
+
+func (m *InfrastructureInfoService) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *InfrastructureInfoService) GetSecurityComponents() []*InfrastructureInfoSecurityComponent {
+	if m != nil {
+		return m.SecurityComponents
+	}
+	return nil
+}
+
+func (m *InfrastructureInfoService) GetPorts() []*InfrastructureInfoServicePort {
+	if m != nil {
+		return m.Ports
+	}
+	return nil
+}
+
+func (m *InfrastructureInfoService) GetInstances() []*InfrastructureInfoServiceInstance {
+	if m != nil {
+		return m.Instances
+	}
+	return nil
+}
+
+type InfrastructureInfoSecurityComponent struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InfrastructureInfoSecurityComponent) Reset()         { *m = InfrastructureInfoSecurityComponent{} }
+func (m *InfrastructureInfoSecurityComponent) String() string { return proto.CompactTextString(m) }
+func (*InfrastructureInfoSecurityComponent) ProtoMessage()    {}
+func (*InfrastructureInfoSecurityComponent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d99b360a3c24bca1, []int{11}
+}
+
+func (m *InfrastructureInfoSecurityComponent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InfrastructureInfoSecurityComponent.Unmarshal(m, b)
+}
+func (m *InfrastructureInfoSecurityComponent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InfrastructureInfoSecurityComponent.Marshal(b, m, deterministic)
+}
+func (m *InfrastructureInfoSecurityComponent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InfrastructureInfoSecurityComponent.Merge(m, src)
+}
+func (m *InfrastructureInfoSecurityComponent) XXX_Size() int {
+	return xxx_messageInfo_InfrastructureInfoSecurityComponent.Size(m)
+}
+func (m *InfrastructureInfoSecurityComponent) XXX_DiscardUnknown() {
+	xxx_messageInfo_InfrastructureInfoSecurityComponent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InfrastructureInfoSecurityComponent proto.InternalMessageInfo
+
+func (m *InfrastructureInfoSecurityComponent) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+type InfrastructureInfoServicePort struct {
+	Port                 int32    `protobuf:"varint,1,opt,name=port,proto3" json:"port,omitempty"`
+	Protocol             string   `protobuf:"bytes,2,opt,name=protocol,proto3" json:"protocol,omitempty"`
+	Exposed              int32    `protobuf:"varint,3,opt,name=exposed,proto3" json:"exposed,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InfrastructureInfoServicePort) Reset()         { *m = InfrastructureInfoServicePort{} }
+func (m *InfrastructureInfoServicePort) String() string { return proto.CompactTextString(m) }
+func (*InfrastructureInfoServicePort) ProtoMessage()    {}
+func (*InfrastructureInfoServicePort) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d99b360a3c24bca1, []int{12}
+}
+
+func (m *InfrastructureInfoServicePort) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InfrastructureInfoServicePort.Unmarshal(m, b)
+}
+func (m *InfrastructureInfoServicePort) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InfrastructureInfoServicePort.Marshal(b, m, deterministic)
+}
+func (m *InfrastructureInfoServicePort) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InfrastructureInfoServicePort.Merge(m, src)
+}
+func (m *InfrastructureInfoServicePort) XXX_Size() int {
+	return xxx_messageInfo_InfrastructureInfoServicePort.Size(m)
+}
+func (m *InfrastructureInfoServicePort) XXX_DiscardUnknown() {
+	xxx_messageInfo_InfrastructureInfoServicePort.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InfrastructureInfoServicePort proto.InternalMessageInfo
+
+func (m *InfrastructureInfoServicePort) GetPort() int32 {
+	if m != nil {
+		return m.Port
+	}
+	return 0
+}
+
+func (m *InfrastructureInfoServicePort) GetProtocol() string {
+	if m != nil {
+		return m.Protocol
+	}
+	return ""
+}
+
+func (m *InfrastructureInfoServicePort) GetExposed() int32 {
+	if m != nil {
+		return m.Exposed
+	}
+	return 0
+}
+
+type InfrastructureInfoServiceInstance struct {
+	Ip                   string   `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Uid                  string   `protobuf:"bytes,2,opt,name=uid,proto3" json:"uid,omitempty"`
+	Quarantined          bool     `protobuf:"varint,3,opt,name=quarantined,proto3" json:"quarantined,omitempty"`
+	PolicyVersion        string   `protobuf:"bytes,4,opt,name=policy_version,json=policyVersion,proto3" json:"policy_version,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InfrastructureInfoServiceInstance) Reset()         { *m = InfrastructureInfoServiceInstance{} }
+func (m *InfrastructureInfoServiceInstance) String() string { return proto.CompactTextString(m) }
+func (*InfrastructureInfoServiceInstance) ProtoMessage()    {}
+func (*InfrastructureInfoServiceInstance) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d99b360a3c24bca1, []int{13}
+}
+
+func (m *InfrastructureInfoServiceInstance) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InfrastructureInfoServiceInstance.Unmarshal(m, b)
+}
+func (m *InfrastructureInfoServiceInstance) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InfrastructureInfoServiceInstance.Marshal(b, m, deterministic)
+}
+func (m *InfrastructureInfoServiceInstance) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InfrastructureInfoServiceInstance.Merge(m, src)
+}
+func (m *InfrastructureInfoServiceInstance) XXX_Size() int {
+	return xxx_messageInfo_InfrastructureInfoServiceInstance.Size(m)
+}
+func (m *InfrastructureInfoServiceInstance) XXX_DiscardUnknown() {
+	xxx_messageInfo_InfrastructureInfoServiceInstance.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InfrastructureInfoServiceInstance proto.InternalMessageInfo
+
+func (m *InfrastructureInfoServiceInstance) GetIp() string {
+	if m != nil {
+		return m.Ip
+	}
+	return ""
+}
+
+func (m *InfrastructureInfoServiceInstance) GetUid() string {
+	if m != nil {
+		return m.Uid
+	}
+	return ""
+}
+
+func (m *InfrastructureInfoServiceInstance) GetQuarantined() bool {
+	if m != nil {
+		return m.Quarantined
+	}
+	return false
+}
+
+func (m *InfrastructureInfoServiceInstance) GetPolicyVersion() string {
+	if m != nil {
+		return m.PolicyVersion
+	}
+	return ""
+}
+
+// EventRecord is an event with its position in the event log
+type EventRecord struct {
+	Sequence             uint64               `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Event                *InfrastructureEvent `protobuf:"bytes,2,opt,name=event,proto3" json:"event,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *EventRecord) Reset()         { *m = EventRecord{} }
+func (m *EventRecord) String() string { return proto.CompactTextString(m) }
+func (*EventRecord) ProtoMessage()    {}
+func (*EventRecord) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d99b360a3c24bca1, []int{14}
+}
+
+func (m *EventRecord) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_EventRecord.Unmarshal(m, b)
+}
+func (m *EventRecord) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_EventRecord.Marshal(b, m, deterministic)
+}
+func (m *EventRecord) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_EventRecord.Merge(m, src)
+}
+func (m *EventRecord) XXX_Size() int {
+	return xxx_messageInfo_EventRecord.Size(m)
+}
+func (m *EventRecord) XXX_DiscardUnknown() {
+	xxx_messageInfo_EventRecord.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_EventRecord proto.InternalMessageInfo
+
+func (m *EventRecord) GetSequence() uint64 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+func (m *EventRecord) GetEvent() *InfrastructureEvent {
+	if m != nil {
+		return m.Event
+	}
+	return nil
+}
+
+// InfrastructureEvent mirrors types.InfrastructureEvent
+type InfrastructureEvent struct {
+	GraphName            string                       `protobuf:"bytes,1,opt,name=graph_name,json=graphName,proto3" json:"graph_name,omitempty"`
+	Type                 string                       `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	EventData            *InfrastructureEventResource `protobuf:"bytes,3,opt,name=event_data,json=eventData,proto3" json:"event_data,omitempty"`
+	EventTime            *timestamp.Timestamp         `protobuf:"bytes,4,opt,name=event_time,json=eventTime,proto3" json:"event_time,omitempty"`
+	Sequence             uint64                       `protobuf:"varint,5,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Revision             uint64                       `protobuf:"varint,6,opt,name=revision,proto3" json:"revision,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                     `json:"-"`
+	XXX_unrecognized     []byte                       `json:"-"`
+	XXX_sizecache        int32                        `json:"-"`
+}
+
+func (m *InfrastructureEvent) Reset()         { *m = InfrastructureEvent{} }
+func (m *InfrastructureEvent) String() string { return proto.CompactTextString(m) }
+func (*InfrastructureEvent) ProtoMessage()    {}
+func (*InfrastructureEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d99b360a3c24bca1, []int{15}
+}
+
+func (m *InfrastructureEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InfrastructureEvent.Unmarshal(m, b)
+}
+func (m *InfrastructureEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InfrastructureEvent.Marshal(b, m, deterministic)
+}
+func (m *InfrastructureEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InfrastructureEvent.Merge(m, src)
+}
+func (m *InfrastructureEvent) XXX_Size() int {
+	return xxx_messageInfo_InfrastructureEvent.Size(m)
+}
+func (m *InfrastructureEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_InfrastructureEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InfrastructureEvent proto.InternalMessageInfo
+
+func (m *InfrastructureEvent) GetGraphName() string {
+	if m != nil {
+		return m.GraphName
+	}
+	return ""
+}
+
+func (m *InfrastructureEvent) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *InfrastructureEvent) GetEventData() *InfrastructureEventResource {
+	if m != nil {
+		return m.EventData
+	}
+	return nil
+}
+
+func (m *InfrastructureEvent) GetEventTime() *timestamp.Timestamp {
+	if m != nil {
+		return m.EventTime
+	}
+	return nil
+}
+
+func (m *InfrastructureEvent) GetSequence() uint64 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+func (m *InfrastructureEvent) GetRevision() uint64 {
+	if m != nil {
+		return m.Revision
+	}
+	return 0
+}
+
+type InfrastructureEventResource struct {
+	ResourceType         string                       `protobuf:"bytes,1,opt,name=resource_type,json=resourceType,proto3" json:"resource_type,omitempty"`
+	Name                 string                       `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Ip                   string                       `protobuf:"bytes,3,opt,name=ip,proto3" json:"ip,omitempty"`
+	Uid                  string                       `protobuf:"bytes,4,opt,name=uid,proto3" json:"uid,omitempty"`
+	Firewall             *InfrastructureEventFirewall `protobuf:"bytes,5,opt,name=firewall,proto3" json:"firewall,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                     `json:"-"`
+	XXX_unrecognized     []byte                       `json:"-"`
+	XXX_sizecache        int32                        `json:"-"`
+}
+
+func (m *InfrastructureEventResource) Reset()         { *m = InfrastructureEventResource{} }
+func (m *InfrastructureEventResource) String() string { return proto.CompactTextString(m) }
+func (*InfrastructureEventResource) ProtoMessage()    {}
+func (*InfrastructureEventResource) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d99b360a3c24bca1, []int{16}
+}
+
+func (m *InfrastructureEventResource) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InfrastructureEventResource.Unmarshal(m, b)
+}
+func (m *InfrastructureEventResource) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InfrastructureEventResource.Marshal(b, m, deterministic)
+}
+func (m *InfrastructureEventResource) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InfrastructureEventResource.Merge(m, src)
+}
+func (m *InfrastructureEventResource) XXX_Size() int {
+	return xxx_messageInfo_InfrastructureEventResource.Size(m)
+}
+func (m *InfrastructureEventResource) XXX_DiscardUnknown() {
+	xxx_messageInfo_InfrastructureEventResource.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InfrastructureEventResource proto.InternalMessageInfo
+
+func (m *InfrastructureEventResource) GetResourceType() string {
+	if m != nil {
+		return m.ResourceType
+	}
+	return ""
+}
+
+func (m *InfrastructureEventResource) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *InfrastructureEventResource) GetIp() string {
+	if m != nil {
+		return m.Ip
+	}
+	return ""
+}
+
+func (m *InfrastructureEventResource) GetUid() string {
+	if m != nil {
+		return m.Uid
+	}
+	return ""
+}
+
+func (m *InfrastructureEventResource) GetFirewall() *InfrastructureEventFirewall {
+	if m != nil {
+		return m.Firewall
+	}
+	return nil
+}
+
+type InfrastructureEventFirewall struct {
+	Chain                string               `protobuf:"bytes,1,opt,name=chain,proto3" json:"chain,omitempty"`
+	Missing              int32                `protobuf:"varint,2,opt,name=missing,proto3" json:"missing,omitempty"`
+	Unexpected           int32                `protobuf:"varint,3,opt,name=unexpected,proto3" json:"unexpected,omitempty"`
+	Rule                 *wrappers.Int32Value `protobuf:"bytes,4,opt,name=rule,proto3" json:"rule,omitempty"`
+	Action               string               `protobuf:"bytes,5,opt,name=action,proto3" json:"action,omitempty"`
+	Packets              uint64               `protobuf:"varint,6,opt,name=packets,proto3" json:"packets,omitempty"`
+	Bytes                uint64               `protobuf:"varint,7,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Rate                 float64              `protobuf:"fixed64,8,opt,name=rate,proto3" json:"rate,omitempty"`
+	Threshold            float64              `protobuf:"fixed64,9,opt,name=threshold,proto3" json:"threshold,omitempty"`
+	Src                  string               `protobuf:"bytes,10,opt,name=src,proto3" json:"src,omitempty"`
+	Dst                  string               `protobuf:"bytes,11,opt,name=dst,proto3" json:"dst,omitempty"`
+	Owner                string               `protobuf:"bytes,12,opt,name=owner,proto3" json:"owner,omitempty"`
+	Reason               string               `protobuf:"bytes,13,opt,name=reason,proto3" json:"reason,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *InfrastructureEventFirewall) Reset()         { *m = InfrastructureEventFirewall{} }
+func (m *InfrastructureEventFirewall) String() string { return proto.CompactTextString(m) }
+func (*InfrastructureEventFirewall) ProtoMessage()    {}
+func (*InfrastructureEventFirewall) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d99b360a3c24bca1, []int{17}
+}
+
+func (m *InfrastructureEventFirewall) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InfrastructureEventFirewall.Unmarshal(m, b)
+}
+func (m *InfrastructureEventFirewall) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InfrastructureEventFirewall.Marshal(b, m, deterministic)
+}
+func (m *InfrastructureEventFirewall) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InfrastructureEventFirewall.Merge(m, src)
+}
+func (m *InfrastructureEventFirewall) XXX_Size() int {
+	return xxx_messageInfo_InfrastructureEventFirewall.Size(m)
+}
+func (m *InfrastructureEventFirewall) XXX_DiscardUnknown() {
+	xxx_messageInfo_InfrastructureEventFirewall.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InfrastructureEventFirewall proto.InternalMessageInfo
+
+func (m *InfrastructureEventFirewall) GetChain() string {
+	if m != nil {
+		return m.Chain
+	}
+	return ""
+}
+
+func (m *InfrastructureEventFirewall) GetMissing() int32 {
+	if m != nil {
+		return m.Missing
+	}
+	return 0
+}
+
+func (m *InfrastructureEventFirewall) GetUnexpected() int32 {
+	if m != nil {
+		return m.Unexpected
+	}
+	return 0
+}
+
+func (m *InfrastructureEventFirewall) GetRule() *wrappers.Int32Value {
+	if m != nil {
+		return m.Rule
+	}
+	return nil
+}
+
+func (m *InfrastructureEventFirewall) GetAction() string {
+	if m != nil {
+		return m.Action
+	}
+	return ""
+}
+
+func (m *InfrastructureEventFirewall) GetPackets() uint64 {
+	if m != nil {
+		return m.Packets
+	}
+	return 0
+}
+
+func (m *InfrastructureEventFirewall) GetBytes() uint64 {
+	if m != nil {
+		return m.Bytes
+	}
+	return 0
+}
+
+func (m *InfrastructureEventFirewall) GetRate() float64 {
+	if m != nil {
+		return m.Rate
+	}
+	return 0
+}
+
+func (m *InfrastructureEventFirewall) GetThreshold() float64 {
+	if m != nil {
+		return m.Threshold
+	}
+	return 0
+}
+
+func (m *InfrastructureEventFirewall) GetSrc() string {
+	if m != nil {
+		return m.Src
+	}
+	return ""
+}
+
+func (m *InfrastructureEventFirewall) GetDst() string {
+	if m != nil {
+		return m.Dst
+	}
+	return ""
+}
+
+func (m *InfrastructureEventFirewall) GetOwner() string {
+	if m != nil {
+		return m.Owner
+	}
+	return ""
+}
+
+func (m *InfrastructureEventFirewall) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*ListGraphsRequest)(nil), "astrid.v1.ListGraphsRequest")
+	proto.RegisterType((*ListGraphsResponse)(nil), "astrid.v1.ListGraphsResponse")
+	proto.RegisterType((*Graph)(nil), "astrid.v1.Graph")
+	proto.RegisterMapType((map[string]*Problems)(nil), "astrid.v1.Graph.MisconfiguredEntry")
+	proto.RegisterType((*Problems)(nil), "astrid.v1.Problems")
+	proto.RegisterType((*GetInfrastructureInfoRequest)(nil), "astrid.v1.GetInfrastructureInfoRequest")
+	proto.RegisterType((*WatchEventsRequest)(nil), "astrid.v1.WatchEventsRequest")
+	proto.RegisterType((*InfrastructureInfo)(nil), "astrid.v1.InfrastructureInfo")
+	proto.RegisterType((*InfrastructureInfoMetadata)(nil), "astrid.v1.InfrastructureInfoMetadata")
+	proto.RegisterType((*InfrastructureInfoSpec)(nil), "astrid.v1.InfrastructureInfoSpec")
+	proto.RegisterType((*InfrastructureInfoNode)(nil), "astrid.v1.InfrastructureInfoNode")
+	proto.RegisterType((*InfrastructureInfoService)(nil), "astrid.v1.InfrastructureInfoService")
+	proto.RegisterType((*InfrastructureInfoSecurityComponent)(nil), "astrid.v1.InfrastructureInfoSecurityComponent")
+	proto.RegisterType((*InfrastructureInfoServicePort)(nil), "astrid.v1.InfrastructureInfoServicePort")
+	proto.RegisterType((*InfrastructureInfoServiceInstance)(nil), "astrid.v1.InfrastructureInfoServiceInstance")
+	proto.RegisterType((*EventRecord)(nil), "astrid.v1.EventRecord")
+	proto.RegisterType((*InfrastructureEvent)(nil), "astrid.v1.InfrastructureEvent")
+	proto.RegisterType((*InfrastructureEventResource)(nil), "astrid.v1.InfrastructureEventResource")
+	proto.RegisterType((*InfrastructureEventFirewall)(nil), "astrid.v1.InfrastructureEventFirewall")
+}
+
+func init() { proto.RegisterFile("astrid.proto", fileDescriptor_d99b360a3c24bca1) }
+
+var fileDescriptor_d99b360a3c24bca1 = []byte{
+	// 1136 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x56, 0xcd, 0x6e, 0x1b, 0x37,
+	0x10, 0xc6, 0xca, 0x5a, 0x47, 0x1a, 0xc5, 0x41, 0x4a, 0xb7, 0xc6, 0x56, 0x71, 0x5c, 0x67, 0xdd,
+	0xa4, 0x0a, 0xda, 0x4a, 0xa9, 0xe3, 0xfe, 0xb8, 0x01, 0x82, 0x26, 0x8d, 0x13, 0xa8, 0x68, 0x82,
+	0x80, 0xb6, 0x53, 0xa0, 0x87, 0x0a, 0xab, 0x5d, 0x5a, 0x22, 0x2c, 0x91, 0x1b, 0x92, 0x2b, 0x47,
+	0xd7, 0xa2, 0xe7, 0x5e, 0x7a, 0xed, 0xa9, 0x40, 0xdf, 0xa2, 0x6f, 0xd1, 0xb7, 0xe8, 0x53, 0x14,
+	0xfc, 0x59, 0x79, 0xf5, 0x63, 0xd9, 0x37, 0xce, 0xf0, 0x1b, 0xf2, 0xe3, 0x37, 0xe4, 0x70, 0xe0,
+	0x7a, 0x24, 0x95, 0xa0, 0x49, 0x33, 0x15, 0x5c, 0x71, 0x54, 0x75, 0xd6, 0xe8, 0x8b, 0xfa, 0x47,
+	0x3d, 0xce, 0x7b, 0x03, 0xd2, 0x32, 0x13, 0xdd, 0xec, 0xa4, 0xa5, 0xe8, 0x90, 0x48, 0x15, 0x0d,
+	0x53, 0x8b, 0xad, 0x6f, 0xcd, 0x02, 0xce, 0x44, 0x94, 0xa6, 0x44, 0x48, 0x3b, 0x1f, 0xae, 0xc3,
+	0x7b, 0x3f, 0x52, 0xa9, 0x5e, 0x88, 0x28, 0xed, 0x4b, 0x4c, 0xde, 0x66, 0x44, 0xaa, 0xf0, 0x31,
+	0xa0, 0xa2, 0x53, 0xa6, 0x9c, 0x49, 0x82, 0x1a, 0xb0, 0xda, 0x33, 0x9e, 0xc0, 0xdb, 0x5e, 0x69,
+	0xd4, 0x76, 0x6f, 0x36, 0x27, 0x3c, 0x9a, 0x06, 0x8a, 0xdd, 0x7c, 0xf8, 0xaf, 0x07, 0xbe, 0xf1,
+	0x20, 0x04, 0x65, 0x16, 0x0d, 0x49, 0xe0, 0x6d, 0x7b, 0x8d, 0x2a, 0x36, 0x63, 0xf4, 0x3e, 0xf8,
+	0x69, 0x3f, 0x92, 0x24, 0x28, 0x19, 0xa7, 0x35, 0x50, 0x1b, 0xd6, 0x86, 0x54, 0xc6, 0x9c, 0x9d,
+	0xd0, 0x5e, 0x26, 0x48, 0x12, 0xac, 0x98, 0x4d, 0x76, 0x66, 0x37, 0x69, 0xbe, 0x2c, 0xa2, 0x0e,
+	0x98, 0x12, 0x63, 0x3c, 0x1d, 0x59, 0x3f, 0x06, 0x34, 0x0f, 0x42, 0x37, 0x61, 0xe5, 0x94, 0x8c,
+	0x1d, 0x13, 0x3d, 0x44, 0xf7, 0xc1, 0x1f, 0x45, 0x83, 0xcc, 0x12, 0xa9, 0xed, 0xae, 0x17, 0xb6,
+	0x7a, 0x2d, 0x78, 0x77, 0x40, 0x86, 0x12, 0x5b, 0xc4, 0xb7, 0xa5, 0x6f, 0xbc, 0xf0, 0x1e, 0x54,
+	0x72, 0x37, 0xaa, 0x43, 0x25, 0x75, 0x63, 0xa3, 0x46, 0x15, 0x4f, 0xec, 0x70, 0x0f, 0x36, 0x5f,
+	0x10, 0xd5, 0x66, 0x27, 0x42, 0xaf, 0x97, 0xc5, 0x2a, 0x13, 0xa4, 0xcd, 0x4e, 0xb8, 0x53, 0x57,
+	0x9f, 0xdf, 0xe8, 0xe4, 0xa8, 0x58, 0x23, 0xfc, 0x05, 0xd0, 0x4f, 0x91, 0x8a, 0xfb, 0x07, 0x23,
+	0xc2, 0x94, 0x5c, 0x8a, 0x45, 0xbb, 0xe0, 0x4b, 0xca, 0xe2, 0x9c, 0xf8, 0x66, 0xd3, 0x26, 0xb9,
+	0x99, 0x27, 0xb9, 0x79, 0xdc, 0x66, 0xea, 0xab, 0xbd, 0x37, 0x9a, 0x3a, 0xb6, 0xd0, 0xf0, 0x2f,
+	0x0f, 0xd0, 0x3c, 0x27, 0x9d, 0xa0, 0x53, 0xca, 0x92, 0x3c, 0x41, 0x7a, 0x8c, 0x9e, 0x40, 0x65,
+	0x48, 0x54, 0x94, 0x44, 0x2a, 0x72, 0x3b, 0xdc, 0x2d, 0x48, 0x33, 0xbf, 0xc8, 0x4b, 0x07, 0xc6,
+	0x93, 0x30, 0xf4, 0x25, 0x94, 0x65, 0x4a, 0xe2, 0x60, 0xc5, 0x84, 0xdf, 0x59, 0x1a, 0x7e, 0x98,
+	0x92, 0x18, 0x1b, 0x78, 0xf8, 0xb7, 0x07, 0xf5, 0x8b, 0xd7, 0x5f, 0x78, 0x9b, 0x1e, 0x41, 0x6d,
+	0x10, 0x49, 0xd5, 0xc9, 0xd2, 0x24, 0x52, 0xb9, 0x22, 0xf5, 0x39, 0x45, 0x8e, 0xf2, 0x77, 0x81,
+	0x41, 0xc3, 0x8f, 0x0d, 0x5a, 0xa7, 0x51, 0x90, 0x11, 0x95, 0x94, 0x33, 0x43, 0xb5, 0x8c, 0x27,
+	0xb6, 0x9e, 0x93, 0x3a, 0x0b, 0x5a, 0xe7, 0xb2, 0x9d, 0xcb, 0xed, 0xf0, 0x0f, 0x0f, 0x36, 0x16,
+	0x1f, 0x04, 0x7d, 0x0d, 0x3e, 0xe3, 0x09, 0xc9, 0x1f, 0xc9, 0xf2, 0xa3, 0xbf, 0xe2, 0x09, 0xc1,
+	0x16, 0x8f, 0xbe, 0xd3, 0xfb, 0x89, 0x11, 0x8d, 0x89, 0x0c, 0x4a, 0x26, 0xf6, 0xe3, 0xe5, 0xb2,
+	0x59, 0x30, 0x9e, 0x44, 0x85, 0x0d, 0xd8, 0x58, 0xbc, 0x05, 0xba, 0x01, 0x25, 0x9a, 0x3a, 0xd9,
+	0x4a, 0x34, 0x0d, 0xff, 0x2c, 0xc1, 0x87, 0x17, 0xae, 0xb8, 0x50, 0xe6, 0x0e, 0xac, 0x4b, 0x12,
+	0x67, 0x82, 0xaa, 0x71, 0x27, 0xe6, 0xc3, 0x94, 0x33, 0x7d, 0x4d, 0x1d, 0xd1, 0xe6, 0x25, 0x44,
+	0x6d, 0xdc, 0xf7, 0x79, 0x18, 0x46, 0x72, 0xd6, 0x25, 0xd1, 0x63, 0xf0, 0x53, 0x2e, 0x94, 0x74,
+	0xef, 0xbe, 0x71, 0x95, 0xb3, 0xbf, 0xe6, 0x42, 0x61, 0x1b, 0x86, 0x7e, 0x80, 0x2a, 0x65, 0x52,
+	0x45, 0x4c, 0xeb, 0x57, 0x36, 0x6b, 0x7c, 0x76, 0x95, 0x35, 0xda, 0x2e, 0x08, 0x9f, 0x87, 0x87,
+	0xfb, 0xb0, 0x73, 0x85, 0x63, 0x2c, 0xd2, 0x29, 0xa4, 0x70, 0x7b, 0x29, 0x5d, 0x1d, 0xa4, 0x09,
+	0x9b, 0x20, 0x1f, 0x9b, 0xb1, 0xab, 0x26, 0x8a, 0xc7, 0x7c, 0xe0, 0x8a, 0xe2, 0xc4, 0x46, 0x01,
+	0x5c, 0x23, 0xef, 0x52, 0x2e, 0x4d, 0x45, 0xd4, 0x21, 0xb9, 0x19, 0xfe, 0xee, 0xc1, 0x9d, 0x4b,
+	0x8f, 0x35, 0x9b, 0x7a, 0x5d, 0x06, 0x33, 0x9a, 0xb8, 0x6d, 0xf4, 0x10, 0x6d, 0x43, 0xed, 0x6d,
+	0x16, 0x89, 0x88, 0x29, 0xca, 0xdc, 0x2e, 0x15, 0x5c, 0x74, 0xa1, 0xbb, 0x70, 0x23, 0xe5, 0x03,
+	0x1a, 0x8f, 0x3b, 0x23, 0x22, 0xcc, 0x63, 0x29, 0x9b, 0xf0, 0x35, 0xeb, 0x7d, 0x63, 0x9d, 0x61,
+	0x07, 0x6a, 0xa6, 0x7a, 0x61, 0x12, 0x73, 0x91, 0x4c, 0x3d, 0x20, 0x6f, 0xfa, 0x01, 0xa1, 0x3d,
+	0xf0, 0x89, 0x86, 0xba, 0xf7, 0xba, 0x75, 0x61, 0xa6, 0xec, 0x82, 0x16, 0x1c, 0xfe, 0x5a, 0x82,
+	0xf5, 0x05, 0xd3, 0xe8, 0x36, 0x80, 0x29, 0x8c, 0x9d, 0x42, 0x3a, 0xaa, 0xc6, 0xf3, 0x4a, 0xdf,
+	0x5d, 0x04, 0x65, 0x35, 0x4e, 0xf3, 0xff, 0xc6, 0x8c, 0xd1, 0x01, 0x80, 0x59, 0xb3, 0x63, 0xaa,
+	0x9c, 0x2d, 0x53, 0xf7, 0x2e, 0x61, 0x41, 0x24, 0xcf, 0x84, 0xbe, 0x29, 0x26, 0xf2, 0x99, 0xae,
+	0x48, 0xfb, 0xf9, 0x32, 0xfa, 0xdf, 0x0d, 0xca, 0x97, 0x16, 0x1f, 0x1b, 0xaa, 0xed, 0x29, 0x79,
+	0xfc, 0x19, 0x79, 0x8a, 0x75, 0x69, 0x75, 0xba, 0x2e, 0x85, 0xff, 0x78, 0x70, 0x6b, 0x09, 0x3b,
+	0xb4, 0x03, 0x6b, 0xc2, 0x8d, 0x3b, 0xe6, 0xd8, 0x56, 0x8f, 0xeb, 0xb9, 0xf3, 0x48, 0x1f, 0x3f,
+	0xbf, 0xba, 0xa5, 0xc2, 0x13, 0xb7, 0x37, 0x65, 0x65, 0xf6, 0xa6, 0x94, 0xcf, 0x6f, 0xca, 0x53,
+	0xa8, 0x9c, 0x50, 0x41, 0xce, 0xa2, 0xc1, 0x20, 0xf0, 0xaf, 0x22, 0xd9, 0x73, 0x87, 0xc6, 0x93,
+	0xb8, 0xf0, 0xbf, 0x12, 0xdc, 0x5a, 0x82, 0xd4, 0x3f, 0x5e, 0xdc, 0x8f, 0x28, 0xcb, 0x7f, 0x3c,
+	0x63, 0xe8, 0x57, 0x30, 0xa4, 0x52, 0x52, 0xd6, 0x33, 0x94, 0x7d, 0x9c, 0x9b, 0x68, 0x0b, 0x20,
+	0x63, 0xe4, 0x5d, 0x4a, 0x62, 0x35, 0x79, 0x22, 0x05, 0x0f, 0x6a, 0x41, 0x59, 0x64, 0x83, 0x3c,
+	0x37, 0xb7, 0xe6, 0x72, 0xd3, 0x66, 0xea, 0xe1, 0xae, 0xfd, 0x29, 0x0d, 0x10, 0x6d, 0xc0, 0x6a,
+	0x14, 0x2b, 0xad, 0xbc, 0x6f, 0x18, 0x38, 0x4b, 0x53, 0x48, 0xa3, 0xf8, 0x94, 0x28, 0xe9, 0x52,
+	0x92, 0x9b, 0x9a, 0x72, 0x77, 0xac, 0x88, 0x0c, 0xae, 0x19, 0xbf, 0x35, 0xb4, 0xc4, 0x42, 0xff,
+	0x48, 0x95, 0x6d, 0xaf, 0xe1, 0x61, 0x33, 0x46, 0x9b, 0x50, 0x55, 0x7d, 0x41, 0x64, 0x9f, 0x0f,
+	0x92, 0xa0, 0x6a, 0x26, 0xce, 0x1d, 0x5a, 0x70, 0x29, 0xe2, 0x00, 0xac, 0xe0, 0x52, 0xc4, 0xda,
+	0x93, 0x48, 0x15, 0xd4, 0xac, 0x27, 0xb1, 0x0d, 0x01, 0x3f, 0x63, 0x44, 0x04, 0xd7, 0xad, 0x3c,
+	0xc6, 0xd0, 0x9c, 0x05, 0x89, 0x24, 0x67, 0xc1, 0x9a, 0xe5, 0x6c, 0xad, 0xdd, 0xdf, 0x4a, 0x70,
+	0x63, 0x5a, 0x6c, 0xd4, 0x06, 0x38, 0xef, 0xed, 0xd0, 0x66, 0x21, 0x7f, 0x73, 0x7d, 0x60, 0xfd,
+	0xf6, 0x05, 0xb3, 0xae, 0x21, 0xec, 0xc0, 0x07, 0x0b, 0x1b, 0x1d, 0xf4, 0x49, 0xb1, 0x69, 0x5b,
+	0xd2, 0x0a, 0x4d, 0x6d, 0xb0, 0x60, 0x9d, 0xe7, 0x50, 0x2b, 0xf4, 0x44, 0xa8, 0x88, 0x9e, 0xef,
+	0x95, 0xea, 0x1b, 0x85, 0xe9, 0x42, 0x1d, 0x7a, 0xe0, 0x3d, 0xfd, 0xf4, 0xe7, 0xfb, 0x3d, 0xaa,
+	0xfa, 0x59, 0xb7, 0x19, 0xf3, 0x61, 0xeb, 0x30, 0x63, 0x87, 0xba, 0x25, 0xda, 0x7f, 0xd0, 0x7a,
+	0x72, 0x78, 0x84, 0xdb, 0xcf, 0x3e, 0x3f, 0xcd, 0xba, 0xa4, 0x25, 0xd2, 0xf8, 0x91, 0x48, 0xe3,
+	0xee, 0xaa, 0xb9, 0x1a, 0x0f, 0xff, 0x1f, 0x00, 0x5a, 0xfb, 0x7a, 0xb9, 0x74, 0x0b, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// InfrastructureClient is the client API for Infrastructure service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type InfrastructureClient interface {
+	// ListGraphs returns the state of all graphs
+	ListGraphs(ctx context.Context, in *ListGraphsRequest, opts ...grpc.CallOption) (*ListGraphsResponse, error)
+	// GetInfrastructureInfo returns the infrastructure info of a graph as it is now
+	GetInfrastructureInfo(ctx context.Context, in *GetInfrastructureInfoRequest, opts ...grpc.CallOption) (*InfrastructureInfo, error)
+	// WatchEvents streams the events of a graph, or of all graphs, as they happen
+	WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (Infrastructure_WatchEventsClient, error)
+}
+
+type infrastructureClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewInfrastructureClient(cc *grpc.ClientConn) InfrastructureClient {
+	return &infrastructureClient{cc}
+}
+
+func (c *infrastructureClient) ListGraphs(ctx context.Context, in *ListGraphsRequest, opts ...grpc.CallOption) (*ListGraphsResponse, error) {
+	out := new(ListGraphsResponse)
+	err := c.cc.Invoke(ctx, "/astrid.v1.Infrastructure/ListGraphs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *infrastructureClient) GetInfrastructureInfo(ctx context.Context, in *GetInfrastructureInfoRequest, opts ...grpc.CallOption) (*InfrastructureInfo, error) {
+	out := new(InfrastructureInfo)
+	err := c.cc.Invoke(ctx, "/astrid.v1.Infrastructure/GetInfrastructureInfo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *infrastructureClient) WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (Infrastructure_WatchEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Infrastructure_serviceDesc.Streams[0], "/astrid.v1.Infrastructure/WatchEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &infrastructureWatchEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Infrastructure_WatchEventsClient interface {
+	Recv() (*EventRecord, error)
+	grpc.ClientStream
+}
+
+type infrastructureWatchEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *infrastructureWatchEventsClient) Recv() (*EventRecord, error) {
+	m := new(EventRecord)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// InfrastructureServer is the server API for Infrastructure service.
+type InfrastructureServer interface {
+	// ListGraphs returns the state of all graphs
+	ListGraphs(context.Context, *ListGraphsRequest) (*ListGraphsResponse, error)
+	// GetInfrastructureInfo returns the infrastructure info of a graph as it is now
+	GetInfrastructureInfo(context.Context, *GetInfrastructureInfoRequest) (*InfrastructureInfo, error)
+	// WatchEvents streams the events of a graph, or of all graphs, as they happen
+	WatchEvents(*WatchEventsRequest, Infrastructure_WatchEventsServer) error
+}
+
+// UnimplementedInfrastructureServer can be embedded to have forward compatible implementations.
+type UnimplementedInfrastructureServer struct {
+}
+
+func (*UnimplementedInfrastructureServer) ListGraphs(ctx context.Context, req *ListGraphsRequest) (*ListGraphsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListGraphs not implemented")
+}
+func (*UnimplementedInfrastructureServer) GetInfrastructureInfo(ctx context.Context, req *GetInfrastructureInfoRequest) (*InfrastructureInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetInfrastructureInfo not implemented")
+}
+func (*UnimplementedInfrastructureServer) WatchEvents(req *WatchEventsRequest, srv Infrastructure_WatchEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchEvents not implemented")
+}
+
+func RegisterInfrastructureServer(s *grpc.Server, srv InfrastructureServer) {
+	s.RegisterService(&_Infrastructure_serviceDesc, srv)
+}
+
+func _Infrastructure_ListGraphs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListGraphsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InfrastructureServer).ListGraphs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/astrid.v1.Infrastructure/ListGraphs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InfrastructureServer).ListGraphs(ctx, req.(*ListGraphsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Infrastructure_GetInfrastructureInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetInfrastructureInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InfrastructureServer).GetInfrastructureInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/astrid.v1.Infrastructure/GetInfrastructureInfo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InfrastructureServer).GetInfrastructureInfo(ctx, req.(*GetInfrastructureInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Infrastructure_WatchEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(InfrastructureServer).WatchEvents(m, &infrastructureWatchEventsServer{stream})
+}
+
+type Infrastructure_WatchEventsServer interface {
+	Send(*EventRecord) error
+	grpc.ServerStream
+}
+
+type infrastructureWatchEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *infrastructureWatchEventsServer) Send(m *EventRecord) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Infrastructure_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "astrid.v1.Infrastructure",
+	HandlerType: (*InfrastructureServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListGraphs",
+			Handler:    _Infrastructure_ListGraphs_Handler,
+		},
+		{
+			MethodName: "GetInfrastructureInfo",
+			Handler:    _Infrastructure_GetInfrastructureInfo_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchEvents",
+			Handler:       _Infrastructure_WatchEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "astrid.proto",
+}
@@ -0,0 +1,115 @@
+package rpc
+
+import (
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+// graphToProto converts the state of a graph
+func graphToProto(status types.GraphStatus) *Graph {
+	graph := &Graph{
+		Name:  status.Name,
+		Phase: status.Phase,
+	}
+	if len(status.Misconfigured) > 0 {
+		graph.Misconfigured = map[string]*Problems{}
+		for pod, problems := range status.Misconfigured {
+			graph.Misconfigured[pod] = &Problems{Problems: problems}
+		}
+	}
+	return graph
+}
+
+// infoToProto converts an infrastructure info
+func infoToProto(info types.InfrastructureInfo) (*InfrastructureInfo, error) {
+	lastUpdate, err := ptypes.TimestampProto(info.Metadata.LastUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &InfrastructureInfoSpec{}
+	for _, node := range info.Spec.Nodes {
+		spec.Nodes = append(spec.Nodes, &InfrastructureInfoNode{Ip: node.IP})
+	}
+	for _, s := range info.Spec.Services {
+		service := &InfrastructureInfoService{Name: s.Name}
+		for _, component := range s.SecurityComponents {
+			service.SecurityComponents = append(service.SecurityComponents, &InfrastructureInfoSecurityComponent{Name: component.Name})
+		}
+		for _, port := range s.Ports {
+			service.Ports = append(service.Ports, &InfrastructureInfoServicePort{
+				Port:     port.Port,
+				Protocol: string(port.Protocol),
+				Exposed:  port.Exposed,
+			})
+		}
+		for _, instance := range s.Instances {
+			service.Instances = append(service.Instances, &InfrastructureInfoServiceInstance{
+				Ip:            instance.IP,
+				Uid:           instance.UID,
+				Quarantined:   instance.Quarantined,
+				PolicyVersion: instance.PolicyVersion,
+			})
+		}
+		spec.Services = append(spec.Services, service)
+	}
+
+	return &InfrastructureInfo{
+		Kind: info.Kind,
+		Metadata: &InfrastructureInfoMetadata{
+			Name:       info.Metadata.Name,
+			LastUpdate: lastUpdate,
+			Revision:   info.Metadata.Revision,
+			Sequence:   info.Metadata.Sequence,
+		},
+		Spec: spec,
+	}, nil
+}
+
+// recordToProto converts an event of the event log
+func recordToProto(record types.EventRecord) (*EventRecord, error) {
+	eventTime, err := ptypes.TimestampProto(record.Event.EventTime)
+	if err != nil {
+		return nil, err
+	}
+
+	data := record.Event.EventData
+	resource := &InfrastructureEventResource{
+		ResourceType: string(data.ResourceType),
+		Name:         data.Name,
+		Ip:           data.Ip,
+		Uid:          data.Uid,
+	}
+	if firewall := data.Firewall; firewall != nil {
+		resource.Firewall = &InfrastructureEventFirewall{
+			Chain:      firewall.Chain,
+			Missing:    int32(firewall.Missing),
+			Unexpected: int32(firewall.Unexpected),
+			Action:     firewall.Action,
+			Packets:    firewall.Packets,
+			Bytes:      firewall.Bytes,
+			Rate:       firewall.Rate,
+			Threshold:  firewall.Threshold,
+			Src:        firewall.Src,
+			Dst:        firewall.Dst,
+			Owner:      firewall.Owner,
+			Reason:     firewall.Reason,
+		}
+		if firewall.Rule != nil {
+			resource.Firewall.Rule = &wrappers.Int32Value{Value: *firewall.Rule}
+		}
+	}
+
+	return &EventRecord{
+		Sequence: record.Sequence,
+		Event: &InfrastructureEvent{
+			GraphName: record.Event.GraphName,
+			Type:      string(record.Event.Type),
+			EventData: resource,
+			EventTime: eventTime,
+			Sequence:  record.Event.Sequence,
+			Revision:  record.Event.Revision,
+		},
+	}, nil
+}
@@ -0,0 +1,143 @@
+package rpc
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. astrid.proto
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"strings"
+
+	"github.com/SunSince90/ASTRID-kube/graph"
+	"github.com/SunSince90/ASTRID-kube/types"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Server serves graphs, their infrastructure info and their events over gRPC
+type Server struct {
+	manager graph.Manager
+}
+
+// New returns a gRPC server that only accepts calls with the provided bearer token
+func New(manager graph.Manager, token string) *grpc.Server {
+	authenticate := func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get("authorization")
+		if len(values) != 1 || !strings.HasPrefix(values[0], "Bearer ") {
+			return status.Error(codes.Unauthenticated, "A bearer token is needed")
+		}
+		if subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(values[0], "Bearer ")), []byte(token)) != 1 {
+			return status.Error(codes.Unauthenticated, "Invalid token")
+		}
+		return nil
+	}
+
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := authenticate(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := authenticate(stream.Context()); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	RegisterInfrastructureServer(server, &Server{manager: manager})
+	return server
+}
+
+// Serve starts serving gRPC at the provided address
+func Serve(address, token string, manager graph.Manager) {
+	if len(token) < 1 {
+		log.Errorln("No token has been specified for gRPC. Will not serve it.")
+		return
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Errorln("Could not listen for gRPC:", err)
+		return
+	}
+
+	log.Infoln("Serving gRPC on", address)
+	if err := New(manager, token).Serve(listener); err != nil {
+		log.Errorln("Could not serve gRPC:", err)
+	}
+}
+
+// ListGraphs returns the state of all graphs
+func (s *Server) ListGraphs(ctx context.Context, request *ListGraphsRequest) (*ListGraphsResponse, error) {
+	response := &ListGraphsResponse{}
+	for _, graph := range s.manager.Graphs() {
+		response.Graphs = append(response.Graphs, graphToProto(graph))
+	}
+	return response, nil
+}
+
+// GetInfrastructureInfo returns the infrastructure info of a graph as it is now
+func (s *Server) GetInfrastructureInfo(ctx context.Context, request *GetInfrastructureInfoRequest) (*InfrastructureInfo, error) {
+	info, err := s.manager.InfrastructureInfo(request.Graph)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	converted, err := infoToProto(info)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return converted, nil
+}
+
+// WatchEvents streams the events of a graph, or of all graphs, until the client goes away
+func (s *Server) WatchEvents(request *WatchEventsRequest, stream Infrastructure_WatchEventsServer) error {
+	var since *uint64
+	if request.Since != nil {
+		since = &request.Since.Value
+	}
+
+	records, next, stop, err := s.manager.WatchEvents(request.Graph, since)
+	if err == graph.ErrEventsExpired {
+		return status.Error(codes.OutOfRange, err.Error())
+	}
+	if err != nil {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	defer stop()
+
+	for _, record := range records {
+		if err := sendRecord(stream, record); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case record, open := <-next:
+			//	Too slow: the client can resume with the last sequence it got
+			if !open {
+				return status.Error(codes.ResourceExhausted, "Could not keep up with events")
+			}
+			if err := sendRecord(stream, record); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func sendRecord(stream Infrastructure_WatchEventsServer, record types.EventRecord) error {
+	converted, err := recordToProto(record)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return stream.Send(converted)
+}
@@ -0,0 +1,166 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/graph"
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testManager is a graph manager with a single graph, "mygraph", and a single event in the log
+type testManager struct {
+	graph.Manager
+	events chan types.EventRecord
+}
+
+func (m *testManager) Graphs() []types.GraphStatus {
+	return []types.GraphStatus{{Name: "mygraph", Phase: "provisioning", Misconfigured: map[string][]string{"apache-1": {"no polycubed container"}}}}
+}
+
+func (m *testManager) InfrastructureInfo(name string) (types.InfrastructureInfo, error) {
+	if name != "mygraph" {
+		return types.InfrastructureInfo{}, errors.New("Graph does not exist")
+	}
+	return types.InfrastructureInfo{
+		Kind:     types.KIND,
+		Metadata: types.InfrastructureInfoMetadata{Name: "mygraph", LastUpdate: time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)},
+		Spec: types.InfrastructureInfoSpec{
+			Nodes: []types.InfrastructureInfoNode{{IP: "192.168.1.1"}},
+			Services: []types.InfrastructureInfoService{{
+				Name:               "apache",
+				SecurityComponents: []types.InfrastructureInfoSecurityComponent{{Name: "firewall"}},
+				Ports:              []types.InfrastructureInfoServicePort{{Port: 80, Protocol: types.TCP, Exposed: 30080}},
+				Instances:          []types.InfrastructureInfoServiceInstance{{IP: "10.0.0.1", UID: "apache-1", Quarantined: true}},
+			}},
+		},
+	}, nil
+}
+
+func (m *testManager) WatchEvents(name string, since *uint64) ([]types.EventRecord, <-chan types.EventRecord, func(), error) {
+	if since == nil {
+		return nil, m.events, func() {}, nil
+	}
+	if *since > 0 {
+		return nil, nil, nil, graph.ErrEventsExpired
+	}
+	return []types.EventRecord{{Sequence: 1, Event: types.InfrastructureEvent{GraphName: "mygraph", Type: types.New}}}, m.events, func() {}, nil
+}
+
+func testClient(t *testing.T, manager graph.Manager, token string) (InfrastructureClient, func()) {
+	listener := bufconn.Listen(1024 * 1024)
+	server := New(manager, "token")
+	go server.Serve(listener)
+
+	connection, err := grpc.Dial("bufnet",
+		grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithInsecure(),
+		grpc.WithPerRPCCredentials(bearer(token)),
+	)
+	assert.NoError(t, err)
+
+	return NewInfrastructureClient(connection), func() {
+		connection.Close()
+		server.Stop()
+	}
+}
+
+// bearer sends a token in each call
+type bearer string
+
+func (b bearer) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(b)}, nil
+}
+
+func (b bearer) RequireTransportSecurity() bool {
+	return false
+}
+
+func TestListGraphs(t *testing.T) {
+	client, stop := testClient(t, &testManager{}, "token")
+	defer stop()
+
+	response, err := client.ListGraphs(context.Background(), &ListGraphsRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, response.Graphs, 1)
+	assert.Equal(t, "mygraph", response.Graphs[0].Name)
+	assert.Equal(t, []string{"no polycubed container"}, response.Graphs[0].Misconfigured["apache-1"].Problems)
+}
+
+func TestGetInfrastructureInfo(t *testing.T) {
+	client, stop := testClient(t, &testManager{}, "token")
+	defer stop()
+
+	info, err := client.GetInfrastructureInfo(context.Background(), &GetInfrastructureInfoRequest{Graph: "mygraph"})
+	assert.NoError(t, err)
+	assert.Equal(t, types.KIND, info.Kind)
+	assert.Equal(t, int64(1572566400), info.Metadata.LastUpdate.Seconds)
+	assert.Equal(t, "192.168.1.1", info.Spec.Nodes[0].Ip)
+	service := info.Spec.Services[0]
+	assert.Equal(t, "firewall", service.SecurityComponents[0].Name)
+	assert.Equal(t, &InfrastructureInfoServicePort{Port: 80, Protocol: "TCP", Exposed: 30080}, service.Ports[0])
+	assert.Equal(t, &InfrastructureInfoServiceInstance{Ip: "10.0.0.1", Uid: "apache-1", Quarantined: true}, service.Instances[0])
+
+	_, err = client.GetInfrastructureInfo(context.Background(), &GetInfrastructureInfoRequest{Graph: "other"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestWatchEvents(t *testing.T) {
+	manager := &testManager{events: make(chan types.EventRecord, 1)}
+	client, stop := testClient(t, manager, "token")
+	defer stop()
+
+	stream, err := client.WatchEvents(context.Background(), &WatchEventsRequest{Graph: "mygraph", Since: &wrappers.UInt64Value{Value: 0}})
+	assert.NoError(t, err)
+
+	record, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), record.Sequence)
+	assert.Equal(t, "new", record.Event.Type)
+
+	rule := int32(2)
+	manager.events <- types.EventRecord{Sequence: 2, Event: types.InfrastructureEvent{
+		GraphName: "mygraph",
+		Type:      types.Alert,
+		EventData: types.InfrastructureEventResource{
+			ResourceType: types.Pod,
+			Uid:          "apache-1",
+			Firewall:     &types.InfrastructureEventFirewall{Chain: "ingress", Rule: &rule, Rate: 150.5},
+		},
+	}}
+	record, err = stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), record.Sequence)
+	assert.Equal(t, int32(2), record.Event.EventData.Firewall.Rule.Value)
+	assert.Equal(t, 150.5, record.Event.EventData.Firewall.Rate)
+
+	//	Events that are not in the log anymore
+	stream, err = client.WatchEvents(context.Background(), &WatchEventsRequest{Since: &wrappers.UInt64Value{Value: 5}})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.OutOfRange, status.Code(err))
+}
+
+func TestUnauthenticated(t *testing.T) {
+	client, stop := testClient(t, &testManager{}, "wrong")
+	defer stop()
+
+	_, err := client.ListGraphs(context.Background(), &ListGraphsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	stream, err := client.WatchEvents(context.Background(), &WatchEventsRequest{})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
@@ -0,0 +1,9 @@
+package types
+
+// AlertThreshold is the maximum rate of packets per second that can match a rule
+// of the firewall before an alert is sent.
+type AlertThreshold struct {
+	Chain            string  `json:"chain"`
+	Action           string  `json:"action"`
+	PacketsPerSecond float64 `json:"packetsPerSecond"`
+}
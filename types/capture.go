@@ -0,0 +1,37 @@
+package types
+
+import "time"
+
+// CaptureFilter selects the packets to capture. Empty fields match everything.
+type CaptureFilter struct {
+	Src     string `yaml:"src,omitempty" json:"src,omitempty"`
+	Dst     string `yaml:"dst,omitempty" json:"dst,omitempty"`
+	L4proto string `yaml:"l4proto,omitempty" json:"l4proto,omitempty"`
+	Sport   int32  `yaml:"sport,omitempty" json:"sport,omitempty"`
+	Dport   int32  `yaml:"dport,omitempty" json:"dport,omitempty"`
+}
+
+type CaptureStatus string
+
+const (
+	CaptureRunning   CaptureStatus = "running"
+	CaptureCompleted CaptureStatus = "completed"
+	CaptureCancelled CaptureStatus = "cancelled"
+	CaptureFailed    CaptureStatus = "failed"
+)
+
+// CaptureSession is a capture of the traffic of an instance
+type CaptureSession struct {
+	ID     string        `yaml:"id" json:"id"`
+	Graph  string        `yaml:"graph" json:"graph"`
+	Pod    string        `yaml:"pod" json:"pod"`
+	Filter CaptureFilter `yaml:"filter" json:"filter"`
+	//	Duration is how many seconds the capture lasts
+	Duration int64         `yaml:"duration" json:"duration"`
+	Started  time.Time     `yaml:"started" json:"started"`
+	Status   CaptureStatus `yaml:"status" json:"status"`
+	Packets  int           `yaml:"packets" json:"packets"`
+	//	Truncated is true if it stopped because it reached the maximum size
+	Truncated bool   `yaml:"truncated,omitempty" json:"truncated,omitempty"`
+	Error     string `yaml:"error,omitempty" json:"error,omitempty"`
+}
@@ -0,0 +1,16 @@
+package types
+
+import "encoding/xml"
+
+// EventRecord is an infrastructure event in the event log, with its position in it,
+// which counts the events of all graphs
+type EventRecord struct {
+	Sequence uint64              `yaml:"sequence"  json:"sequence" xml:"sequence,attr"`
+	Event    InfrastructureEvent `yaml:"event"  json:"event" xml:"InfrastructureEvent"`
+}
+
+// EventList is a part of the event log
+type EventList struct {
+	XMLName xml.Name      `yaml:"-"  json:"-" xml:"Events"`
+	Events  []EventRecord `yaml:"events"  json:"events" xml:"Event"`
+}
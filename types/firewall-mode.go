@@ -0,0 +1,11 @@
+package types
+
+// FirewallMode is where the firewalls of the instances run
+type FirewallMode string
+
+const (
+	// SidecarMode uses the polycube sidecar of each pod
+	SidecarMode FirewallMode = "sidecar"
+	// NodeMode uses the firewalls that pcn-k8s creates for each pod on its node
+	NodeMode FirewallMode = "node"
+)
@@ -0,0 +1,19 @@
+package types
+
+import "encoding/xml"
+
+// GraphStatus is the current state of a graph
+type GraphStatus struct {
+	XMLName xml.Name `json:"-" yaml:"-" xml:"Graph"`
+	Name    string   `json:"name" yaml:"name" xml:"name,attr"`
+	Phase   string   `json:"phase" yaml:"phase" xml:"phase,attr"`
+	//	Misconfigured are the instances that cannot be protected, with everything that is wrong in each of them.
+	//	Maps cannot be encoded in xml, so it is only available in the other formats.
+	Misconfigured map[string][]string `json:"misconfigured,omitempty" yaml:"misconfigured,omitempty" xml:"-"`
+}
+
+// GraphList is the state of all graphs
+type GraphList struct {
+	XMLName xml.Name      `json:"-" yaml:"-" xml:"Graphs"`
+	Graphs  []GraphStatus `json:"graphs" yaml:"graphs" xml:"Graph"`
+}
@@ -3,8 +3,9 @@ package types
 type InformerType string
 
 const (
-	Deployments InformerType = "deployments"
-	Services    InformerType = "services"
-	Pods        InformerType = "pods"
-	Nodes       InformerType = "nodes"
+	Deployments     InformerType = "deployments"
+	Services        InformerType = "services"
+	Pods            InformerType = "pods"
+	Nodes           InformerType = "nodes"
+	NetworkPolicies InformerType = "networkpolicies"
 )
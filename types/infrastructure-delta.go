@@ -0,0 +1,39 @@
+package types
+
+import (
+	"encoding/json"
+	"encoding/xml"
+)
+
+// InfrastructureInfoDelta is how the infrastructure info of a graph changed from a revision to another one
+type InfrastructureInfoDelta struct {
+	XMLName        xml.Name         `yaml:"-"  json:"-" xml:"InfrastructureInfoDelta"`
+	GraphName      string           `yaml:"graphName"  json:"graphName" xml:"graphName,attr"`
+	BaseRevision   uint64           `yaml:"baseRevision"  json:"baseRevision" xml:"baseRevision,attr"`
+	TargetRevision uint64           `yaml:"targetRevision"  json:"targetRevision" xml:"targetRevision,attr"`
+	Patch          []PatchOperation `yaml:"patch"  json:"patch" xml:"Operation"`
+}
+
+// PatchOperation is an operation of a JSON Patch (RFC 6902), whose paths are the ones of the infrastructure info in json.
+// The value is json in all formats but yaml, where it is yaml too.
+type PatchOperation struct {
+	Op    string          `yaml:"op"  json:"op" xml:"op,attr"`
+	Path  string          `yaml:"path"  json:"path" xml:"path,attr"`
+	Value json.RawMessage `yaml:"value,omitempty"  json:"value,omitempty" xml:"Value,omitempty"`
+}
+
+// MarshalYAML writes the value as yaml rather than as bytes
+func (p PatchOperation) MarshalYAML() (interface{}, error) {
+	operation := struct {
+		Op    string      `yaml:"op"`
+		Path  string      `yaml:"path"`
+		Value interface{} `yaml:"value,omitempty"`
+	}{Op: p.Op, Path: p.Path}
+
+	if len(p.Value) > 0 {
+		if err := json.Unmarshal(p.Value, &operation.Value); err != nil {
+			return nil, err
+		}
+	}
+	return operation, nil
+}
@@ -0,0 +1,10 @@
+package types
+
+import "encoding/xml"
+
+// InfrastructureEventBatch is a group of infrastructure events of a graph that happened close to each other, sent together
+type InfrastructureEventBatch struct {
+	XMLName   xml.Name              `yaml:"-"  json:"-" xml:"InfrastructureEventBatch"`
+	GraphName string                `yaml:"graph-name"  json:"graphName" xml:"graphName,attr"`
+	Events    []InfrastructureEvent `yaml:"events"  json:"events" xml:"InfrastructureEvent"`
+}
@@ -7,6 +7,13 @@ type InfrastructureEvent struct {
 	Type      InfrastructureEventType     `yaml:"type"  json:"type" xml:"type,attr"`
 	EventData InfrastructureEventResource `yaml:"event-data"  json:"eventData" xml:"EventData"`
 	EventTime time.Time                   `yaml:"event-time"  json:"eventTime" xml:"EventTime"`
+	//	Sequence grows by one with each event of the graph
+	Sequence uint64 `yaml:"sequence"  json:"sequence" xml:"sequence,attr"`
+	//	Delivery grows by one with each event of the graph sent to a subscription, after its filter.
+	//	It is only set in the events sent to subscriptions.
+	Delivery uint64 `yaml:"delivery,omitempty"  json:"delivery,omitempty" xml:"delivery,attr,omitempty"`
+	//	Revision is the one of the infrastructure info once the event is applied
+	Revision uint64 `yaml:"revision"  json:"revision" xml:"revision,attr"`
 }
 
 type InfrastructureEventResource struct {
@@ -14,14 +21,37 @@ type InfrastructureEventResource struct {
 	Name         string                          `yaml:"name"  json:"name" xml:"name,attr"`
 	Ip           string                          `yaml:"ip"  json:"ip" xml:"ip,attr"`
 	Uid          string                          `yaml:"uid"  json:"uid" xml:"uid,attr"`
+	Firewall     *InfrastructureEventFirewall    `yaml:"firewall,omitempty"  json:"firewall,omitempty" xml:"Firewall,omitempty"`
+}
+
+type InfrastructureEventFirewall struct {
+	Chain      string  `yaml:"chain"  json:"chain" xml:"chain,attr"`
+	Missing    int     `yaml:"missing,omitempty"  json:"missing,omitempty" xml:"missing,attr,omitempty"`
+	Unexpected int     `yaml:"unexpected,omitempty"  json:"unexpected,omitempty" xml:"unexpected,attr,omitempty"`
+	Rule       *int32  `yaml:"rule,omitempty"  json:"rule,omitempty" xml:"rule,attr,omitempty"`
+	Action     string  `yaml:"action,omitempty"  json:"action,omitempty" xml:"action,attr,omitempty"`
+	Packets    uint64  `yaml:"packets,omitempty"  json:"packets,omitempty" xml:"packets,attr,omitempty"`
+	Bytes      uint64  `yaml:"bytes,omitempty"  json:"bytes,omitempty" xml:"bytes,attr,omitempty"`
+	Rate       float64 `yaml:"rate,omitempty"  json:"rate,omitempty" xml:"rate,attr,omitempty"`
+	Threshold  float64 `yaml:"threshold,omitempty"  json:"threshold,omitempty" xml:"threshold,attr,omitempty"`
+	Src        string  `yaml:"src,omitempty"  json:"src,omitempty" xml:"src,attr,omitempty"`
+	Dst        string  `yaml:"dst,omitempty"  json:"dst,omitempty" xml:"dst,attr,omitempty"`
+	Owner      string  `yaml:"owner,omitempty"  json:"owner,omitempty" xml:"owner,attr,omitempty"`
+	Reason     string  `yaml:"reason,omitempty"  json:"reason,omitempty" xml:"reason,attr,omitempty"`
 }
 
 type InfrastructureEventType string
 type InfrastructureEventResourceType string
 
 const (
-	New    InfrastructureEventType         = "new"
-	Delete InfrastructureEventType         = "delete"
-	Pod    InfrastructureEventResourceType = "pod"
-	Node   InfrastructureEventResourceType = "node"
+	New         InfrastructureEventType         = "new"
+	Delete      InfrastructureEventType         = "delete"
+	Drift       InfrastructureEventType         = "drift"
+	Restored    InfrastructureEventType         = "security-component-restored"
+	Alert       InfrastructureEventType         = "alert"
+	Quarantined InfrastructureEventType         = "quarantined"
+	Released    InfrastructureEventType         = "released"
+	RuleExpired InfrastructureEventType         = "rule-expired"
+	Pod         InfrastructureEventResourceType = "pod"
+	Node        InfrastructureEventResourceType = "node"
 )
@@ -3,7 +3,7 @@ package types
 import "time"
 
 type InfrastructureInfo struct {
-	Kind     string                     `yaml:"kind" json:"metadata" xml:"-"`
+	Kind     string                     `yaml:"kind" json:"kind" xml:"-"`
 	Metadata InfrastructureInfoMetadata `yaml:"metadata" json:"metadata" xml:"Metadata"`
 	Spec     InfrastructureInfoSpec     `yaml:"spec" json:"spec" xml:"Spec"`
 }
@@ -11,6 +11,13 @@ type InfrastructureInfo struct {
 type InfrastructureInfoMetadata struct {
 	Name       string    `yaml:"name" json:"name" xml:"name,attr"`
 	LastUpdate time.Time `yaml:"lastUpdate" json:"lastUpdate" xml:"lastUpdate,attr"`
+	//	Revision changes every time the infrastructure info does
+	Revision uint64 `yaml:"revision" json:"revision" xml:"revision,attr"`
+	//	Sequence is the one of the last event of the graph that is included
+	Sequence uint64 `yaml:"sequence" json:"sequence" xml:"sequence,attr"`
+	//	Delivery is the one of the last event a subscription got before it.
+	//	It is only set in the infrastructure info sent to subscriptions.
+	Delivery uint64 `yaml:"delivery,omitempty" json:"delivery,omitempty" xml:"delivery,attr,omitempty"`
 }
 
 type InfrastructureInfoSpec struct {
@@ -50,6 +57,8 @@ const (
 )
 
 type InfrastructureInfoServiceInstance struct {
-	IP  string `yaml:"ip"  json:"ip" xml:"ip,attr"`
-	UID string `yaml:"uid"  json:"uid" xml:"uid,attr"`
+	IP            string `yaml:"ip"  json:"ip" xml:"ip,attr"`
+	UID           string `yaml:"uid"  json:"uid" xml:"uid,attr"`
+	Quarantined   bool   `yaml:"quarantined,omitempty"  json:"quarantined,omitempty" xml:"quarantined,attr,omitempty"`
+	PolicyVersion string `yaml:"policyVersion,omitempty"  json:"policyVersion,omitempty" xml:"policyVersion,attr,omitempty"`
 }
@@ -0,0 +1,11 @@
+package types
+
+// OverflowPolicy is what happens when too many events are waiting to be delivered to a destination
+type OverflowPolicy string
+
+const (
+	// Coalesce replaces the waiting events with the infrastructure info as it is now, which already includes them
+	Coalesce OverflowPolicy = "coalesce"
+	// DropOldest drops the oldest waiting event, and sends the infrastructure info again as soon as possible
+	DropOldest OverflowPolicy = "drop-oldest"
+)
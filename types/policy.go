@@ -0,0 +1,33 @@
+package types
+
+// Policy is the set of rules computed by verekube for the services of a graph.
+// It is the body that verekube must send back, in the direct and networkpolicy enforcements,
+// as described in the "Direct enforcement" section of the README: nothing else is parsed.
+type Policy struct {
+	Version string       `yaml:"version" json:"version" xml:"version,attr"`
+	Rules   []PolicyRule `yaml:"rules" json:"rules" xml:"Rule"`
+}
+
+// PolicyRule is a rule for all instances of a service.
+// The other end of the traffic is either all instances of a peer service or an explicit address:
+// when none is set, the rule applies to any address.
+type PolicyRule struct {
+	Service   string `yaml:"service" json:"service" xml:"service,attr"`
+	Direction string `yaml:"direction" json:"direction" xml:"direction,attr"`
+	Action    string `yaml:"action" json:"action" xml:"action,attr"`
+	Peer      string `yaml:"peer,omitempty" json:"peer,omitempty" xml:"peer,attr,omitempty"`
+	IP        string `yaml:"ip,omitempty" json:"ip,omitempty" xml:"ip,attr,omitempty"`
+	Protocol  string `yaml:"protocol,omitempty" json:"protocol,omitempty" xml:"protocol,attr,omitempty"`
+	Port      int32  `yaml:"port,omitempty" json:"port,omitempty" xml:"port,attr,omitempty"`
+}
+
+type EnforcementType string
+
+const (
+	// CBEnforcement forwards the policy to the cb, which pushes it to the firewalls
+	CBEnforcement EnforcementType = "cb"
+	// DirectEnforcement pushes the policy to the firewalls without the cb
+	DirectEnforcement EnforcementType = "direct"
+	// NetworkPolicyEnforcement turns the policy into NetworkPolicies, so no firewalls are needed
+	NetworkPolicyEnforcement EnforcementType = "networkpolicy"
+)
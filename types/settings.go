@@ -3,10 +3,91 @@ package types
 import "time"
 
 type Settings struct {
-	EndPoints   EndPoints     `yaml:"endpoints"`
-	Formats     Formats       `yaml:"formats"`
-	Paths       Paths         `yaml:"paths"`
-	FwInitTimer time.Duration `yaml:"fwInitTimer"`
+	EndPoints        EndPoints       `yaml:"endpoints"`
+	Formats          Formats         `yaml:"formats"`
+	Paths            Paths           `yaml:"paths"`
+	FwInitTimer      time.Duration   `yaml:"fwInitTimer"`
+	FwReconcileTimer time.Duration   `yaml:"fwReconcileTimer"`
+	FwHealthTimer    time.Duration   `yaml:"fwHealthTimer"`
+	FwStatsTimer     time.Duration   `yaml:"fwStatsTimer"`
+	Metrics          Metrics         `yaml:"metrics"`
+	API              API             `yaml:"api"`
+	GRPC             GRPC            `yaml:"grpc"`
+	Enforcement      EnforcementType `yaml:"enforcement"`
+	NetworkPolicies  bool            `yaml:"networkPolicies"`
+	FirewallMode     FirewallMode    `yaml:"firewallMode"`
+	Webhook          Webhook         `yaml:"webhook"`
+	Polycube         Polycube        `yaml:"polycube"`
+	Provisioning     Provisioning    `yaml:"provisioning"`
+	Events           Events          `yaml:"events"`
+	Subscriptions    []Subscription  `yaml:"subscriptions"`
+	Outbox           Outbox          `yaml:"outbox"`
+	Batching         Batching        `yaml:"batching"`
+	Captures         Captures        `yaml:"captures"`
+}
+
+// Captures limits the packet captures kept in memory
+type Captures struct {
+	//	MaxSize is how many megabytes a capture can take, after which it stops
+	MaxSize int `yaml:"maxSize"`
+	//	Retention is how many minutes a capture is kept once it is not running anymore
+	Retention int `yaml:"retention"`
+}
+
+// Batching is how events close to each other are sent together. Times are in milliseconds.
+type Batching struct {
+	//	Window is how long to wait for other events after one, 0 to send each one by itself
+	Window int `yaml:"window" json:"window"`
+	//	MaxSize is how many events a batch can have at most, 0 for no limit
+	MaxSize int `yaml:"maxSize" json:"maxSize"`
+	//	MaxLatency is how long the first event of a batch can wait at most, 0 for no limit
+	MaxLatency int `yaml:"maxLatency" json:"maxLatency"`
+}
+
+type Outbox struct {
+	MaxPending int            `yaml:"maxPending"`
+	Overflow   OverflowPolicy `yaml:"overflow"`
+}
+
+type Events struct {
+	LogSize int `yaml:"logSize"`
+}
+
+type Provisioning struct {
+	Workers       int     `yaml:"workers"`
+	GlobalWorkers int     `yaml:"globalWorkers"`
+	Rate          float64 `yaml:"rate"`
+	Burst         int     `yaml:"burst"`
+	Attempts      int     `yaml:"attempts"`
+}
+
+type Polycube struct {
+	Port      int32  `yaml:"port"`
+	Interface string `yaml:"interface"`
+	Firewall  string `yaml:"firewall"`
+	//	NodePort is where polycube listens on the nodes, in node mode
+	NodePort int32 `yaml:"nodePort"`
+}
+
+type Webhook struct {
+	Address  string `yaml:"address"`
+	Cert     string `yaml:"cert"`
+	Key      string `yaml:"key"`
+	Template string `yaml:"template"`
+}
+
+type API struct {
+	Address string `yaml:"address"`
+	Token   string `yaml:"token"`
+}
+
+type GRPC struct {
+	Address string `yaml:"address"`
+	Token   string `yaml:"token"`
+}
+
+type Metrics struct {
+	Address string `yaml:"address"`
 }
 
 type EndPoints struct {
@@ -30,4 +111,5 @@ type Formats struct {
 
 type Paths struct {
 	Kubeconfig string `yaml:"kubeconfig"`
+	State      string `yaml:"state"`
 }
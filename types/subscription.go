@@ -0,0 +1,40 @@
+package types
+
+// Subscription is a destination of the infrastructure info and events of graphs
+type Subscription struct {
+	ID string `yaml:"id" json:"id"`
+	//	URL is where data is posted
+	URL    string             `yaml:"url" json:"url"`
+	Format EncodingType       `yaml:"format" json:"format"`
+	Filter SubscriptionFilter `yaml:"filter" json:"filter"`
+	Retry  RetryPolicy        `yaml:"retry" json:"retry"`
+	Mode   SubscriptionMode   `yaml:"mode" json:"mode,omitempty"`
+}
+
+// SubscriptionMode is how a subscription gets the changes to the infrastructure info
+type SubscriptionMode string
+
+const (
+	// EventsMode sends infrastructure events, and is the default
+	EventsMode SubscriptionMode = "events"
+	// DeltaMode sends the patch from the infrastructure info the subscription has to the current one, after each change
+	DeltaMode SubscriptionMode = "delta"
+)
+
+// SubscriptionFilter restricts the data sent to a subscription: empty fields match everything
+type SubscriptionFilter struct {
+	Graphs        []string                          `yaml:"graphs,omitempty" json:"graphs,omitempty"`
+	ResourceTypes []InfrastructureEventResourceType `yaml:"resourceTypes,omitempty" json:"resourceTypes,omitempty"`
+	EventTypes    []InfrastructureEventType         `yaml:"eventTypes,omitempty" json:"eventTypes,omitempty"`
+}
+
+// RetryPolicy is how many times data is sent to a subscription before giving up,
+// and how many seconds to wait after the first failure, doubled after each one.
+type RetryPolicy struct {
+	Attempts int `yaml:"attempts" json:"attempts"`
+	Backoff  int `yaml:"backoff" json:"backoff"`
+}
+
+// MissingDeliveryHeader is the header of a response reporting a gap in the events received:
+// its value is the delivery of the first one that is missing, which is sent again along with the ones after it.
+const MissingDeliveryHeader = "X-Astrid-Missing-Delivery"
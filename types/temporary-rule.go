@@ -0,0 +1,20 @@
+package types
+
+import (
+	"time"
+
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
+)
+
+// TemporaryRule is a rule of the firewall that is removed when it expires
+type TemporaryRule struct {
+	Graph     string                `yaml:"graph" json:"graph"`
+	Pod       string                `yaml:"pod" json:"pod"`
+	IP        string                `yaml:"ip" json:"ip"`
+	Direction string                `yaml:"direction" json:"direction"`
+	Rule      k8sfirewall.ChainRule `yaml:"rule" json:"rule"`
+	Owner     string                `yaml:"owner" json:"owner"`
+	Reason    string                `yaml:"reason" json:"reason"`
+	Added     time.Time             `yaml:"added" json:"added"`
+	Expires   time.Time             `yaml:"expires" json:"expires"`
+}
@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	packetCapturePath string = "packetcapture/"
+	//	capturePollInterval is how long to wait before asking for a new packet when there are none
+	capturePollInterval = 100 * time.Millisecond
+)
+
+// packetCapture is the configuration of a packetcapture cube
+type packetCapture struct {
+	Capture     string               `json:"capture"`
+	NetworkMode bool                 `json:"networkmode"`
+	Filters     packetCaptureFilters `json:"filters"`
+}
+
+type packetCaptureFilters struct {
+	Src     string `json:"src,omitempty"`
+	Dst     string `json:"dst,omitempty"`
+	L4proto string `json:"l4proto,omitempty"`
+	Sport   int32  `json:"sport,omitempty"`
+	Dport   int32  `json:"dport,omitempty"`
+}
+
+// packetCapturePacket is a packet captured by a packetcapture cube in network mode
+type packetCapturePacket struct {
+	Seconds      uint32 `json:"timestamp-seconds"`
+	Microseconds uint32 `json:"timestamp-microseconds"`
+	Length       uint32 `json:"packetlength"`
+	Captured     uint32 `json:"capturedlength"`
+	RawData      string `json:"rawdata"`
+}
+
+func captureURL(fw Firewall, name, resource string) string {
+	return polycubeURL(fw, packetCapturePath+name+"/"+resource)
+}
+
+// Capture captures the traffic of a pod matching the filter, until the duration is over or stop is closed,
+// and writes it to w in the pcap format.
+// The packetcapture cube is created with the provided name and it is always removed before returning.
+// It returns the number of packets that were captured.
+func Capture(fw Firewall, name string, filter types.CaptureFilter, duration time.Duration, stop <-chan struct{}, w io.Writer) (int, error) {
+	l := log.WithFields(log.Fields{"IP": fw.ip, "CAPTURE": name})
+
+	//	The port of the pod in pcn-k8s is not known, so there is nothing to attach to
+	if fw.node {
+		return 0, errors.New("Packet capture is not supported with node firewalls")
+	}
+
+	config := packetCapture{
+		Capture:     "bidirectional",
+		NetworkMode: true,
+		Filters: packetCaptureFilters{
+			Src:     filter.Src,
+			Dst:     filter.Dst,
+			L4proto: filter.L4proto,
+			Sport:   filter.Sport,
+			Dport:   filter.Dport,
+		},
+	}
+	data, err := json.Marshal(&config)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := doRequest("POST", captureURL(fw, name, ""), data); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if _, err := doRequest("DELETE", captureURL(fw, name, ""), nil); err != nil && err != errNotFound {
+			l.Errorln("Could not delete packet capture:", err)
+		}
+	}()
+
+	attach := []byte(`{"cube":"` + name + `", "port":"` + fw.iface + `"}`)
+	if _, err := doRequest("POST", polycubeURL(fw, "attach"), attach); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if _, err := doRequest("POST", polycubeURL(fw, "detach"), attach); err != nil && err != errNotFound {
+			l.Errorln("Could not detach packet capture:", err)
+		}
+	}()
+
+	if err := writePcapHeader(w); err != nil {
+		return 0, err
+	}
+
+	l.Infoln("Started packet capture")
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	count := 0
+	for {
+		select {
+		case <-stop:
+			l.Infoln("Packet capture stopped")
+			return count, nil
+		case <-timer.C:
+			l.Infoln("Packet capture completed")
+			return count, nil
+		default:
+		}
+
+		packet, err := readCapturedPacket(fw, name)
+		if err != nil {
+			return count, err
+		}
+		if packet == nil {
+			time.Sleep(capturePollInterval)
+			continue
+		}
+
+		raw, err := base64.StdEncoding.DecodeString(packet.RawData)
+		if err != nil {
+			return count, err
+		}
+		if err := writePcapPacket(w, packet.Seconds, packet.Microseconds, packet.Length, raw); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
+
+// readCapturedPacket gets the next packet captured, or nil if there are none
+func readCapturedPacket(fw Firewall, name string) (*packetCapturePacket, error) {
+	data, err := doRequest("GET", captureURL(fw, name, "packet/"), nil)
+	if err == errNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	packet := &packetCapturePacket{}
+	if err := json.Unmarshal(data, packet); err != nil {
+		return nil, err
+	}
+	if len(packet.RawData) < 1 {
+		return nil, nil
+	}
+	return packet, nil
+}
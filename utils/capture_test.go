@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	"github.com/SunSince90/ASTRID-kube/utils/polycubetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapture(t *testing.T) {
+	fake, fw, restore := testPolycube(t)
+	defer restore()
+
+	frame := []byte{0xde, 0xad, 0xbe, 0xef}
+	fake.Packets["pc-test"] = []polycubetest.CapturedPacket{
+		{Seconds: 10, Microseconds: 20, Length: 4, Captured: 4, RawData: base64.StdEncoding.EncodeToString(frame)},
+		{Seconds: 11, Microseconds: 0, Length: 4, Captured: 4, RawData: base64.StdEncoding.EncodeToString(frame)},
+	}
+
+	output := &bytes.Buffer{}
+	count, err := Capture(fw, "pc-test", types.CaptureFilter{Dport: 80}, 500*time.Millisecond, nil, output)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	//	Cube was configured, detached and removed
+	config, exists := fake.CaptureConfig("pc-test")
+	assert.True(t, exists)
+	assert.Equal(t, int32(80), config.Filters.Dport)
+	assert.True(t, config.NetworkMode)
+	assert.Nil(t, fake.Capture("pc-test"))
+	calls := fake.Calls()
+	assert.Equal(t, "POST detach", calls[len(calls)-2])
+	assert.Equal(t, "DELETE packetcapture/pc-test/", calls[len(calls)-1])
+
+	//	Global header and two records of 16 bytes each plus the frame
+	data := output.Bytes()
+	assert.Len(t, data, 24+2*(16+len(frame)))
+	assert.Equal(t, pcapMagic, binary.LittleEndian.Uint32(data[0:4]))
+	assert.Equal(t, uint32(10), binary.LittleEndian.Uint32(data[24:28]))
+	assert.Equal(t, frame, data[40:44])
+}
+
+func TestCaptureStop(t *testing.T) {
+	fake, fw, restore := testPolycube(t)
+	defer restore()
+
+	stop := make(chan struct{})
+	close(stop)
+	count, err := Capture(fw, "pc-test", types.CaptureFilter{}, time.Hour, stop, &bytes.Buffer{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+	assert.Nil(t, fake.Capture("pc-test"))
+	assert.Contains(t, fake.Calls(), "POST detach")
+}
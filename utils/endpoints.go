@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"strconv"
+)
+
+// Firewall is where the firewall of a pod can be found, and how it is managed.
+// Only one firewall per pod is supported: the one in its polycube sidecar, or the one pcn-k8s creates for it on its node.
+type Firewall struct {
+	//	ip is the address of the pod
+	ip string
+	//	host is the address of the polycube instance that runs the firewall
+	host string
+	//	port is where polycube listens
+	port string
+	//	cube is the name of the firewall
+	cube string
+	//	iface is the interface the firewall is attached to
+	iface string
+	//	node is true when the firewall is created and attached by pcn-k8s on the node of the pod
+	node bool
+}
+
+// DefaultFirewall returns the firewall of a pod whose polycube sidecar uses the default port, name and interface
+func DefaultFirewall(ip string) Firewall {
+	return SidecarFirewall(ip, "", "", "")
+}
+
+// SidecarFirewall returns the firewall of a pod that runs in its polycube sidecar, with the provided port, interface and name.
+// Empty values are replaced with the defaults.
+func SidecarFirewall(ip, port, iface, cube string) Firewall {
+	fw := Firewall{ip: ip, host: ip, port: port, iface: iface, cube: cube}
+	if len(fw.port) < 1 {
+		fw.port = polycubePort
+	}
+	if len(fw.iface) < 1 {
+		fw.iface = firewallPort
+	}
+	if len(fw.cube) < 1 {
+		fw.cube = firewallName
+	}
+	return fw
+}
+
+// NodeFirewall returns the firewall that pcn-k8s creates for a pod on its node,
+// to be managed instead of the one in the polycube sidecar of the pod.
+// The port is where polycube listens on the node: if empty, the default one is used.
+func NodeFirewall(ip, nodeIP, port string) Firewall {
+	if len(port) < 1 {
+		port = polycubePort
+	}
+
+	return Firewall{
+		ip:   ip,
+		host: nodeIP,
+		port: port,
+		cube: "fw-" + ip,
+		node: true,
+	}
+}
+
+// IP returns the address of the pod the firewall protects
+func (f Firewall) IP() string {
+	return f.ip
+}
+
+// chain returns the name of the chain of the firewall that filters the traffic of the pod in a direction.
+// pcn-k8s firewalls see the traffic from the other side of the pod, so their chains are swapped.
+func (f Firewall) chain(direction string) string {
+	if !f.node {
+		return direction
+	}
+
+	if direction == "ingress" {
+		return "egress"
+	}
+	return "ingress"
+}
+
+// managementPort is the port that must stay reachable in the pod, for polycube to be managed
+func (f Firewall) managementPort() int32 {
+	port, err := strconv.Atoi(f.port)
+	if err != nil {
+		return 9000
+	}
+	return int32(port)
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeFirewallURLs(t *testing.T) {
+	assert.Equal(t, "http://10.0.0.1:"+polycubePort+"/polycube/v1/firewall/fw/chain/ingress/rule/", chainURL(DefaultFirewall("10.0.0.1"), "ingress", "rule/"))
+
+	fw := NodeFirewall("10.0.0.1", "192.168.1.10", "")
+	assert.Equal(t, "10.0.0.1", fw.IP())
+
+	//	pcn-k8s sees the traffic from the other side of the pod
+	assert.Equal(t, "http://192.168.1.10:"+polycubePort+"/polycube/v1/firewall/fw-10.0.0.1/chain/egress/rule/", chainURL(fw, "ingress", "rule/"))
+	assert.Equal(t, "http://192.168.1.10:"+polycubePort+"/polycube/v1/firewall/fw-10.0.0.1/chain/ingress/stats/", chainURL(fw, "egress", "stats/"))
+}
+
+func TestSidecarFirewallEndpoint(t *testing.T) {
+	fw := SidecarFirewall("10.0.0.3", "9100", "net1", "fw-apache")
+
+	assert.Equal(t, "http://10.0.0.3:9100/polycube/v1/firewall/fw-apache/chain/ingress/rule/", chainURL(fw, "ingress", "rule/"))
+	assert.Equal(t, "net1", fw.iface)
+	assert.Equal(t, int32(9100), ManagementRule(fw, "ingress").Dport)
+	assert.Equal(t, int32(9100), ManagementRule(fw, "egress").Sport)
+
+	//	Missing values are the defaults
+	assert.Equal(t, Firewall{ip: "10.0.0.4", host: "10.0.0.4", port: polycubePort, iface: firewallPort, cube: firewallName}, SidecarFirewall("10.0.0.4", "", "", ""))
+	assert.Equal(t, DefaultFirewall("10.0.0.4"), SidecarFirewall("10.0.0.4", "", "", ""))
+}
@@ -3,7 +3,11 @@ package utils
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"time"
 
 	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
 
@@ -13,264 +17,272 @@ import (
 const (
 	polycubePath string = "/polycube/v1/"
 	firewallPath string = "firewall/"
+	//	firewallName and firewallPort are the name of the firewall and the interface it is attached to,
+	//	unless they are set differently for a pod
+	firewallName string = "fw"
+	firewallPort string = "eth0"
 )
 
-func CreateFirewall(ip string) bool {
-	resp, err := http.Post("http://"+ip+":9000"+polycubePath+firewallPath+"fw", "application/json", nil)
+var (
+	// errNotFound is returned when polycube does not know the requested resource
+	errNotFound = errors.New("Resource not found")
+
+	polycubeClient = &http.Client{Timeout: 10 * time.Second}
+
+	//	polycubePort is where polycube listens, unless it is set differently for a pod
+	polycubePort = "9000"
+)
+
+// firewallState is the firewall as it is returned by polycube,
+// along with the port it is attached to, if any.
+type firewallState struct {
+	k8sfirewall.Firewall
+	Parent string `json:"parent,omitempty"`
+}
+
+func polycubeURL(fw Firewall, resource string) string {
+	return "http://" + fw.host + ":" + fw.port + polycubePath + resource
+}
+
+func firewallURL(fw Firewall, resource string) string {
+	return polycubeURL(fw, firewallPath+fw.cube+"/"+resource)
+}
+
+// chainURL returns the url of a resource in the chain that filters the traffic of the pod in a direction
+func chainURL(fw Firewall, direction, resource string) string {
+	return firewallURL(fw, "chain/"+fw.chain(direction)+"/"+resource)
+}
+
+// doRequest sends a request to polycube and returns the body of the response.
+// Responses with a status code other than 2xx are treated as errors.
+func doRequest(method, endPoint string, data []byte) ([]byte, error) {
+	var body *bytes.Buffer
+	if data != nil {
+		body = bytes.NewBuffer(data)
+	} else {
+		body = &bytes.Buffer{}
+	}
+
+	req, err := http.NewRequest(method, endPoint, body)
 	if err != nil {
-		log.Infoln("Could not create firewall:", err, resp)
-		return false
+		return nil, err
 	}
+	req.Header.Set("Content-Type", "application/json")
 
-	if !allowAllInPolycube(ip) {
-		return false
+	resp, err := polycubeClient.Do(req)
+	if err != nil {
+		return nil, err
 	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return respBody, errNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return respBody, fmt.Errorf("%s %s returned %d: %s", method, endPoint, resp.StatusCode, string(respBody))
+	}
+
+	return respBody, nil
+}
 
-	if !acceptEstablished(ip) {
+func createFirewall(fw Firewall) bool {
+	if _, err := doRequest("POST", firewallURL(fw, ""), nil); err != nil {
+		log.Infoln("Could not create firewall:", err)
 		return false
 	}
+	return true
+}
 
-	/*if !changeDefaultForward(ip) {
+func deleteFirewall(fw Firewall) bool {
+	if _, err := doRequest("DELETE", firewallURL(fw, ""), nil); err != nil && err != errNotFound {
+		log.Infoln("Could not delete firewall:", err)
 		return false
-	}*/
-	return setAsync(ip)
+	}
+	return true
 }
 
-func allowAllInPolycube(ip string) bool {
-	marshal := func(rule k8sfirewall.ChainRule) ([]byte, error) {
-		data, err := json.MarshalIndent(&rule, "", "   ")
-		if err != nil {
-			log.Errorln("Cannot marshal to json:", err)
-			return nil, err
-		}
-		return data, nil
+// readFirewall gets the firewall currently deployed in the pod.
+// It returns nil and no error if the firewall does not exist.
+func readFirewall(fw Firewall) (*firewallState, error) {
+	data, err := doRequest("GET", firewallURL(fw, ""), nil)
+	if err == errNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	push := func(ip string) {
-		//	Ingress
-		endPoint := "http://" + ip + ":9000/polycube/v1/firewall/fw/chain/ingress/append/"
-		rule := k8sfirewall.ChainRule{
-			Action: "forward",
-			Dst:    ip,
-			Dport:  9000,
-		}
-		data, err := marshal(rule)
-		if err == nil {
-			req, err := http.NewRequest("POST", endPoint, bytes.NewBuffer(data))
-			req.Header.Set("Content-Type", "application/json")
-
-			client := &http.Client{}
-			_, err = client.Do(req)
-			if err != nil {
-				log.Errorln("Error while trying to send request:", err)
-			}
-		}
+	state := &firewallState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
 
-		// Egress
-		endPoint = "http://" + ip + ":9000/polycube/v1/firewall/fw/chain/egress/append/"
-		rule = k8sfirewall.ChainRule{
-			Action: "forward",
-			Src:    ip,
-			Sport:  9000,
-		}
-		data, err = marshal(rule)
-		if err == nil {
-			req, err := http.NewRequest("POST", endPoint, bytes.NewBuffer(data))
-			req.Header.Set("Content-Type", "application/json")
-
-			client := &http.Client{}
-			_, err = client.Do(req)
-			if err != nil {
-				log.Errorln("Error while trying to send request:", err)
-			}
-		}
+// managementRules returns the rules that keep polycube reachable from outside.
+// There are none for the firewalls of pcn-k8s, as polycube runs on the node rather than in the pod.
+func managementRules(fw Firewall) map[string]k8sfirewall.ChainRule {
+	if fw.node {
+		return map[string]k8sfirewall.ChainRule{}
 	}
 
-	apply := func(ip string) {
-		//	ingress
-		endPoint := "http://" + ip + ":9000/polycube/v1/firewall/fw/chain/ingress/apply-rules/"
-		req, err := http.NewRequest("POST", endPoint, nil)
-		req.Header.Set("Content-Type", "application/json")
-		client := &http.Client{}
+	port := fw.managementPort()
+	return map[string]k8sfirewall.ChainRule{
+		"ingress": k8sfirewall.ChainRule{
+			Action: "forward",
+			Dst:    fw.ip,
+			Dport:  port,
+		},
+		"egress": k8sfirewall.ChainRule{
+			Action: "forward",
+			Src:    fw.ip,
+			Sport:  port,
+		},
+	}
+}
 
-		_, err = client.Do(req)
+func allowAllInPolycube(fw Firewall) bool {
+	for direction, rule := range managementRules(fw) {
+		data, err := json.MarshalIndent(&rule, "", "   ")
 		if err != nil {
-			log.Errorln("Error while trying to apply rules:", err)
+			log.Errorln("Cannot marshal to json:", err)
+			return false
 		}
 
-		//	egress
-		endPoint = "http://" + ip + ":9000/polycube/v1/firewall/fw/chain/egress/apply-rules/"
-		req, err = http.NewRequest("POST", endPoint, nil)
-		req.Header.Set("Content-Type", "application/json")
-		client = &http.Client{}
+		if _, err := doRequest("POST", chainURL(fw, direction, "append/"), data); err != nil {
+			log.Errorln("Error while trying to send request:", err)
+			return false
+		}
 
-		_, err = client.Do(req)
-		if err != nil {
+		if _, err := doRequest("POST", chainURL(fw, direction, "apply-rules/"), nil); err != nil {
 			log.Errorln("Error while trying to apply rules:", err)
+			return false
 		}
 	}
 
-	push(ip)
-	apply(ip)
 	return true
 }
 
-func changeDefaultForward(ip string) bool {
+func changeDefaultForward(fw Firewall) bool {
 	jsonStr := []byte(`"forward"`)
 	directions := []string{"ingress", "egress"}
-	client := http.Client{}
 
 	for _, direction := range directions {
-		req, err := http.NewRequest("PATCH", "http://"+ip+":9000"+polycubePath+firewallPath+"fw/chain/"+direction+"/default", bytes.NewBuffer(jsonStr))
-		if err != nil {
-			log.Infoln("Could not change default action in", direction, err, req)
-			return false
-		}
-		req.Header.Set("Content-Type", "application/json")
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Infoln("Could not change default action in", direction, err, resp)
+		if _, err := doRequest("PATCH", chainURL(fw, direction, "default"), jsonStr); err != nil {
+			log.Infoln("Could not change default action in", direction, err)
 			return false
 		}
-		defer resp.Body.Close()
 	}
 
 	return true
 }
 
-func acceptEstablished(ip string) bool {
-	jsonStr := []byte(`"ON"`)
-	client := http.Client{}
+func acceptEstablished(fw Firewall) bool {
+	return SetAcceptEstablished(fw, true)
+}
 
-	req, err := http.NewRequest("PATCH", "http://"+ip+":9000"+polycubePath+firewallPath+"fw/accept-established", bytes.NewBuffer(jsonStr))
-	if err != nil {
-		log.Infof("Could not set to accet established connections by default %s", err)
-		return false
+// SetAcceptEstablished sets whether the firewall lets packets of established connections through without checking rules
+func SetAcceptEstablished(fw Firewall, accept bool) bool {
+	value := []byte(`"ON"`)
+	if !accept {
+		value = []byte(`"OFF"`)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := client.Do(req)
-	if err != nil {
+
+	if _, err := doRequest("PATCH", firewallURL(fw, "accept-established"), value); err != nil {
 		log.Infof("Could not set to accet established connections by default %s", err)
 		return false
 	}
-	defer resp.Body.Close()
 
 	return true
 }
 
-func AttachFirewall(ip string) bool {
-	var jsonStr = []byte(`{"cube":"fw", "port":"eth0"}`)
-	resp, err := http.Post("http://"+ip+":9000"+polycubePath+"attach", "application/json", bytes.NewBuffer(jsonStr))
+// AcceptsEstablished tells whether the firewall lets packets of established connections through without checking rules
+func AcceptsEstablished(fw Firewall) (bool, error) {
+	state, err := readFirewall(fw)
 	if err != nil {
-		log.Infoln("Could not attach firewall:", err, resp)
+		return false, err
+	}
+	if state == nil {
+		return false, errNotFound
+	}
+	return state.AcceptEstablished == "ON", nil
+}
+
+func attachFirewall(fw Firewall) bool {
+	jsonStr := []byte(`{"cube":"` + fw.cube + `", "port":"` + fw.iface + `"}`)
+	if _, err := doRequest("POST", polycubeURL(fw, "attach"), jsonStr); err != nil {
+		log.Infoln("Could not attach firewall:", err)
 		return false
 	}
 	return true
 }
 
-func setAsync(ip string) bool {
-	jsonStr := []byte(`true`)
-	client := http.Client{}
-
-	req, err := http.NewRequest("PATCH", "http://"+ip+":9000"+polycubePath+firewallPath+"fw/interactive", bytes.NewBuffer(jsonStr))
-	if err != nil {
-		log.Infoln("Could not set firewall as asynchronous", err, req)
+func detachFirewall(fw Firewall) bool {
+	jsonStr := []byte(`{"cube":"` + fw.cube + `", "port":"` + fw.iface + `"}`)
+	if _, err := doRequest("POST", polycubeURL(fw, "detach"), jsonStr); err != nil && err != errNotFound {
+		log.Infoln("Could not detach firewall:", err)
 		return false
 	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Infoln("Could not set firewall as asynchronous", err, resp)
+	return true
+}
+
+func setAsync(fw Firewall) bool {
+	return setInteractive(fw, true)
+}
+
+// setInteractive sets whether the firewall applies each change to its rules as soon as it is made
+func setInteractive(fw Firewall, interactive bool) bool {
+	value := []byte(`true`)
+	if !interactive {
+		value = []byte(`false`)
+	}
+
+	if _, err := doRequest("PATCH", firewallURL(fw, "interactive"), value); err != nil {
+		log.Infoln("Could not set firewall as asynchronous", err)
 		return false
 	}
-	defer resp.Body.Close()
 	return true
 }
 
+// DemoFakeDropAll makes each of the provided pods, by ip, drop all traffic with the others.
+// Their firewalls are expected to be the default ones in their polycube sidecar.
 func DemoFakeDropAll(ips map[string]string) {
-	marshal := func(rule k8sfirewall.ChainRule) ([]byte, error) {
+	push := func(fw Firewall, direction string, rule k8sfirewall.ChainRule) {
 		data, err := json.MarshalIndent(&rule, "", "   ")
 		if err != nil {
 			log.Errorln("Cannot marshal to json:", err)
-			return nil, err
-		}
-		return data, nil
-	}
-
-	push := func(ip, target string) {
-
-		//	Ingress
-		endPoint := "http://" + ip + ":9000/polycube/v1/firewall/fw/chain/ingress/append/"
-		rule := k8sfirewall.ChainRule{
-			Action: "drop",
-			Src:    ip,
-			Dst:    target,
-		}
-		data, err := marshal(rule)
-		if err == nil {
-			req, err := http.NewRequest("POST", endPoint, bytes.NewBuffer(data))
-			req.Header.Set("Content-Type", "application/json")
-
-			client := &http.Client{}
-			_, err = client.Do(req)
-			if err != nil {
-				log.Errorln("Error while trying to send request:", err)
-			}
+			return
 		}
 
-		// Egress
-		endPoint = "http://" + ip + ":9000/polycube/v1/firewall/fw/chain/egress/append/"
-		rule = k8sfirewall.ChainRule{
-			Action: "drop",
-			Src:    target,
-			Dst:    ip,
-		}
-		data, err = marshal(rule)
-		if err == nil {
-			req, err := http.NewRequest("POST", endPoint, bytes.NewBuffer(data))
-			req.Header.Set("Content-Type", "application/json")
-
-			client := &http.Client{}
-			_, err = client.Do(req)
-			if err != nil {
-				log.Errorln("Error while trying to send request:", err)
-			}
+		if _, err := doRequest("POST", chainURL(fw, direction, "append/"), data); err != nil {
+			log.Errorln("Error while trying to send request:", err)
 		}
 	}
 
-	apply := func(ip, name string) {
-		//	ingress
-		endPoint := "http://" + ip + ":9000/polycube/v1/firewall/fw/chain/ingress/apply-rules/"
-		req, err := http.NewRequest("POST", endPoint, nil)
-		req.Header.Set("Content-Type", "application/json")
-		client := &http.Client{}
-
-		_, err = client.Do(req)
-		if err != nil {
-			log.Errorln("Error while trying to apply rules:", err)
-		}
-
-		//	egress
-		endPoint = "http://" + ip + ":9000/polycube/v1/firewall/fw/chain/egress/apply-rules/"
-		req, err = http.NewRequest("POST", endPoint, nil)
-		req.Header.Set("Content-Type", "application/json")
-		client = &http.Client{}
-
-		_, err = client.Do(req)
-		if err != nil {
-			log.Errorln("Error while trying to apply rules:", err)
+	apply := func(fw Firewall, name string) {
+		for _, direction := range Directions {
+			if _, err := doRequest("POST", chainURL(fw, direction, "apply-rules/"), nil); err != nil {
+				log.Errorln("Error while trying to apply rules:", err)
+			}
 		}
 
 		log.Infoln(name, "is in a drop-all mode, waiting for policies.")
 	}
 
 	for currentIP, currentName := range ips {
+		fw := DefaultFirewall(currentIP)
 		for target := range ips {
 			if currentIP != target {
-				push(currentIP, target)
+				push(fw, "ingress", k8sfirewall.ChainRule{Action: "drop", Src: currentIP, Dst: target})
+				push(fw, "egress", k8sfirewall.ChainRule{Action: "drop", Src: target, Dst: currentIP})
 			}
 		}
 
-		apply(currentIP, currentName)
+		apply(fw, currentName)
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"errors"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
@@ -50,3 +51,34 @@ func Marshal(to types.EncodingType, target interface{}) ([]byte, string, error)
 
 	return nil, "", errors.New("Unrecognized format")
 }
+
+// Unmarshal parses data in the provided format
+func Unmarshal(from types.EncodingType, data []byte, target interface{}) error {
+	switch from {
+	case types.XML:
+		return xml.Unmarshal(data, target)
+	case types.YAML:
+		return yaml.Unmarshal(data, target)
+	case types.JSON:
+		return json.Unmarshal(data, target)
+	}
+
+	return errors.New("Unrecognized format")
+}
+
+// EncodingFromContentType returns the format of a content type, and false if it is not supported
+func EncodingFromContentType(contentType string) (types.EncodingType, bool) {
+	//	Parameters, i.e. charset, are not relevant here
+	contentType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+
+	switch contentType {
+	case types.ContentTypeXML, "text/xml":
+		return types.XML, true
+	case types.ContentTypeYAML, "application/x-yaml", "text/yaml":
+		return types.YAML, true
+	case types.ContentTypeJSON:
+		return types.JSON, true
+	}
+
+	return "", false
+}
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+)
+
+// CreatePatch returns the JSON Patch (RFC 6902) that turns the json of before into the json of after
+func CreatePatch(before, after interface{}) ([]types.PatchOperation, error) {
+	from, err := toGeneric(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := toGeneric(after)
+	if err != nil {
+		return nil, err
+	}
+
+	return diff("", from, to, []types.PatchOperation{})
+}
+
+func toGeneric(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic interface{}
+	err = json.Unmarshal(data, &generic)
+	return generic, err
+}
+
+func diff(path string, from, to interface{}, patch []types.PatchOperation) ([]types.PatchOperation, error) {
+	if reflect.DeepEqual(from, to) {
+		return patch, nil
+	}
+
+	switch from := from.(type) {
+	case map[string]interface{}:
+		to, ok := to.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		//	Sorted, so that the same change always gives the same patch
+		keys := []string{}
+		for key := range from {
+			keys = append(keys, key)
+		}
+		for key := range to {
+			if _, exists := from[key]; !exists {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		var err error
+		for _, key := range keys {
+			child := path + "/" + escape(key)
+			before, inBefore := from[key]
+			after, inAfter := to[key]
+			switch {
+			case !inAfter:
+				patch = append(patch, types.PatchOperation{Op: "remove", Path: child})
+			case !inBefore:
+				if patch, err = operation(patch, "add", child, after); err != nil {
+					return nil, err
+				}
+			default:
+				if patch, err = diff(child, before, after, patch); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return patch, nil
+	case []interface{}:
+		to, ok := to.([]interface{})
+		if !ok {
+			break
+		}
+
+		var err error
+		common := len(from)
+		if len(to) < common {
+			common = len(to)
+		}
+		for j := 0; j < common; j++ {
+			if patch, err = diff(path+"/"+strconv.Itoa(j), from[j], to[j], patch); err != nil {
+				return nil, err
+			}
+		}
+		for j := common; j < len(to); j++ {
+			if patch, err = operation(patch, "add", path+"/-", to[j]); err != nil {
+				return nil, err
+			}
+		}
+		//	From the last one, so that indexes of the others do not change
+		for j := len(from) - 1; j >= common; j-- {
+			patch = append(patch, types.PatchOperation{Op: "remove", Path: path + "/" + strconv.Itoa(j)})
+		}
+		return patch, nil
+	}
+
+	return operation(patch, "replace", path, to)
+}
+
+func operation(patch []types.PatchOperation, op, path string, value interface{}) ([]types.PatchOperation, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return append(patch, types.PatchOperation{Op: op, Path: path, Value: data}), nil
+}
+
+// escape escapes a key to be part of a JSON Pointer (RFC 6901)
+func escape(key string) string {
+	return strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1)
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/SunSince90/ASTRID-kube/types"
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreatePatch(t *testing.T) {
+	before := types.InfrastructureInfo{
+		Kind:     types.KIND,
+		Metadata: types.InfrastructureInfoMetadata{Name: "mygraph", Revision: 1},
+		Spec: types.InfrastructureInfoSpec{
+			Nodes: []types.InfrastructureInfoNode{{IP: "192.168.1.1"}, {IP: "192.168.1.2"}},
+			Services: []types.InfrastructureInfoService{{
+				Name:      "apache",
+				Ports:     []types.InfrastructureInfoServicePort{{Port: 80, Protocol: types.TCP}},
+				Instances: []types.InfrastructureInfoServiceInstance{{IP: "10.0.0.1", UID: "apache-1"}},
+			}},
+		},
+	}
+	after := before
+	after.Metadata.Revision = 2
+	after.Spec.Nodes = []types.InfrastructureInfoNode{{IP: "192.168.1.1"}}
+	after.Spec.Services = []types.InfrastructureInfoService{{
+		Name:               "apache",
+		SecurityComponents: []types.InfrastructureInfoSecurityComponent{{Name: "firewall"}},
+		Ports:              []types.InfrastructureInfoServicePort{{Port: 8080, Protocol: types.TCP}},
+		Instances:          []types.InfrastructureInfoServiceInstance{{IP: "10.0.0.1", UID: "apache-1", Quarantined: true}, {IP: "10.0.0.2", UID: "apache-2"}},
+	}}
+
+	patch, err := CreatePatch(before, after)
+	assert.NoError(t, err)
+	assert.Contains(t, patch, types.PatchOperation{Op: "replace", Path: "/metadata/revision", Value: json.RawMessage("2")})
+	assert.Contains(t, patch, types.PatchOperation{Op: "remove", Path: "/spec/nodes/1"})
+	assert.Contains(t, patch, types.PatchOperation{Op: "replace", Path: "/spec/services/0/ports/0/port", Value: json.RawMessage("8080")})
+
+	//	It gives after when applied to before
+	data, _ := json.Marshal(patch)
+	decoded, err := jsonpatch.DecodePatch(data)
+	assert.NoError(t, err)
+	from, _ := json.Marshal(before)
+	to, _ := json.Marshal(after)
+	applied, err := decoded.Apply(from)
+	assert.NoError(t, err)
+	assert.True(t, jsonpatch.Equal(to, applied))
+
+	patch, err = CreatePatch(after, after)
+	assert.NoError(t, err)
+	assert.Empty(t, patch)
+}
+
+func TestPatchFormats(t *testing.T) {
+	delta := types.InfrastructureInfoDelta{
+		GraphName:      "mygraph",
+		BaseRevision:   1,
+		TargetRevision: 2,
+		Patch:          []types.PatchOperation{{Op: "add", Path: "/spec/nodes/-", Value: json.RawMessage(`{"ip":"192.168.1.3"}`)}, {Op: "remove", Path: "/spec/nodes/0"}},
+	}
+
+	data, _, err := Marshal(types.YAML, delta)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "ip: 192.168.1.3")
+
+	data, _, err = Marshal(types.XML, delta)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `<Operation op="add" path="/spec/nodes/-">`)
+	assert.Contains(t, string(data), `<Value>{&#34;ip&#34;:&#34;192.168.1.3&#34;}</Value>`)
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+const (
+	pcapMagic        uint32 = 0xa1b2c3d4
+	pcapVersionMajor uint16 = 2
+	pcapVersionMinor uint16 = 4
+	pcapSnapLen      uint32 = 65535
+	pcapEthernet     uint32 = 1
+)
+
+// writePcapHeader writes the global header of a pcap file containing ethernet frames
+func writePcapHeader(w io.Writer) error {
+	header := struct {
+		Magic        uint32
+		VersionMajor uint16
+		VersionMinor uint16
+		ThisZone     int32
+		SigFigs      uint32
+		SnapLen      uint32
+		Network      uint32
+	}{pcapMagic, pcapVersionMajor, pcapVersionMinor, 0, 0, pcapSnapLen, pcapEthernet}
+
+	return binary.Write(w, binary.LittleEndian, &header)
+}
+
+// writePcapPacket writes a single packet record of a pcap file, all at once
+func writePcapPacket(w io.Writer, seconds, microseconds, length uint32, data []byte) error {
+	header := struct {
+		Seconds      uint32
+		Microseconds uint32
+		Captured     uint32
+		Length       uint32
+	}{seconds, microseconds, uint32(len(data)), length}
+
+	record := &bytes.Buffer{}
+	if err := binary.Write(record, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+	record.Write(data)
+
+	_, err := w.Write(record.Bytes())
+	return err
+}
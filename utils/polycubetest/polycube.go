@@ -0,0 +1,439 @@
+// Package polycubetest provides a fake polycube that serves the firewall and packetcapture APIs, to be used in tests.
+package polycubetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
+)
+
+const basePath = "/polycube/v1/"
+
+// Polycube emulates the firewall and packetcapture services of polycube
+type Polycube struct {
+	lock     sync.Mutex
+	server   *httptest.Server
+	cubes    map[string]*Firewall
+	captures map[string]*Capture
+	//	configs are the last configurations of packetcapture cubes, by name, kept after they are deleted
+	configs map[string]CaptureConfig
+	calls   []string
+	fail    map[string]int
+	//	Normalize makes it add the prefix length to addresses of rules, as polycube does
+	Normalize bool
+	//	Stats are the counters returned for each chain, by cube and chain name
+	Stats map[string]map[string][]json.RawMessage
+	//	Packets are returned by the packetcapture cube with the same name, one at a time, once it is created
+	Packets map[string][]CapturedPacket
+}
+
+// Firewall is a firewall that was created in the fake polycube
+type Firewall struct {
+	AcceptEstablished string
+	Interactive       bool
+	Parent            string
+	Chains            map[string][]k8sfirewall.ChainRule
+	Defaults          map[string]string
+}
+
+// Capture is a packetcapture cube that was created in the fake polycube
+type Capture struct {
+	Config CaptureConfig
+	Parent string
+}
+
+// CaptureConfig is how a packetcapture cube is created
+type CaptureConfig struct {
+	Capture     string `json:"capture"`
+	NetworkMode bool   `json:"networkmode"`
+	Filters     struct {
+		Src     string `json:"src,omitempty"`
+		Dst     string `json:"dst,omitempty"`
+		L4proto string `json:"l4proto,omitempty"`
+		Sport   int32  `json:"sport,omitempty"`
+		Dport   int32  `json:"dport,omitempty"`
+	} `json:"filters"`
+}
+
+// CapturedPacket is a packet returned by a packetcapture cube in network mode
+type CapturedPacket struct {
+	Seconds      uint32 `json:"timestamp-seconds"`
+	Microseconds uint32 `json:"timestamp-microseconds"`
+	Length       uint32 `json:"packetlength"`
+	Captured     uint32 `json:"capturedlength"`
+	RawData      string `json:"rawdata"`
+}
+
+// New starts a fake polycube
+func New() *Polycube {
+	p := &Polycube{
+		cubes:    map[string]*Firewall{},
+		captures: map[string]*Capture{},
+		configs:  map[string]CaptureConfig{},
+		fail:     map[string]int{},
+		Stats:    map[string]map[string][]json.RawMessage{},
+		Packets:  map[string][]CapturedPacket{},
+	}
+	p.server = httptest.NewServer(p)
+	return p
+}
+
+// Close stops the fake polycube
+func (p *Polycube) Close() {
+	p.server.Close()
+}
+
+// Host is the address the fake polycube listens on
+func (p *Polycube) Host() string {
+	host, _, _ := net.SplitHostPort(p.server.Listener.Addr().String())
+	return host
+}
+
+// Port is the port the fake polycube listens on
+func (p *Polycube) Port() string {
+	_, port, _ := net.SplitHostPort(p.server.Listener.Addr().String())
+	return port
+}
+
+// Fail makes all requests with the provided method and path, relative to the polycube api, fail with the status code.
+// A status code of 0 makes them succeed again.
+func (p *Polycube) Fail(method, path string, status int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if status == 0 {
+		delete(p.fail, method+" "+path)
+		return
+	}
+	p.fail[method+" "+path] = status
+}
+
+// Calls returns the requests received so far, as method and path relative to the polycube api
+func (p *Polycube) Calls() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return append([]string{}, p.calls...)
+}
+
+// Firewall returns a copy of a firewall, or nil if it does not exist
+func (p *Polycube) Firewall(cube string) *Firewall {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	fw, exists := p.cubes[cube]
+	if !exists {
+		return nil
+	}
+	copied := *fw
+	copied.Chains = map[string][]k8sfirewall.ChainRule{}
+	for name, rules := range fw.Chains {
+		copied.Chains[name] = append([]k8sfirewall.ChainRule{}, rules...)
+	}
+	return &copied
+}
+
+// Rules returns the rules of a chain of a firewall, with their ids
+func (p *Polycube) Rules(cube, chain string) []k8sfirewall.ChainRule {
+	fw := p.Firewall(cube)
+	if fw == nil {
+		return nil
+	}
+	return numbered(fw.Chains[chain])
+}
+
+// Capture returns a copy of a packetcapture cube, or nil if it does not exist
+func (p *Polycube) Capture(cube string) *Capture {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	capture, exists := p.captures[cube]
+	if !exists {
+		return nil
+	}
+	copied := *capture
+	return &copied
+}
+
+// CaptureConfig returns the last configuration a packetcapture cube was created with, even if it was deleted
+func (p *Polycube) CaptureConfig(cube string) (CaptureConfig, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	config, exists := p.configs[cube]
+	return config, exists
+}
+
+// SetFirewall creates or replaces a firewall
+func (p *Polycube) SetFirewall(cube string, fw Firewall) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if fw.Chains == nil {
+		fw.Chains = map[string][]k8sfirewall.ChainRule{}
+	}
+	if fw.Defaults == nil {
+		fw.Defaults = map[string]string{}
+	}
+	p.cubes[cube] = &fw
+}
+
+// Restart forgets all firewalls, as it happens when polycube restarts
+func (p *Polycube) Restart() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.cubes = map[string]*Firewall{}
+}
+
+func (p *Polycube) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, basePath)
+	call := r.Method + " " + path
+	p.calls = append(p.calls, call)
+	body, _ := ioutil.ReadAll(r.Body)
+
+	if status, exists := p.fail[call]; exists {
+		http.Error(w, "failing on purpose", status)
+		return
+	}
+
+	if path == "attach" || path == "detach" {
+		p.attach(w, path == "attach", body)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) >= 2 && parts[0] == "packetcapture" {
+		p.capture(w, r, parts[1], parts[2:], body)
+		return
+	}
+	if len(parts) < 2 || parts[0] != "firewall" {
+		http.NotFound(w, r)
+		return
+	}
+	cube, parts := parts[1], parts[2:]
+	fw, exists := p.cubes[cube]
+
+	if len(parts) == 0 {
+		switch r.Method {
+		case http.MethodPost:
+			if exists {
+				http.Error(w, "cube already exists", http.StatusConflict)
+				return
+			}
+			p.cubes[cube] = &Firewall{
+				AcceptEstablished: "OFF",
+				Chains:            map[string][]k8sfirewall.ChainRule{},
+				Defaults:          map[string]string{},
+			}
+		case http.MethodDelete:
+			if !exists {
+				http.NotFound(w, r)
+				return
+			}
+			delete(p.cubes, cube)
+		case http.MethodGet:
+			if !exists {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(fw.state(cube))
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPatch && parts[0] == "accept-established":
+		json.Unmarshal(body, &fw.AcceptEstablished)
+	case r.Method == http.MethodPatch && parts[0] == "interactive":
+		json.Unmarshal(body, &fw.Interactive)
+	case parts[0] == "chain" && len(parts) >= 3:
+		p.chain(w, r, fw, cube, parts[1], parts[2:], body)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *Polycube) attach(w http.ResponseWriter, attach bool, body []byte) {
+	request := struct {
+		Cube string `json:"cube"`
+		Port string `json:"port"`
+	}{}
+	json.Unmarshal(body, &request)
+
+	if capture, exists := p.captures[request.Cube]; exists {
+		if attach {
+			capture.Parent = request.Port
+		} else {
+			capture.Parent = ""
+		}
+		return
+	}
+
+	fw, exists := p.cubes[request.Cube]
+	if !exists {
+		http.NotFound(w, nil)
+		return
+	}
+	if !attach {
+		fw.Parent = ""
+		return
+	}
+	if len(fw.Parent) > 0 {
+		http.Error(w, "cube already attached", http.StatusConflict)
+		return
+	}
+	fw.Parent = request.Port
+}
+
+func (p *Polycube) chain(w http.ResponseWriter, r *http.Request, fw *Firewall, cube, chain string, parts []string, body []byte) {
+	rules := fw.Chains[chain]
+
+	switch {
+	case r.Method == http.MethodPost && parts[0] == "append":
+		rule := k8sfirewall.ChainRule{}
+		json.Unmarshal(body, &rule)
+		fw.Chains[chain] = append(rules, p.normalize(rule))
+	case r.Method == http.MethodPost && parts[0] == "insert":
+		input := k8sfirewall.ChainInsertInput{}
+		json.Unmarshal(body, &input)
+		if input.Id < 0 || int(input.Id) > len(rules) {
+			http.Error(w, "invalid position", http.StatusBadRequest)
+			return
+		}
+		rule := p.normalize(k8sfirewall.ChainRule{
+			Src:         input.Src,
+			Dst:         input.Dst,
+			L4proto:     input.L4proto,
+			Sport:       input.Sport,
+			Dport:       input.Dport,
+			Tcpflags:    input.Tcpflags,
+			Conntrack:   input.Conntrack,
+			Action:      input.Action,
+			Description: input.Description,
+		})
+		updated := append([]k8sfirewall.ChainRule{}, rules[:input.Id]...)
+		updated = append(updated, rule)
+		fw.Chains[chain] = append(updated, rules[input.Id:]...)
+	case r.Method == http.MethodPost && parts[0] == "apply-rules":
+	case r.Method == http.MethodPatch && parts[0] == "default":
+		action := ""
+		json.Unmarshal(body, &action)
+		fw.Defaults[chain] = action
+	case r.Method == http.MethodGet && parts[0] == "rule" && len(parts) == 1:
+		json.NewEncoder(w).Encode(numbered(rules))
+	case r.Method == http.MethodDelete && parts[0] == "rule" && len(parts) == 2:
+		id, err := strconv.Atoi(parts[1])
+		if err != nil || id < 0 || id >= len(rules) {
+			http.NotFound(w, r)
+			return
+		}
+		fw.Chains[chain] = append(rules[:id:id], rules[id+1:]...)
+	case r.Method == http.MethodGet && parts[0] == "stats":
+		stats := p.Stats[cube][chain]
+		if stats == nil {
+			stats = []json.RawMessage{}
+		}
+		json.NewEncoder(w).Encode(stats)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *Polycube) capture(w http.ResponseWriter, r *http.Request, cube string, parts []string, body []byte) {
+	_, exists := p.captures[cube]
+
+	switch {
+	case r.Method == http.MethodPost && len(parts) == 0:
+		if exists {
+			http.Error(w, "cube already exists", http.StatusConflict)
+			return
+		}
+		config := CaptureConfig{}
+		json.Unmarshal(body, &config)
+		p.captures[cube] = &Capture{Config: config}
+		p.configs[cube] = config
+	case r.Method == http.MethodDelete && len(parts) == 0:
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		delete(p.captures, cube)
+	case r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "packet":
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		//	Polycube returns an empty packet when there are none
+		packets := p.Packets[cube]
+		if len(packets) == 0 {
+			w.Write([]byte(`{}`))
+			return
+		}
+		json.NewEncoder(w).Encode(packets[0])
+		p.Packets[cube] = packets[1:]
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// normalize changes a rule the way polycube does when it stores it
+func (p *Polycube) normalize(rule k8sfirewall.ChainRule) k8sfirewall.ChainRule {
+	rule.Id = 0
+	if !p.Normalize {
+		return rule
+	}
+	for _, address := range []*string{&rule.Src, &rule.Dst} {
+		if len(*address) > 0 && !strings.Contains(*address, "/") {
+			*address = fmt.Sprintf("%s/32", *address)
+		}
+	}
+	rule.Action = strings.ToUpper(rule.Action)
+	return rule
+}
+
+func (fw *Firewall) state(cube string) interface{} {
+	chains := []k8sfirewall.Chain{}
+	for name, rules := range fw.Chains {
+		chains = append(chains, k8sfirewall.Chain{Name: name, Default_: fw.Defaults[name], Rule: numbered(rules)})
+	}
+	return struct {
+		k8sfirewall.Firewall
+		Parent string `json:"parent,omitempty"`
+	}{
+		Firewall: k8sfirewall.Firewall{
+			Name:              cube,
+			AcceptEstablished: fw.AcceptEstablished,
+			Interactive:       fw.Interactive,
+			Chain:             chains,
+		},
+		Parent: fw.Parent,
+	}
+}
+
+func numbered(rules []k8sfirewall.ChainRule) []k8sfirewall.ChainRule {
+	result := make([]k8sfirewall.ChainRule, len(rules))
+	for j, rule := range rules {
+		rule.Id = int32(j)
+		result[j] = rule
+	}
+	return result
+}
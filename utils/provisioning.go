@@ -0,0 +1,170 @@
+package utils
+
+import (
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
+	log "github.com/sirupsen/logrus"
+)
+
+// provisioningStep is a single step needed to provision a firewall,
+// along with the action that undoes it in case a later step fails.
+type provisioningStep struct {
+	name       string
+	apply      func(fw Firewall) bool
+	compensate func(fw Firewall) bool
+}
+
+// firewallSteps returns the steps needed to get a working firewall, in order.
+func firewallSteps() []provisioningStep {
+	return []provisioningStep{
+		{name: "create", apply: createFirewall, compensate: deleteFirewall},
+		{name: "allow-management", apply: allowAllInPolycube},
+		{name: "accept-established", apply: acceptEstablished},
+		{name: "interactive", apply: setAsync},
+		{name: "attach", apply: attachFirewall, compensate: detachFirewall},
+	}
+}
+
+// ProvisionFirewall creates the firewall of a pod and attaches it.
+// If a firewall already exists and is configured as expected, it is adopted,
+// otherwise it is removed and provisioned again from scratch.
+// The firewall of a quarantined pod is expected not to accept established connections.
+// When a step fails, all the steps completed so far are rolled back,
+// so that calling it again always converges to one attached firewall.
+func ProvisionFirewall(fw Firewall, quarantined bool) bool {
+	l := log.WithFields(log.Fields{"IP": fw.ip})
+
+	if fw.node {
+		return adoptNodeFirewall(fw)
+	}
+
+	existing, err := readFirewall(fw)
+	if err != nil {
+		l.Infoln("Could not get the current firewall:", err)
+		return false
+	}
+
+	if existing != nil {
+		if matchesDesired(fw, existing, quarantined) {
+			if existing.Parent == fw.iface {
+				l.Infoln("Adopting existing firewall")
+				return true
+			}
+
+			l.Infoln("Adopting existing firewall, which is not attached")
+			return attachFirewall(fw)
+		}
+
+		l.Infoln("Existing firewall does not match the desired configuration, going to recreate it")
+		if len(existing.Parent) > 0 && !detachFirewall(fw) {
+			return false
+		}
+		if !deleteFirewall(fw) {
+			return false
+		}
+	}
+
+	return runSteps(fw, firewallSteps())
+}
+
+// adoptNodeFirewall uses the firewall that pcn-k8s created for the pod.
+// It is never created, attached or configured here, as pcn-k8s owns it: it only needs to exist.
+func adoptNodeFirewall(fw Firewall) bool {
+	l := log.WithFields(log.Fields{"IP": fw.ip})
+
+	existing, err := readFirewall(fw)
+	if err != nil {
+		l.Infoln("Could not get the current firewall:", err)
+		return false
+	}
+	if existing == nil {
+		l.Infoln("pcn-k8s did not create the firewall yet")
+		return false
+	}
+
+	l.Infoln("Adopting existing node firewall")
+	return true
+}
+
+// runSteps applies all steps in order and compensates the completed ones,
+// in reverse order, as soon as one of them fails.
+func runSteps(fw Firewall, steps []provisioningStep) bool {
+	l := log.WithFields(log.Fields{"IP": fw.ip})
+
+	for i, step := range steps {
+		if step.apply(fw) {
+			continue
+		}
+
+		l.Errorf("Step %s failed, rolling back", step.name)
+		for j := i - 1; j >= 0; j-- {
+			if steps[j].compensate == nil {
+				continue
+			}
+			if !steps[j].compensate(fw) {
+				l.Errorf("Could not roll back step %s", steps[j].name)
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// matchesDesired checks if the firewall is configured as ProvisionFirewall would do,
+// or as the quarantine leaves it, which stops accepting established connections and drops all packets.
+// It must not be attached to another port, and its chains must have no rules other than those.
+// Firewalls of pcn-k8s are used as they are, so any of them does.
+func matchesDesired(fw Firewall, state *firewallState, quarantined bool) bool {
+	if fw.node {
+		return true
+	}
+	acceptEstablished := "ON"
+	if quarantined {
+		acceptEstablished = "OFF"
+	}
+	if state.AcceptEstablished != acceptEstablished || !state.Interactive {
+		return false
+	}
+	if len(state.Parent) > 0 && state.Parent != fw.iface {
+		return false
+	}
+
+	for direction, management := range managementRules(fw) {
+		desired := []k8sfirewall.ChainRule{management}
+		if quarantined {
+			desired = append(desired, DropAllRule())
+		}
+
+		rules := []k8sfirewall.ChainRule{}
+		for _, chain := range state.Chain {
+			if chain.Name == fw.chain(direction) {
+				rules = chain.Rule
+			}
+		}
+
+		if len(rules) != len(desired) {
+			return false
+		}
+		for j := range desired {
+			if !SameRule(desired[j], rules[j]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// FirewallHealthy checks if the firewall exists in the pod and is attached to its interface.
+// Firewalls of pcn-k8s only need to exist, as it attaches them by itself.
+func FirewallHealthy(fw Firewall) (bool, error) {
+	state, err := readFirewall(fw)
+	if err != nil {
+		return false, err
+	}
+	if fw.node {
+		return state != nil, nil
+	}
+
+	return state != nil && state.Parent == fw.iface, nil
+}
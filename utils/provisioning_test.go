@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/SunSince90/ASTRID-kube/utils/polycubetest"
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPolycube starts a fake polycube, which manages the returned firewall
+func testPolycube(t *testing.T) (*polycubetest.Polycube, Firewall, func()) {
+	fake := polycubetest.New()
+	defaultPort := polycubePort
+	polycubePort = fake.Port()
+
+	return fake, DefaultFirewall(fake.Host()), func() {
+		polycubePort = defaultPort
+		fake.Close()
+	}
+}
+
+func TestProvisionFirewall(t *testing.T) {
+	fake, fw, restore := testPolycube(t)
+	defer restore()
+
+	assert.True(t, ProvisionFirewall(fw, false))
+	state := fake.Firewall(firewallName)
+	if assert.NotNil(t, state) {
+		assert.Equal(t, "ON", state.AcceptEstablished)
+		assert.True(t, state.Interactive)
+		assert.Equal(t, firewallPort, state.Parent)
+		assert.Len(t, state.Chains["ingress"], 1)
+		assert.Len(t, state.Chains["egress"], 1)
+	}
+
+	healthy, err := FirewallHealthy(fw)
+	assert.NoError(t, err)
+	assert.True(t, healthy)
+}
+
+func TestProvisionFirewallRollback(t *testing.T) {
+	fake, fw, restore := testPolycube(t)
+	defer restore()
+
+	//	The firewall that was created is removed, so that nothing half configured is left
+	fake.Fail("POST", "attach", 500)
+	assert.False(t, ProvisionFirewall(fw, false))
+	assert.Nil(t, fake.Firewall(firewallName))
+	assert.Equal(t, "DELETE firewall/"+firewallName+"/", fake.Calls()[len(fake.Calls())-1])
+
+	healthy, err := FirewallHealthy(fw)
+	assert.NoError(t, err)
+	assert.False(t, healthy)
+
+	//	and trying again converges
+	fake.Fail("POST", "attach", 0)
+	assert.True(t, ProvisionFirewall(fw, false))
+	assert.Equal(t, firewallPort, fake.Firewall(firewallName).Parent)
+}
+
+func TestProvisionFirewallAdopt(t *testing.T) {
+	fake, fw, restore := testPolycube(t)
+	defer restore()
+
+	//	polycube stores the addresses of the management rules as networks
+	fake.Normalize = true
+	assert.True(t, ProvisionFirewall(fw, false))
+	assert.Equal(t, fw.ip+"/32", fake.Firewall(firewallName).Chains["ingress"][0].Dst)
+
+	calls := len(fake.Calls())
+	assert.True(t, ProvisionFirewall(fw, false))
+	assert.Equal(t, []string{"GET firewall/" + firewallName + "/"}, fake.Calls()[calls:])
+
+	//	One that is not attached is attached again, without being recreated
+	assert.True(t, detachFirewall(fw))
+	calls = len(fake.Calls())
+	assert.True(t, ProvisionFirewall(fw, false))
+	assert.Equal(t, []string{"GET firewall/" + firewallName + "/", "POST attach"}, fake.Calls()[calls:])
+	assert.Equal(t, firewallPort, fake.Firewall(firewallName).Parent)
+
+	//	One that is configured differently is recreated
+	assert.True(t, SetAcceptEstablished(fw, false))
+	calls = len(fake.Calls())
+	assert.True(t, ProvisionFirewall(fw, false))
+	assert.Contains(t, fake.Calls()[calls:], "DELETE firewall/"+firewallName+"/")
+	assert.Equal(t, "ON", fake.Firewall(firewallName).AcceptEstablished)
+	assert.Len(t, fake.Firewall(firewallName).Chains["ingress"], 1)
+
+	//	and so is one with other rules
+	assert.NoError(t, InsertRule(fw, "ingress", 1, k8sfirewall.ChainRule{Action: "drop", Src: "10.0.0.2"}))
+	calls = len(fake.Calls())
+	assert.True(t, ProvisionFirewall(fw, false))
+	assert.Contains(t, fake.Calls()[calls:], "DELETE firewall/"+firewallName+"/")
+	assert.Len(t, fake.Firewall(firewallName).Chains["ingress"], 1)
+
+	//	or one attached to another port
+	assert.True(t, detachFirewall(fw))
+	assert.True(t, attachFirewall(SidecarFirewall(fw.ip, fw.port, "veth9", "")))
+	calls = len(fake.Calls())
+	assert.True(t, ProvisionFirewall(fw, false))
+	assert.Contains(t, fake.Calls()[calls:], "DELETE firewall/"+firewallName+"/")
+	assert.Equal(t, firewallPort, fake.Firewall(firewallName).Parent)
+
+	//	A quarantined one is expected to drop everything after the management rules
+	assert.False(t, matchesDesired(fw, readState(t, fw), true))
+	assert.True(t, SetAcceptEstablished(fw, false))
+	assert.NoError(t, InsertRule(fw, "ingress", 1, DropAllRule()))
+	assert.NoError(t, InsertRule(fw, "egress", 1, DropAllRule()))
+	assert.True(t, matchesDesired(fw, readState(t, fw), true))
+}
+
+func readState(t *testing.T, fw Firewall) *firewallState {
+	state, err := readFirewall(fw)
+	assert.NoError(t, err)
+	return state
+}
+
+func TestProvisionNodeFirewall(t *testing.T) {
+	fake, sidecar, restore := testPolycube(t)
+	defer restore()
+
+	ip := "10.0.0.9"
+	cube := "fw-" + ip
+	fw := NodeFirewall(ip, fake.Host(), fake.Port())
+
+	//	It is never created here
+	assert.False(t, ProvisionFirewall(fw, false))
+	assert.Nil(t, fake.Firewall(cube))
+	assert.Equal(t, []string{"GET firewall/" + cube + "/"}, fake.Calls())
+
+	//	The one of pcn-k8s is adopted as it is
+	pcn := k8sfirewall.ChainRule{Action: "forward", Src: "10.0.0.2"}
+	fake.SetFirewall(cube, polycubetest.Firewall{
+		AcceptEstablished: "OFF",
+		Parent:            "veth1",
+		Chains:            map[string][]k8sfirewall.ChainRule{"egress": {pcn}},
+	})
+	calls := len(fake.Calls())
+	assert.True(t, ProvisionFirewall(fw, false))
+	assert.Equal(t, []string{"GET firewall/" + cube + "/"}, fake.Calls()[calls:])
+	state := fake.Firewall(cube)
+	assert.Equal(t, "OFF", state.AcceptEstablished)
+	assert.False(t, state.Interactive)
+	assert.Empty(t, state.Chains["ingress"])
+
+	//	There are no management rules to keep, and its mode is put back after changing rules
+	assert.Empty(t, ManagementRules(fw, "ingress"))
+	assert.True(t, matchesDesired(fw, &firewallState{}, false))
+	assert.False(t, matchesDesired(sidecar, &firewallState{}, false))
+	drop := k8sfirewall.ChainRule{Id: 1, Action: "drop", Dst: "5.6.7.8"}
+	assert.NoError(t, ApplyRulesDiff(fw, "ingress", nil, []k8sfirewall.ChainRule{drop}))
+	assert.False(t, fake.Firewall(cube).Interactive)
+
+	//	The ingress of the pod is the egress of the firewall of pcn-k8s
+	rules, err := ListRules(fw, "ingress")
+	assert.NoError(t, err)
+	if assert.Len(t, rules, 2) {
+		assert.True(t, SameRule(pcn, rules[0]))
+		assert.True(t, SameRule(drop, rules[1]))
+	}
+}
@@ -3,16 +3,19 @@ package utils
 import (
 	"bytes"
 	"net/http"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// sendClient gives up on endpoints that are too slow, so that they cannot hold data of other endpoints back
+var sendClient = &http.Client{Timeout: 10 * time.Second}
+
 func Post(endPoint, contentType string, data []byte) (*http.Response, error) {
 	req, err := http.NewRequest("POST", endPoint, bytes.NewBuffer(data))
 	req.Header.Set("Content-Type", contentType)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := sendClient.Do(req)
 	if err != nil {
 		log.Errorln("Error while trying to send request:", err)
 		return nil, err
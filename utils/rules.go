@@ -0,0 +1,252 @@
+package utils
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
+)
+
+// Directions are the chains of the firewall
+var Directions = []string{"ingress", "egress"}
+
+// ManagementRule returns the rule that keeps polycube reachable on the given direction
+func ManagementRule(fw Firewall, direction string) k8sfirewall.ChainRule {
+	return managementRules(fw)[direction]
+}
+
+// ManagementRules returns the rules that must come first on the given direction, to keep polycube reachable.
+// Firewalls of pcn-k8s have none, as polycube is not in the pod.
+func ManagementRules(fw Firewall, direction string) []k8sfirewall.ChainRule {
+	if rule, exists := managementRules(fw)[direction]; exists {
+		return []k8sfirewall.ChainRule{rule}
+	}
+	return []k8sfirewall.ChainRule{}
+}
+
+// IsManagementRule tells if a rule is one of the management rules of the given direction
+func IsManagementRule(fw Firewall, direction string, rule k8sfirewall.ChainRule) bool {
+	for _, management := range ManagementRules(fw, direction) {
+		if SameRule(rule, management) {
+			return true
+		}
+	}
+	return false
+}
+
+// DropAllRule returns a rule that drops all packets
+func DropAllRule() k8sfirewall.ChainRule {
+	return k8sfirewall.ChainRule{
+		Action:      "drop",
+		Description: "drop-all",
+	}
+}
+
+// normalizeRule returns the rule as polycube stores it, so that rules can be compared regardless of their id
+// and of how their fields were written: a single address is the same as its /32 network.
+func normalizeRule(rule k8sfirewall.ChainRule) k8sfirewall.ChainRule {
+	rule.Id = 0
+	rule.Src = strings.TrimSuffix(rule.Src, "/32")
+	rule.Dst = strings.TrimSuffix(rule.Dst, "/32")
+	rule.Action = strings.ToLower(rule.Action)
+	rule.L4proto = strings.ToLower(rule.L4proto)
+	rule.Conntrack = strings.ToLower(rule.Conntrack)
+	rule.Tcpflags = strings.ToLower(rule.Tcpflags)
+	return rule
+}
+
+// ListRules gets the rules currently enforced in a chain of the firewall
+func ListRules(fw Firewall, direction string) ([]k8sfirewall.ChainRule, error) {
+	data, err := doRequest("GET", chainURL(fw, direction, "rule/"), nil)
+	if err == errNotFound {
+		return []k8sfirewall.ChainRule{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []k8sfirewall.ChainRule{}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// ApplyRulesDiff deletes and inserts rules in a chain of the firewall, as returned by DiffRules, and then applies all of them at once.
+// The firewall is put in non-interactive mode while doing so, so that the changes are enforced together.
+// Firewalls of pcn-k8s are then put back in the mode they were, as ASTRID-kube does not own them.
+func ApplyRulesDiff(fw Firewall, direction string, toDelete []int32, toInsert []k8sfirewall.ChainRule) error {
+	interactive := true
+	if fw.node {
+		state, err := readFirewall(fw)
+		if err != nil {
+			return err
+		}
+		if state == nil {
+			return errNotFound
+		}
+		interactive = state.Interactive
+	}
+
+	if _, err := doRequest("PATCH", firewallURL(fw, "interactive"), []byte(`false`)); err != nil {
+		return err
+	}
+	defer setInteractive(fw, interactive)
+
+	//	Delete from the last one, so ids of the others don't change in the meantime
+	sorted := append([]int32{}, toDelete...)
+	sort.Slice(sorted, func(a, b int) bool {
+		return sorted[a] > sorted[b]
+	})
+	for _, id := range sorted {
+		_, err := doRequest("DELETE", chainURL(fw, direction, "rule/"+strconv.Itoa(int(id))+"/"), nil)
+		if err != nil && err != errNotFound {
+			return err
+		}
+	}
+
+	//	Insert from the first one, so that all rules before each of them are already in place
+	inserted := append([]k8sfirewall.ChainRule{}, toInsert...)
+	sort.SliceStable(inserted, func(a, b int) bool {
+		return inserted[a].Id < inserted[b].Id
+	})
+	for _, rule := range inserted {
+		if err := insertRule(fw, direction, rule.Id, rule); err != nil {
+			return err
+		}
+	}
+
+	_, err := doRequest("POST", chainURL(fw, direction, "apply-rules/"), nil)
+	return err
+}
+
+// DiffRules computes the fewest changes needed to turn the live rules into the desired ones.
+// Rules are compared in order, as polycube stops at the first one that matches:
+// the longest sequence of live rules that are in the desired ones, in the same order, is kept,
+// all other live rules are deleted, and the missing desired rules are inserted among them.
+// Rules to insert have their position in the desired ones as id.
+func DiffRules(live, desired []k8sfirewall.ChainRule) ([]int32, []k8sfirewall.ChainRule) {
+	//	kept[i][j] is how many rules can be kept between live[i:] and desired[j:]
+	kept := make([][]int, len(live)+1)
+	for i := range kept {
+		kept[i] = make([]int, len(desired)+1)
+	}
+	for i := len(live) - 1; i >= 0; i-- {
+		for j := len(desired) - 1; j >= 0; j-- {
+			switch {
+			case SameRule(live[i], desired[j]):
+				kept[i][j] = kept[i+1][j+1] + 1
+			case kept[i+1][j] >= kept[i][j+1]:
+				kept[i][j] = kept[i+1][j]
+			default:
+				kept[i][j] = kept[i][j+1]
+			}
+		}
+	}
+
+	toDelete := []int32{}
+	toInsert := []k8sfirewall.ChainRule{}
+	i, j := 0, 0
+	for i < len(live) || j < len(desired) {
+		switch {
+		case i < len(live) && j < len(desired) && SameRule(live[i], desired[j]):
+			i++
+			j++
+		case j == len(desired) || (i < len(live) && kept[i+1][j] >= kept[i][j+1]):
+			toDelete = append(toDelete, live[i].Id)
+			i++
+		default:
+			rule := desired[j]
+			rule.Id = int32(j)
+			toInsert = append(toInsert, rule)
+			j++
+		}
+	}
+
+	return toDelete, toInsert
+}
+
+// SameRule checks if two rules match the same traffic in the same way, regardless of their id
+func SameRule(a, b k8sfirewall.ChainRule) bool {
+	return normalizeRule(a) == normalizeRule(b)
+}
+
+// InsertRule puts a rule in a chain of the firewall at the provided position, and enforces it
+func InsertRule(fw Firewall, direction string, position int32, rule k8sfirewall.ChainRule) error {
+	if err := insertRule(fw, direction, position, rule); err != nil {
+		return err
+	}
+	return applyRules(fw, direction)
+}
+
+func insertRule(fw Firewall, direction string, position int32, rule k8sfirewall.ChainRule) error {
+	input := k8sfirewall.ChainInsertInput{
+		Id:          position,
+		Src:         rule.Src,
+		Dst:         rule.Dst,
+		L4proto:     rule.L4proto,
+		Sport:       rule.Sport,
+		Dport:       rule.Dport,
+		Tcpflags:    rule.Tcpflags,
+		Conntrack:   rule.Conntrack,
+		Action:      rule.Action,
+		Description: rule.Description,
+	}
+	data, err := json.Marshal(&input)
+	if err != nil {
+		return err
+	}
+
+	_, err = doRequest("POST", chainURL(fw, direction, "insert/"), data)
+	return err
+}
+
+// DeleteMatchingRule removes the first rule in a chain of the firewall that is equal to the provided one, if any,
+// and enforces the change
+func DeleteMatchingRule(fw Firewall, direction string, rule k8sfirewall.ChainRule) error {
+	live, err := ListRules(fw, direction)
+	if err != nil {
+		return err
+	}
+
+	for _, current := range live {
+		if !SameRule(current, rule) {
+			continue
+		}
+
+		_, err := doRequest("DELETE", chainURL(fw, direction, "rule/"+strconv.Itoa(int(current.Id))+"/"), nil)
+		if err == errNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return applyRules(fw, direction)
+	}
+
+	return nil
+}
+
+// applyRules enforces the changes made to a chain of the firewall, if it does not do it by itself.
+// Only firewalls of pcn-k8s can be non-interactive, as the others are provisioned as interactive.
+func applyRules(fw Firewall, direction string) error {
+	if !fw.node {
+		return nil
+	}
+
+	state, err := readFirewall(fw)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return errNotFound
+	}
+	if state.Interactive {
+		return nil
+	}
+
+	_, err = doRequest("POST", chainURL(fw, direction, "apply-rules/"), nil)
+	return err
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"testing"
+
+	k8sfirewall "github.com/polycube-network/polycube/src/components/k8s/utils/k8sfirewall"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffRules(t *testing.T) {
+	management := ManagementRule(DefaultFirewall("10.0.0.1"), "ingress")
+	drop := k8sfirewall.ChainRule{Action: "drop", Src: "10.0.0.2"}
+	forward := k8sfirewall.ChainRule{Action: "forward", Src: "10.0.0.3"}
+
+	live := []k8sfirewall.ChainRule{
+		{Id: 0, Action: management.Action, Dst: management.Dst + "/32", Dport: management.Dport},
+		{Id: 1, Action: "drop", Src: "10.0.0.2"},
+		{Id: 2, Action: "drop", Src: "10.0.0.2"},
+		{Id: 3, Action: "forward", Src: "10.0.0.4"},
+	}
+	desired := []k8sfirewall.ChainRule{management, drop, forward}
+
+	toDelete, toInsert := DiffRules(live, desired)
+	assert.Equal(t, []int32{2, 3}, toDelete)
+	assert.Equal(t, []k8sfirewall.ChainRule{withID(forward, 2)}, toInsert)
+
+	toDelete, toInsert = DiffRules(desired, desired)
+	assert.Empty(t, toDelete)
+	assert.Empty(t, toInsert)
+
+	//	The same rules in another order match different traffic
+	live = []k8sfirewall.ChainRule{
+		{Id: 0, Action: management.Action, Dst: management.Dst, Dport: management.Dport},
+		{Id: 1, Action: "forward", Src: "10.0.0.3"},
+		{Id: 2, Action: "drop", Src: "10.0.0.2"},
+	}
+	toDelete, toInsert = DiffRules(live, desired)
+	assert.Equal(t, []int32{1}, toDelete)
+	assert.Equal(t, []k8sfirewall.ChainRule{withID(forward, 2)}, toInsert)
+
+	//	A change to the first rule does not touch the others
+	first := k8sfirewall.ChainRule{Action: "drop", Src: "10.0.0.7"}
+	live = []k8sfirewall.ChainRule{
+		{Id: 0, Action: management.Action, Dst: management.Dst, Dport: management.Dport},
+		{Id: 1, Action: "drop", Src: "10.0.0.6"},
+		{Id: 2, Action: "drop", Src: "10.0.0.2"},
+		{Id: 3, Action: "forward", Src: "10.0.0.3"},
+	}
+	toDelete, toInsert = DiffRules(live, []k8sfirewall.ChainRule{management, first, drop, forward})
+	assert.Equal(t, []int32{1}, toDelete)
+	assert.Equal(t, []k8sfirewall.ChainRule{withID(first, 1)}, toInsert)
+}
+
+func TestApplyRulesDiff(t *testing.T) {
+	fake, fw, restore := testPolycube(t)
+	defer restore()
+
+	assert.True(t, ProvisionFirewall(fw, false))
+	management := ManagementRule(fw, "ingress")
+	rules := []k8sfirewall.ChainRule{}
+	for _, src := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"} {
+		rules = append(rules, k8sfirewall.ChainRule{Action: "drop", Src: src})
+	}
+	live := []k8sfirewall.ChainRule{management, rules[1], rules[0], rules[3]}
+	for j, rule := range live[1:] {
+		assert.NoError(t, InsertRule(fw, "ingress", int32(j+1), rule))
+	}
+
+	//	Rules end up in the desired order, whatever has to be moved
+	desired := []k8sfirewall.ChainRule{management, rules[0], rules[1], rules[2], rules[3]}
+	current, err := ListRules(fw, "ingress")
+	assert.NoError(t, err)
+	toDelete, toInsert := DiffRules(current, desired)
+	assert.Len(t, toDelete, 1)
+	assert.Len(t, toInsert, 2)
+	calls := len(fake.Calls())
+	assert.NoError(t, ApplyRulesDiff(fw, "ingress", toDelete, toInsert))
+	assert.Equal(t, []string{
+		"PATCH firewall/fw/interactive",
+		"DELETE firewall/fw/chain/ingress/rule/1/",
+		"POST firewall/fw/chain/ingress/insert/",
+		"POST firewall/fw/chain/ingress/insert/",
+		"POST firewall/fw/chain/ingress/apply-rules/",
+		"PATCH firewall/fw/interactive",
+	}, fake.Calls()[calls:])
+
+	current, err = ListRules(fw, "ingress")
+	assert.NoError(t, err)
+	if assert.Len(t, current, len(desired)) {
+		for j := range desired {
+			assert.True(t, SameRule(desired[j], current[j]))
+		}
+	}
+}
+
+func withID(rule k8sfirewall.ChainRule, id int32) k8sfirewall.ChainRule {
+	rule.Id = id
+	return rule
+}
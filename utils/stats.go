@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"encoding/json"
+)
+
+// ChainStats are the counters of a rule in a chain of the firewall.
+// Counters are read as 64 bit integers, as they easily overflow the types used by the polycube client.
+type ChainStats struct {
+	Id          int32  `json:"id"`
+	Pkts        uint64 `json:"pkts,omitempty"`
+	Bytes       uint64 `json:"bytes,omitempty"`
+	Src         string `json:"src,omitempty"`
+	Dst         string `json:"dst,omitempty"`
+	Action      string `json:"action,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// ReadChainStats gets the counters of all rules in a chain of the firewall,
+// including the one of the default action.
+func ReadChainStats(fw Firewall, direction string) ([]ChainStats, error) {
+	data, err := doRequest("GET", chainURL(fw, direction, "stats/"), nil)
+	if err == errNotFound {
+		return []ChainStats{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stats := []ChainStats{}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
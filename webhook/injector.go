@@ -0,0 +1,218 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	admission_v1beta1 "k8s.io/api/admission/v1beta1"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	securityComponentsAnnotation = "astrid.io/security-components"
+)
+
+// Injector is a mutating admission webhook that injects the polycubed sidecar
+// in the pods of deployments that need a firewall
+type Injector struct {
+	clientset kubernetes.Interface
+	template  Template
+}
+
+// patchOperation is a single operation of a JSON patch
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// New returns an injector that injects the provided template
+func New(clientset kubernetes.Interface, template Template) *Injector {
+	return &Injector{
+		clientset: clientset,
+		template:  template,
+	}
+}
+
+// Serve starts serving the webhook at the provided address.
+// The API server only calls webhooks over TLS, so a certificate is needed.
+func Serve(address, certFile, keyFile string, injector *Injector) {
+	if len(certFile) < 1 || len(keyFile) < 1 {
+		log.Errorln("No certificate has been specified for the webhook. Will not serve it.")
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/inject", injector)
+
+	log.Infoln("Serving sidecar injection webhook on", address)
+	if err := http.ListenAndServeTLS(address, certFile, keyFile, mux); err != nil {
+		log.Errorln("Could not serve webhook:", err)
+	}
+}
+
+func (i *Injector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Could not read the request", http.StatusBadRequest)
+		return
+	}
+
+	review := admission_v1beta1.AdmissionReview{}
+	if err := json.Unmarshal(data, &review); err != nil || review.Request == nil {
+		http.Error(w, "Could not parse the admission review", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = i.review(review.Request)
+	review.Response.UID = review.Request.UID
+	review.Request = nil
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&review); err != nil {
+		log.Errorln("Could not write admission response:", err)
+	}
+}
+
+// review decides what to change in a pod. Pods are always admitted, even when they cannot be injected,
+// as refusing them would stop deployments from working without ASTRID-kube.
+func (i *Injector) review(request *admission_v1beta1.AdmissionRequest) *admission_v1beta1.AdmissionResponse {
+	allowed := &admission_v1beta1.AdmissionResponse{Allowed: true}
+
+	if request.Kind.Kind != "Pod" || request.Operation != admission_v1beta1.Create {
+		return allowed
+	}
+
+	pod := core_v1.Pod{}
+	if err := json.Unmarshal(request.Object.Raw, &pod); err != nil {
+		log.Errorln("Could not parse pod to inject:", err)
+		return allowed
+	}
+
+	needed, err := i.needsInjection(request.Namespace, &pod)
+	if err != nil {
+		log.Errorf("Could not check if pod %s needs polycube: %s", pod.GenerateName, err)
+		allowed.Result = &meta_v1.Status{Message: "Could not check if polycube is needed: " + err.Error()}
+		return allowed
+	}
+	if !needed {
+		return allowed
+	}
+
+	operations := i.patch(&pod)
+	if len(operations) == 0 {
+		return allowed
+	}
+
+	patch, err := json.Marshal(operations)
+	if err != nil {
+		log.Errorln("Could not marshal patch:", err)
+		return allowed
+	}
+
+	log.Infof("Injecting polycube in pod %s%s of namespace %s", pod.Name, pod.GenerateName, request.Namespace)
+	patchType := admission_v1beta1.PatchTypeJSONPatch
+	allowed.Patch = patch
+	allowed.PatchType = &patchType
+	return allowed
+}
+
+// needsInjection checks if the deployment that owns the pod needs a firewall
+func (i *Injector) needsInjection(namespace string, pod *core_v1.Pod) (bool, error) {
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind != "ReplicaSet" {
+			continue
+		}
+
+		replicaSet, err := i.clientset.AppsV1().ReplicaSets(namespace).Get(owner.Name, meta_v1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		for _, rsOwner := range replicaSet.OwnerReferences {
+			if rsOwner.Kind != "Deployment" {
+				continue
+			}
+
+			deployment, err := i.clientset.AppsV1().Deployments(namespace).Get(rsOwner.Name, meta_v1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return needsFirewall(deployment.Annotations), nil
+		}
+	}
+
+	return false, nil
+}
+
+// needsFirewall checks if the firewall is among the security components in the annotations
+func needsFirewall(annotations map[string]string) bool {
+	value, exists := annotations[securityComponentsAnnotation]
+	if !exists {
+		return false
+	}
+
+	components := []string{}
+	if err := json.Unmarshal([]byte(value), &components); err != nil {
+		log.Errorln("Could not parse security components:", err)
+		return false
+	}
+
+	for _, component := range components {
+		if component == "firewall" {
+			return true
+		}
+	}
+	return false
+}
+
+// patch returns the operations that add the template to the pod.
+// Containers and volumes that the pod already has are left alone, so injecting twice changes nothing.
+func (i *Injector) patch(pod *core_v1.Pod) []patchOperation {
+	operations := []patchOperation{}
+
+	containers := map[string]bool{}
+	for _, container := range pod.Spec.Containers {
+		containers[container.Name] = true
+	}
+	for _, container := range i.template.Containers {
+		if !containers[container.Name] {
+			operations = append(operations, patchOperation{Op: "add", Path: "/spec/containers/-", Value: container})
+		}
+	}
+
+	//	Already injected: volumes may have been changed on purpose, so better not to touch them
+	if len(operations) == 0 {
+		return operations
+	}
+
+	volumes := map[string]bool{}
+	for _, volume := range pod.Spec.Volumes {
+		volumes[volume.Name] = true
+	}
+	missing := []core_v1.Volume{}
+	for _, volume := range i.template.Volumes {
+		if !volumes[volume.Name] {
+			missing = append(missing, volume)
+		}
+	}
+
+	//	A JSON patch cannot append to an array that does not exist
+	if len(pod.Spec.Volumes) == 0 && len(missing) > 0 {
+		return append(operations, patchOperation{Op: "add", Path: "/spec/volumes", Value: missing})
+	}
+	for _, volume := range missing {
+		operations = append(operations, patchOperation{Op: "add", Path: "/spec/volumes/-", Value: volume})
+	}
+
+	return operations
+}
@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/stretchr/testify/assert"
+	admission_v1beta1 "k8s.io/api/admission/v1beta1"
+	apps_v1 "k8s.io/api/apps/v1"
+	core_v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestInjector(template Template) *Injector {
+	owned := func(name, deployment string) *apps_v1.ReplicaSet {
+		return &apps_v1.ReplicaSet{ObjectMeta: meta_v1.ObjectMeta{
+			Name:            name,
+			Namespace:       "mygraph",
+			OwnerReferences: []meta_v1.OwnerReference{{Kind: "Deployment", Name: deployment}},
+		}}
+	}
+
+	clientset := fake.NewSimpleClientset(
+		&apps_v1.Deployment{ObjectMeta: meta_v1.ObjectMeta{
+			Name:        "apache",
+			Namespace:   "mygraph",
+			Annotations: map[string]string{securityComponentsAnnotation: `["firewall"]`},
+		}},
+		&apps_v1.Deployment{ObjectMeta: meta_v1.ObjectMeta{Name: "redis", Namespace: "mygraph"}},
+		owned("apache-5d8f7c9b6", "apache"),
+		owned("redis-7b6c5d4e3", "redis"),
+	)
+	return New(clientset, template)
+}
+
+// send posts an admission review fixture to the injector and returns the review it responds with
+func send(t *testing.T, injector *Injector, fixture string) (admission_v1beta1.AdmissionReview, admission_v1beta1.AdmissionReview) {
+	data, err := ioutil.ReadFile("testdata/" + fixture)
+	assert.NoError(t, err)
+	request := admission_v1beta1.AdmissionReview{}
+	assert.NoError(t, json.Unmarshal(data, &request))
+
+	recorder := httptest.NewRecorder()
+	injector.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/inject", bytes.NewReader(data)))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	response := admission_v1beta1.AdmissionReview{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.NotNil(t, response.Response)
+	assert.Equal(t, request.Request.UID, response.Response.UID)
+	assert.True(t, response.Response.Allowed)
+	return request, response
+}
+
+// patched applies the patch in the response to the pod in the request
+func patched(t *testing.T, request, response admission_v1beta1.AdmissionReview) core_v1.Pod {
+	patch, err := jsonpatch.DecodePatch(response.Response.Patch)
+	assert.NoError(t, err)
+	data, err := patch.Apply(request.Request.Object.Raw)
+	assert.NoError(t, err)
+
+	pod := core_v1.Pod{}
+	assert.NoError(t, json.Unmarshal(data, &pod))
+	return pod
+}
+
+func TestInjectDefaultTemplate(t *testing.T) {
+	injector := newTestInjector(DefaultTemplate())
+
+	request, response := send(t, injector, "pod-needs-firewall.json")
+	assert.Equal(t, admission_v1beta1.PatchTypeJSONPatch, *response.Response.PatchType)
+
+	pod := patched(t, request, response)
+	assert.Len(t, pod.Spec.Containers, 2)
+	assert.Equal(t, "apache", pod.Spec.Containers[0].Name)
+	assert.Equal(t, "polycubed", pod.Spec.Containers[1].Name)
+	assert.True(t, *pod.Spec.Containers[1].SecurityContext.Privileged)
+	assert.Len(t, pod.Spec.Volumes, len(DefaultTemplate().Volumes))
+}
+
+func TestInjectCustomTemplate(t *testing.T) {
+	template, err := LoadTemplate("testdata/template.yaml")
+	assert.NoError(t, err)
+	injector := newTestInjector(template)
+
+	request, response := send(t, injector, "pod-needs-firewall.json")
+	pod := patched(t, request, response)
+	assert.Equal(t, "polycubenetwork/polycube:v0.9", pod.Spec.Containers[1].Image)
+	assert.Equal(t, []core_v1.Volume{{Name: "lib-modules", VolumeSource: core_v1.VolumeSource{HostPath: &core_v1.HostPathVolumeSource{Path: "/lib/modules"}}}}, pod.Spec.Volumes)
+}
+
+func TestInjectIdempotent(t *testing.T) {
+	injector := newTestInjector(DefaultTemplate())
+
+	_, response := send(t, injector, "pod-already-injected.json")
+	assert.Empty(t, response.Response.Patch)
+	assert.Nil(t, response.Response.PatchType)
+
+	//	Injecting the result again changes nothing
+	request, response := send(t, injector, "pod-needs-firewall.json")
+	pod := patched(t, request, response)
+	assert.Empty(t, injector.patch(&pod))
+}
+
+func TestSkipWithoutFirewall(t *testing.T) {
+	injector := newTestInjector(DefaultTemplate())
+
+	_, response := send(t, injector, "pod-no-firewall.json")
+	assert.Empty(t, response.Response.Patch)
+}
+
+func TestRejectMalformedReview(t *testing.T) {
+	injector := newTestInjector(DefaultTemplate())
+
+	recorder := httptest.NewRecorder()
+	injector.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/inject", bytes.NewReader([]byte("{"))))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"io/ioutil"
+
+	core_v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Template is what gets injected in pods that need polycube:
+// the polycubed container and the volumes it needs.
+type Template struct {
+	Containers []core_v1.Container `json:"containers"`
+	Volumes    []core_v1.Volume    `json:"volumes"`
+}
+
+// LoadTemplate reads a template from a yaml file.
+// The default template is returned if the path is empty.
+func LoadTemplate(path string) (Template, error) {
+	if len(path) < 1 {
+		return DefaultTemplate(), nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Template{}, err
+	}
+
+	template := Template{}
+	if err := yaml.Unmarshal(data, &template); err != nil {
+		return Template{}, err
+	}
+	return template, nil
+}
+
+// DefaultTemplate returns the same sidecar that the README describes for manual injection
+func DefaultTemplate() Template {
+	privileged := true
+	hostPath := func(name, path string) core_v1.Volume {
+		return core_v1.Volume{
+			Name: name,
+			VolumeSource: core_v1.VolumeSource{
+				HostPath: &core_v1.HostPathVolumeSource{Path: path},
+			},
+		}
+	}
+
+	return Template{
+		Containers: []core_v1.Container{
+			{
+				Name:            "polycubed",
+				Image:           "polycubenetwork/polycube:latest",
+				ImagePullPolicy: core_v1.PullAlways,
+				Command:         []string{"polycubed", "--loglevel=DEBUG", "--addr=0.0.0.0", "--logfile=/host/var/log/pcn_k8s"},
+				VolumeMounts: []core_v1.VolumeMount{
+					{Name: "lib-modules", MountPath: "/lib/modules"},
+					{Name: "usr-src", MountPath: "/usr/src"},
+					{Name: "cni-path", MountPath: "/host/opt/cni/bin"},
+					{Name: "etc-cni-netd", MountPath: "/host/etc/cni/net.d"},
+					{Name: "var-log", MountPath: "/host/var/log"},
+				},
+				SecurityContext: &core_v1.SecurityContext{Privileged: &privileged},
+				Ports: []core_v1.ContainerPort{
+					{Name: "polycubed", ContainerPort: 9000},
+				},
+				TerminationMessagePolicy: core_v1.TerminationMessageFallbackToLogsOnError,
+			},
+		},
+		Volumes: []core_v1.Volume{
+			hostPath("lib-modules", "/lib/modules"),
+			hostPath("usr-src", "/usr/src"),
+			hostPath("cni-path", "/opt/cni/bin"),
+			hostPath("etc-cni-netd", "/etc/cni/net.d"),
+			hostPath("var-log", "/var/log"),
+			hostPath("netns", "/var/run/netns"),
+			hostPath("proc", "/proc/"),
+		},
+	}
+}